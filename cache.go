@@ -0,0 +1,518 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStatus tells how the response is served by WithCache.
+type CacheStatus string
+
+// These constants are CacheStatus of HttpResponse, it is empty when cache is not used.
+const (
+	CacheHit         CacheStatus = "hit"         // served from cache without contacting upstream
+	CacheMiss        CacheStatus = "miss"        // not found in cache, served from upstream
+	CacheRevalidated CacheStatus = "revalidated" // stale in cache, upstream confirmed it's still valid (304)
+	CacheStale       CacheStatus = "stale"       // stale in cache, served because of stale-while-revalidate or stale-if-error
+	CacheBypass      CacheStatus = "bypass"      // request can't use cache, e.g. POST or Cache-Control: no-store
+)
+
+// cacheStatusHeader is the RFC 9211 header written to the response, cacheName identifies this cache in it.
+const (
+	cacheStatusHeader = "Cache-Status"
+	cacheName         = "rest"
+)
+
+// heuristicallyCacheable is the status codes that can be cached without explicit freshness, see RFC 9110 section 15.1
+var heuristicallyCacheable = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// cacheControl is parsed Cache-Control header, directive name is in lower case.
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+
+			name, arg, _ := strings.Cut(directive, "=")
+			cc[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(arg), `"`)
+		}
+	}
+
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// seconds returns duration argument of directive such as max-age=60
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	arg, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+
+	return time.Duration(n) * time.Second, true
+}
+
+// cacheEntry is the stored response
+type cacheEntry struct {
+	Status       string      `json:"status"`
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	Vary         http.Header `json:"vary"` // request header values of the names listed in Vary
+	RequestTime  time.Time   `json:"request_time"`
+	ResponseTime time.Time   `json:"response_time"`
+}
+
+func (e *cacheEntry) date() time.Time {
+	date, err := http.ParseTime(e.Header.Get("Date"))
+	if err != nil {
+		return e.ResponseTime
+	}
+
+	return date
+}
+
+// freshness returns freshness lifetime, see RFC 9111 section 4.2.1
+func (e *cacheEntry) freshness() time.Duration {
+	if maxAge, ok := parseCacheControl(e.Header).seconds("max-age"); ok {
+		return maxAge
+	}
+
+	if expires := e.Header.Get("Expires"); expires != "" {
+		// invalid Expires, e.g. "0", means already expired
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+
+		return t.Sub(e.date())
+	}
+
+	if !heuristicallyCacheable[e.StatusCode] {
+		return 0
+	}
+
+	// heuristic freshness is 10% of the time since last modified, see RFC 9111 section 4.2.2
+	if lastModified, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil && e.date().After(lastModified) {
+		return e.date().Sub(lastModified) / 10
+	}
+
+	return 0
+}
+
+// age returns current age, see RFC 9111 section 4.2.3
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	apparentAge := e.ResponseTime.Sub(e.date())
+	if apparentAge < 0 {
+		apparentAge = 0
+	}
+
+	ageValue, _ := strconv.ParseInt(e.Header.Get("Age"), 10, 64)
+	correctedAge := time.Duration(ageValue)*time.Second + e.ResponseTime.Sub(e.RequestTime)
+	if correctedAge > apparentAge {
+		apparentAge = correctedAge
+	}
+
+	return apparentAge + now.Sub(e.ResponseTime)
+}
+
+func (e *cacheEntry) varyMatches(req *http.Request) bool {
+	for name, values := range e.Vary {
+		if strings.Join(req.Header.Values(name), ",") != strings.Join(values, ",") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e *cacheEntry) hasValidator() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+// response builds http.Response from cached entry
+func (e *cacheEntry) response(req *http.Request, now time.Time, status CacheStatus) *http.Response {
+	header := e.Header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(e.age(now)/time.Second), 10))
+	setCacheStatus(header, status)
+
+	resp := NewResponse(req, e.StatusCode, header, e.Body)
+	if e.Status != "" {
+		// keep the reason phrase sent by upstream
+		resp.Status = e.Status
+	}
+
+	return resp
+}
+
+// setCacheStatus writes RFC 9211 Cache-Status header
+func setCacheStatus(header http.Header, status CacheStatus) {
+	var value string
+	switch status {
+	case CacheHit:
+		value = cacheName + "; hit"
+	case CacheStale:
+		value = cacheName + "; hit; detail=stale"
+	case CacheRevalidated:
+		value = cacheName + "; fwd=stale; fwd-status=304"
+	case CacheMiss:
+		value = cacheName + "; fwd=miss"
+	default:
+		value = cacheName + "; fwd=bypass"
+	}
+
+	header.Set(cacheStatusHeader, value)
+}
+
+// parseCacheStatus reads CacheStatus from RFC 9211 Cache-Status header written by setCacheStatus
+func parseCacheStatus(header http.Header) CacheStatus {
+	for _, value := range header.Values(cacheStatusHeader) {
+		for _, member := range strings.Split(value, ",") {
+			params := strings.Split(member, ";")
+			if strings.TrimSpace(params[0]) != cacheName {
+				continue
+			}
+
+			switch strings.Join(strings.Fields(strings.Join(params[1:], ";")), "") {
+			case "hit":
+				return CacheHit
+			case "hit;detail=stale":
+				return CacheStale
+			case "fwd=stale;fwd-status=304":
+				return CacheRevalidated
+			case "fwd=miss":
+				return CacheMiss
+			default:
+				return CacheBypass
+			}
+		}
+	}
+
+	return ""
+}
+
+// cacheClient is HttpClient decorator implementing private HTTP cache as described in RFC 9111.
+// Only GET and HEAD responses are cached, a successful unsafe request invalidates cached GET of the same URL.
+type cacheClient struct {
+	client HttpClient
+	store  CacheStore
+	now    func() time.Time
+
+	mu           sync.Mutex
+	revalidating map[string]bool
+}
+
+func newCacheClient(store CacheStore, client HttpClient) *cacheClient {
+	return &cacheClient{
+		client:       client,
+		store:        store,
+		now:          time.Now,
+		revalidating: make(map[string]bool),
+	}
+}
+
+// cacheKey identifies stored response by method, URL and a digest of the request credentials,
+// so a response is never served to a request sent with other credentials.
+func cacheKey(method string, req *http.Request) string {
+	key := method + " " + req.URL.String()
+
+	digest := sha256.New()
+	var hasCredentials bool
+	for _, name := range credentialHeaders {
+		values := req.Header.Values(name)
+		hasCredentials = hasCredentials || len(values) > 0
+		_, _ = fmt.Fprintf(digest, "%s: %s\n", name, strings.Join(values, ","))
+	}
+
+	if hasCredentials {
+		key += " " + hex.EncodeToString(digest.Sum(nil))
+	}
+
+	return key
+}
+
+func (c *cacheClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		resp, err := c.client.Do(req)
+		if err == nil && resp != nil && resp.StatusCode < http.StatusBadRequest {
+			c.store.Delete(cacheKey(http.MethodGet, req))
+			c.store.Delete(cacheKey(http.MethodHead, req))
+		}
+
+		return withCacheStatus(resp, CacheBypass), err
+	}
+
+	reqCC := parseCacheControl(req.Header)
+	conditional := req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != ""
+	if reqCC.has("no-store") || conditional {
+		resp, err := c.client.Do(req)
+		return withCacheStatus(resp, CacheBypass), err
+	}
+
+	key := cacheKey(req.Method, req)
+	entry := c.load(key, req)
+	if entry == nil {
+		return c.fetch(req, key, nil)
+	}
+
+	now := c.now()
+	age, lifetime := entry.age(now), entry.freshness()
+	respCC := parseCacheControl(entry.Header)
+
+	fresh := age < lifetime && !respCC.has("no-cache") && !reqCC.has("no-cache")
+	if maxAge, ok := reqCC.seconds("max-age"); ok && age > maxAge {
+		fresh = false
+	}
+
+	if fresh {
+		return entry.response(req, now, CacheHit), nil
+	}
+
+	if swr, ok := respCC.seconds("stale-while-revalidate"); ok && age < lifetime+swr &&
+		!respCC.has("must-revalidate") && !respCC.has("no-cache") && !reqCC.has("no-cache") {
+		c.revalidateInBackground(req, key, entry)
+		return entry.response(req, now, CacheStale), nil
+	}
+
+	return c.fetch(req, key, entry)
+}
+
+func withCacheStatus(resp *http.Response, status CacheStatus) *http.Response {
+	if resp != nil {
+		if resp.Header == nil {
+			resp.Header = http.Header{}
+		}
+
+		setCacheStatus(resp.Header, status)
+	}
+
+	return resp
+}
+
+func (c *cacheClient) load(key string, req *http.Request) *cacheEntry {
+	value, ok := c.store.Get(key)
+	if !ok {
+		return nil
+	}
+
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(value, entry); err != nil || !entry.varyMatches(req) {
+		return nil
+	}
+
+	return entry
+}
+
+func (c *cacheClient) save(key string, entry *cacheEntry) {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	c.store.Set(key, value)
+}
+
+// fetch sends request to upstream, with conditional header when stale entry is available.
+func (c *cacheClient) fetch(req *http.Request, key string, entry *cacheEntry) (*http.Response, error) {
+	outReq := req
+	if entry != nil && entry.hasValidator() {
+		outReq = req.Clone(req.Context())
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			outReq.Header.Set("If-None-Match", etag)
+		}
+
+		if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+			outReq.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	requestTime := c.now()
+	resp, err := c.client.Do(outReq)
+	responseTime := c.now()
+
+	if entry != nil && c.canServeStaleOnError(entry, responseTime, resp, err) {
+		if resp != nil && resp.Body != nil {
+			_ = resp.Body.Close()
+		}
+
+		return entry.response(req, responseTime, CacheStale), nil
+	}
+
+	if err != nil || resp == nil {
+		return resp, err
+	}
+
+	if entry != nil && resp.StatusCode == http.StatusNotModified {
+		_ = resp.Body.Close()
+
+		// RFC 9111 section 4.3.4, update stored header using the 304 response
+		for name, values := range resp.Header {
+			entry.Header[name] = values
+		}
+		entry.RequestTime = requestTime
+		entry.ResponseTime = responseTime
+		c.save(key, entry)
+
+		return entry.response(req, responseTime, CacheRevalidated), nil
+	}
+
+	newEntry := &cacheEntry{
+		Status:       resp.Status,
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		RequestTime:  requestTime,
+		ResponseTime: responseTime,
+	}
+
+	if !c.storable(req, resp, newEntry) {
+		return withCacheStatus(resp, CacheMiss), nil
+	}
+
+	limit, _ := maxResponseBytesFromContext(req.Context())
+	if limit > 0 && resp.ContentLength > limit {
+		return withCacheStatus(resp, CacheMiss), nil
+	}
+
+	body, err := readLimited(resp.Body, limit)
+	if errors.Is(err, ErrResponseTooLarge) {
+		// not stored, the caller reads the rest of the body and fails at the limit
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return withCacheStatus(resp, CacheMiss), nil
+	}
+
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error read body response for cache: %s", err.Error())
+	}
+
+	newEntry.Body = body
+	c.save(key, newEntry)
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return withCacheStatus(resp, CacheMiss), nil
+}
+
+// storable returns true when response may be stored, see RFC 9111 section 3
+func (c *cacheClient) storable(req *http.Request, resp *http.Response, entry *cacheEntry) bool {
+	respCC := parseCacheControl(resp.Header)
+	if respCC.has("no-store") || resp.StatusCode == http.StatusPartialContent {
+		return false
+	}
+
+	explicit := respCC.has("max-age") || resp.Header.Get("Expires") != ""
+	if !explicit && !heuristicallyCacheable[resp.StatusCode] {
+		return false
+	}
+
+	if entry.freshness() <= 0 && !entry.hasValidator() {
+		return false
+	}
+
+	vary := http.Header{}
+	for _, value := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return false
+			}
+
+			if name != "" {
+				vary[http.CanonicalHeaderKey(name)] = req.Header.Values(name)
+			}
+		}
+	}
+	entry.Vary = vary
+
+	return true
+}
+
+// canServeStaleOnError returns true when upstream fails and stale-if-error allows serving stale entry
+func (c *cacheClient) canServeStaleOnError(entry *cacheEntry, now time.Time, resp *http.Response, err error) bool {
+	if err == nil && resp != nil && resp.StatusCode < http.StatusInternalServerError {
+		return false
+	}
+
+	respCC := parseCacheControl(entry.Header)
+	if respCC.has("must-revalidate") {
+		return false
+	}
+
+	sie, ok := respCC.seconds("stale-if-error")
+	return ok && entry.age(now) < entry.freshness()+sie
+}
+
+// revalidateInBackground refreshes the entry without blocking the caller, at most once per key at a time.
+func (c *cacheClient) revalidateInBackground(req *http.Request, key string, entry *cacheEntry) {
+	c.mu.Lock()
+	if c.revalidating[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.revalidating[key] = true
+	c.mu.Unlock()
+
+	// caller's context is done as soon as it returns, so background request uses its own with the same limit
+	ctx := context.Background()
+	if limit, ok := maxResponseBytesFromContext(req.Context()); ok {
+		ctx = ContextWithMaxResponseBytes(ctx, limit)
+	}
+
+	bgReq := req.Clone(ctx)
+	bgReq.Body = http.NoBody
+	bgReq.ContentLength = 0
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.revalidating, key)
+			c.mu.Unlock()
+		}()
+
+		resp, err := c.fetch(bgReq, key, entry)
+		if err == nil && resp != nil && resp.Body != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+	}()
+}
@@ -0,0 +1,154 @@
+package rest
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CacheStore stores serialized cached responses used by WithCache.
+// Implementation must be safe for concurrent use. Cache is best-effort,
+// so implementation should treat any storage error as a miss.
+type CacheStore interface {
+	Get(key string) (value []byte, ok bool)
+	Set(key string, value []byte)
+	Delete(key string)
+}
+
+// MemoryCacheStore is in-memory CacheStore that evicts the least recently used entry
+// when the number of entries exceeds its limit.
+type MemoryCacheStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List
+	items      map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	value []byte
+}
+
+// Validates that current implementation is implement CacheStore interface.
+var _ CacheStore = &MemoryCacheStore{}
+
+// NewMemoryCacheStore returns MemoryCacheStore keeping at most maxEntries responses,
+// when maxEntries <= 0 it defaults to 1000.
+func NewMemoryCacheStore(maxEntries int) *MemoryCacheStore {
+	if maxEntries <= 0 {
+		maxEntries = 1000
+	}
+
+	return &MemoryCacheStore{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (m *MemoryCacheStore) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	m.ll.MoveToFront(el)
+	return el.Value.(*memoryCacheItem).value, true
+}
+
+func (m *MemoryCacheStore) Set(key string, value []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		el.Value.(*memoryCacheItem).value = value
+		m.ll.MoveToFront(el)
+		return
+	}
+
+	m.items[key] = m.ll.PushFront(&memoryCacheItem{key: key, value: value})
+	for m.ll.Len() > m.maxEntries {
+		oldest := m.ll.Back()
+		m.ll.Remove(oldest)
+		delete(m.items, oldest.Value.(*memoryCacheItem).key)
+	}
+}
+
+func (m *MemoryCacheStore) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		m.ll.Remove(el)
+		delete(m.items, key)
+	}
+}
+
+// Len returns number of cached entries.
+func (m *MemoryCacheStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.ll.Len()
+}
+
+// FileCacheStore is CacheStore that writes each entry as a file in a directory,
+// so the cache survives restart and can be shared by processes on the same host.
+type FileCacheStore struct {
+	dir string
+}
+
+// Validates that current implementation is implement CacheStore interface.
+var _ CacheStore = &FileCacheStore{}
+
+// NewFileCacheStore returns FileCacheStore writing to dir, the directory is created if not exist.
+func NewFileCacheStore(dir string) (*FileCacheStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &FileCacheStore{dir: dir}, nil
+}
+
+func (f *FileCacheStore) path(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(f.dir, hex.EncodeToString(hash[:]))
+}
+
+func (f *FileCacheStore) Get(key string) ([]byte, bool) {
+	value, err := os.ReadFile(f.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	return value, true
+}
+
+func (f *FileCacheStore) Set(key string, value []byte) {
+	tmp, err := os.CreateTemp(f.dir, "tmp-*")
+	if err != nil {
+		return
+	}
+
+	_, errWrite := tmp.Write(value)
+	errClose := tmp.Close()
+	if errWrite != nil || errClose != nil {
+		_ = os.Remove(tmp.Name())
+		return
+	}
+
+	// rename is atomic, reader never sees partially written entry
+	if err := os.Rename(tmp.Name(), f.path(key)); err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+}
+
+func (f *FileCacheStore) Delete(key string) {
+	_ = os.Remove(f.path(key))
+}
@@ -0,0 +1,59 @@
+package rest
+
+import (
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemoryCacheStore(t *testing.T) {
+	convey.Convey("Memory cache store", t, func() {
+		store := NewMemoryCacheStore(2)
+
+		convey.Convey("Should evict least recently used entry", func() {
+			store.Set("a", []byte("1"))
+			store.Set("b", []byte("2"))
+			_, _ = store.Get("a")
+			store.Set("c", []byte("3"))
+
+			_, ok := store.Get("b")
+			convey.So(ok, convey.ShouldBeFalse)
+
+			value, ok := store.Get("a")
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(string(value), convey.ShouldEqual, "1")
+			convey.So(store.Len(), convey.ShouldEqual, 2)
+		})
+
+		convey.Convey("Should replace and delete entry", func() {
+			store.Set("a", []byte("1"))
+			store.Set("a", []byte("2"))
+
+			value, _ := store.Get("a")
+			convey.So(string(value), convey.ShouldEqual, "2")
+
+			store.Delete("a")
+			_, ok := store.Get("a")
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+	})
+}
+
+func TestFileCacheStore(t *testing.T) {
+	convey.Convey("File cache store", t, func() {
+		store, err := NewFileCacheStore(t.TempDir())
+		convey.So(err, convey.ShouldBeNil)
+
+		_, ok := store.Get("GET http://example.com/")
+		convey.So(ok, convey.ShouldBeFalse)
+
+		store.Set("GET http://example.com/", []byte("cached"))
+		value, ok := store.Get("GET http://example.com/")
+		convey.So(ok, convey.ShouldBeTrue)
+		convey.So(string(value), convey.ShouldEqual, "cached")
+
+		store.Delete("GET http://example.com/")
+		_, ok = store.Get("GET http://example.com/")
+		convey.So(ok, convey.ShouldBeFalse)
+	})
+}
@@ -0,0 +1,329 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// cacheUpstream returns mock client answering with the given header and body, and counts the calls.
+func cacheUpstream(calls *int32, status int, header http.Header, body string) *mockClient {
+	return &mockClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt32(calls, 1)
+			return &http.Response{
+				Status:     http.StatusText(status),
+				StatusCode: status,
+				Header:     header.Clone(),
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(body))),
+			}, nil
+		},
+	}
+}
+
+func TestCacheClient(t *testing.T) {
+	convey.Convey("Cache client", t, func() {
+		ctx := context.Background()
+		now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		var calls int32
+
+		newRequester := func(upstream HttpClient) (*DefaultHttpRequester, *cacheClient) {
+			cache := newCacheClient(NewMemoryCacheStore(10), upstream)
+			cache.now = func() time.Time { return now }
+
+			requester, err := DefaultClient(cache)
+			convey.So(err, convey.ShouldBeNil)
+			return requester, cache
+		}
+
+		header := func(kv ...string) http.Header {
+			h := http.Header{"Date": {now.Format(http.TimeFormat)}}
+			for i := 0; i < len(kv); i += 2 {
+				h.Add(kv[i], kv[i+1])
+			}
+			return h
+		}
+
+		convey.Convey("Fresh response should be served from cache", func() {
+			requester, _ := newRequester(cacheUpstream(&calls, http.StatusOK, header("Cache-Control", "max-age=60"), "cached"))
+
+			resp, err := requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(resp.CacheStatus, convey.ShouldEqual, CacheMiss)
+
+			now = now.Add(30 * time.Second)
+			resp, err = requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(resp.CacheStatus, convey.ShouldEqual, CacheHit)
+			convey.So(string(resp.RespBody), convey.ShouldEqual, "cached")
+			convey.So(resp.Raw.Header.Get("Age"), convey.ShouldEqual, "30")
+			convey.So(atomic.LoadInt32(&calls), convey.ShouldEqual, 1)
+
+			now = now.Add(31 * time.Second)
+			resp, _ = requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			convey.So(resp.CacheStatus, convey.ShouldEqual, CacheMiss)
+			convey.So(atomic.LoadInt32(&calls), convey.ShouldEqual, 2)
+		})
+
+		convey.Convey("Expires should be used when max-age is absent", func() {
+			requester, _ := newRequester(cacheUpstream(&calls, http.StatusOK,
+				header("Expires", now.Add(time.Minute).Format(http.TimeFormat)), "cached"))
+
+			_, _ = requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			resp, _ := requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			convey.So(resp.CacheStatus, convey.ShouldEqual, CacheHit)
+		})
+
+		convey.Convey("no-store response should not be cached", func() {
+			requester, _ := newRequester(cacheUpstream(&calls, http.StatusOK, header("Cache-Control", "no-store, max-age=60"), "secret"))
+
+			_, _ = requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			resp, _ := requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			convey.So(resp.CacheStatus, convey.ShouldEqual, CacheMiss)
+			convey.So(atomic.LoadInt32(&calls), convey.ShouldEqual, 2)
+		})
+
+		convey.Convey("Request no-store should bypass cache", func() {
+			requester, _ := newRequester(cacheUpstream(&calls, http.StatusOK, header("Cache-Control", "max-age=60"), "cached"))
+
+			_, _ = requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			resp, _ := requester.Get(ctx, "", "http://example.com/ref", http.Header{"Cache-Control": {"no-store"}})
+			convey.So(resp.CacheStatus, convey.ShouldEqual, CacheBypass)
+			convey.So(atomic.LoadInt32(&calls), convey.ShouldEqual, 2)
+		})
+
+		convey.Convey("Stale response with ETag should be revalidated", func() {
+			var ifNoneMatch string
+			requester, _ := newRequester(&mockClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					atomic.AddInt32(&calls, 1)
+					ifNoneMatch = req.Header.Get("If-None-Match")
+					if ifNoneMatch == `"v1"` {
+						return &http.Response{
+							StatusCode: http.StatusNotModified,
+							Header:     header("ETag", `"v1"`, "Cache-Control", "no-cache", "X-Refreshed", "yes"),
+							Body:       http.NoBody,
+						}, nil
+					}
+
+					return &http.Response{
+						Status:     "200 OK",
+						StatusCode: http.StatusOK,
+						Header:     header("ETag", `"v1"`, "Cache-Control", "no-cache"),
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte("v1 body"))),
+					}, nil
+				},
+			})
+
+			resp, _ := requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			convey.So(resp.CacheStatus, convey.ShouldEqual, CacheMiss)
+			convey.So(ifNoneMatch, convey.ShouldBeEmpty)
+
+			resp, err := requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(ifNoneMatch, convey.ShouldEqual, `"v1"`)
+			convey.So(resp.CacheStatus, convey.ShouldEqual, CacheRevalidated)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusOK)
+			convey.So(string(resp.RespBody), convey.ShouldEqual, "v1 body")
+			convey.So(resp.Raw.Header.Get("X-Refreshed"), convey.ShouldEqual, "yes")
+		})
+
+		convey.Convey("Last-Modified should be sent as If-Modified-Since", func() {
+			lastModified := now.Add(-time.Hour).Format(http.TimeFormat)
+			var ifModifiedSince string
+			requester, _ := newRequester(&mockClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					ifModifiedSince = req.Header.Get("If-Modified-Since")
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     header("Last-Modified", lastModified, "Cache-Control", "max-age=0"),
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte("body"))),
+					}, nil
+				},
+			})
+
+			_, _ = requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			_, _ = requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			convey.So(ifModifiedSince, convey.ShouldEqual, lastModified)
+		})
+
+		convey.Convey("Vary should separate responses by request header", func() {
+			requester, _ := newRequester(cacheUpstream(&calls, http.StatusOK, header("Cache-Control", "max-age=60", "Vary", "Accept-Language"), "hello"))
+
+			_, _ = requester.Get(ctx, "", "http://example.com/ref", http.Header{"Accept-Language": {"en"}})
+			resp, _ := requester.Get(ctx, "", "http://example.com/ref", http.Header{"Accept-Language": {"en"}})
+			convey.So(resp.CacheStatus, convey.ShouldEqual, CacheHit)
+
+			resp, _ = requester.Get(ctx, "", "http://example.com/ref", http.Header{"Accept-Language": {"id"}})
+			convey.So(resp.CacheStatus, convey.ShouldEqual, CacheMiss)
+		})
+
+		convey.Convey("stale-while-revalidate should serve stale and refresh in background", func() {
+			revalidated := make(chan struct{}, 1)
+			requester, _ := newRequester(&mockClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					if atomic.AddInt32(&calls, 1) > 1 {
+						defer func() { revalidated <- struct{}{} }()
+					}
+
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     header("Cache-Control", "max-age=10, stale-while-revalidate=60"),
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte("body"))),
+					}, nil
+				},
+			})
+
+			_, _ = requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			now = now.Add(30 * time.Second)
+
+			resp, _ := requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			convey.So(resp.CacheStatus, convey.ShouldEqual, CacheStale)
+			convey.So(string(resp.RespBody), convey.ShouldEqual, "body")
+
+			select {
+			case <-revalidated:
+			case <-time.After(time.Second):
+				t.Error("background revalidation is not called")
+			}
+			convey.So(atomic.LoadInt32(&calls), convey.ShouldEqual, 2)
+		})
+
+		convey.Convey("stale-if-error should serve stale when upstream fails", func() {
+			status := http.StatusOK
+			requester, _ := newRequester(&mockClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: status,
+						Header:     header("Cache-Control", "max-age=10, stale-if-error=60"),
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte("good"))),
+					}, nil
+				},
+			})
+
+			_, _ = requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			now = now.Add(30 * time.Second)
+			status = http.StatusServiceUnavailable
+
+			resp, err := requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(resp.CacheStatus, convey.ShouldEqual, CacheStale)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusOK)
+
+			now = now.Add(time.Minute)
+			resp, _ = requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusServiceUnavailable)
+		})
+
+		convey.Convey("Successful POST should invalidate cached GET", func() {
+			requester, _ := newRequester(cacheUpstream(&calls, http.StatusOK, header("Cache-Control", "max-age=60"), "body"))
+
+			_, _ = requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			resp, _ := requester.Post(ctx, "", "http://example.com/ref", http.Header{}, []byte(`{}`))
+			convey.So(resp.CacheStatus, convey.ShouldEqual, CacheBypass)
+
+			resp, _ = requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			convey.So(resp.CacheStatus, convey.ShouldEqual, CacheMiss)
+			convey.So(atomic.LoadInt32(&calls), convey.ShouldEqual, 3)
+		})
+
+		convey.Convey("Response should not be served to request with other credentials", func() {
+			upstream := &mockClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&calls, 1)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     header("Cache-Control", "max-age=60"),
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte("me: " + req.Header.Get("Authorization")))),
+				}, nil
+			}}
+			requester, _ := newRequester(upstream)
+
+			alice := http.Header{"Authorization": {"Bearer alice"}}
+			bob := http.Header{"Authorization": {"Bearer bob"}}
+			_, _ = requester.Get(ctx, "", "http://example.com/me", alice)
+
+			resp, _ := requester.Get(ctx, "", "http://example.com/me", bob)
+			convey.So(resp.CacheStatus, convey.ShouldEqual, CacheMiss)
+			convey.So(string(resp.RespBody), convey.ShouldEqual, "me: Bearer bob")
+
+			resp, _ = requester.Get(ctx, "", "http://example.com/me", http.Header{"Cookie": {"session=alice"}})
+			convey.So(resp.CacheStatus, convey.ShouldEqual, CacheMiss)
+
+			resp, _ = requester.Get(ctx, "", "http://example.com/me", alice)
+			convey.So(resp.CacheStatus, convey.ShouldEqual, CacheHit)
+			convey.So(string(resp.RespBody), convey.ShouldEqual, "me: Bearer alice")
+			convey.So(atomic.LoadInt32(&calls), convey.ShouldEqual, 3)
+		})
+
+		convey.Convey("Background revalidation should keep response limit", func() {
+			limits := make(chan int64, 2)
+			requester, _ := newRequester(&mockClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					limit, _ := maxResponseBytesFromContext(req.Context())
+					limits <- limit
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     header("Cache-Control", "max-age=10, stale-while-revalidate=60"),
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte("body"))),
+					}, nil
+				},
+			})
+
+			limited := ContextWithMaxResponseBytes(ctx, 64)
+			_, _ = requester.Get(limited, "", "http://example.com/ref", http.Header{})
+			now = now.Add(30 * time.Second)
+			_, _ = requester.Get(limited, "", "http://example.com/ref", http.Header{})
+
+			convey.So(<-limits, convey.ShouldEqual, 64)
+			select {
+			case limit := <-limits:
+				convey.So(limit, convey.ShouldEqual, 64)
+			case <-time.After(time.Second):
+				t.Error("background revalidation is not called")
+			}
+		})
+
+		convey.Convey("Request max-age=0 should not use fresh entry", func() {
+			requester, _ := newRequester(cacheUpstream(&calls, http.StatusOK, header("Cache-Control", "max-age=60"), "body"))
+
+			_, _ = requester.Get(ctx, "", "http://example.com/ref", http.Header{})
+			now = now.Add(time.Second)
+			resp, _ := requester.Get(ctx, "", "http://example.com/ref", http.Header{"Cache-Control": {"max-age=0"}})
+			convey.So(resp.CacheStatus, convey.ShouldEqual, CacheMiss)
+		})
+	})
+}
+
+func TestWithCache(t *testing.T) {
+	convey.Convey("Test WithCache", t, func() {
+		convey.Convey("Should return error when store is nil", func() {
+			client, err := DefaultClient(new(mockClient), WithCache(nil))
+			convey.So(client, convey.ShouldBeNil)
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Should wrap the client", func() {
+			client, err := DefaultClient(new(mockClient), WithCache(NewMemoryCacheStore(0)))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(client.client, convey.ShouldHaveSameTypeAs, &cacheClient{})
+		})
+	})
+}
+
+func TestParseCacheStatus(t *testing.T) {
+	convey.Convey("Cache-Status header", t, func() {
+		for _, status := range []CacheStatus{CacheHit, CacheMiss, CacheRevalidated, CacheStale, CacheBypass} {
+			header := http.Header{}
+			setCacheStatus(header, status)
+			convey.So(parseCacheStatus(header), convey.ShouldEqual, status)
+		}
+
+		convey.So(parseCacheStatus(http.Header{"Cache-Status": {"cdn; hit"}}), convey.ShouldEqual, CacheStatus(""))
+	})
+}
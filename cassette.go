@@ -0,0 +1,375 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrCassetteNoMatch returned by Cassette in replay mode when no recorded interaction matches the request
+var ErrCassetteNoMatch = errors.New("no recorded interaction matches the request")
+
+// defaultRedactHeaders are headers carrying credentials, they are redacted before traffic is saved.
+var defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// CassetteMode defines whether Cassette records, replays or passes through requests.
+type CassetteMode int
+
+const (
+	// CassetteReplay returns recorded responses without calling the real client.
+	CassetteReplay CassetteMode = iota
+	// CassetteRecord calls the real client and saves every interaction to the cassette file.
+	CassetteRecord
+	// CassettePassthrough calls the real client without recording.
+	CassettePassthrough
+)
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  CassetteRequest  `json:"request" yaml:"request"`
+	Response CassetteResponse `json:"response" yaml:"response"`
+}
+
+// CassetteRequest is the recorded request.
+type CassetteRequest struct {
+	Method string       `json:"method" yaml:"method"`
+	URL    string       `json:"url" yaml:"url"`
+	Header http.Header  `json:"header,omitempty" yaml:"header,omitempty"`
+	Body   CassetteBody `json:"body,omitempty" yaml:"body,omitempty"`
+}
+
+// CassetteResponse is the recorded response.
+type CassetteResponse struct {
+	StatusCode int          `json:"status_code" yaml:"status_code"`
+	Header     http.Header  `json:"header,omitempty" yaml:"header,omitempty"`
+	Body       CassetteBody `json:"body,omitempty" yaml:"body,omitempty"`
+}
+
+// CassetteBody is body saved as text, or base64 when it is not valid UTF-8.
+type CassetteBody struct {
+	Text   string `json:"text,omitempty" yaml:"text,omitempty"`
+	Base64 string `json:"base64,omitempty" yaml:"base64,omitempty"`
+}
+
+func newCassetteBody(data []byte) CassetteBody {
+	if utf8.Valid(data) {
+		return CassetteBody{Text: string(data)}
+	}
+
+	return CassetteBody{Base64: base64.StdEncoding.EncodeToString(data)}
+}
+
+// Bytes returns the body as recorded.
+func (b CassetteBody) Bytes() []byte {
+	if b.Base64 != "" {
+		data, _ := base64.StdEncoding.DecodeString(b.Base64)
+		return data
+	}
+
+	return []byte(b.Text)
+}
+
+// CassetteMatcher reports whether request with body matches the recorded request.
+type CassetteMatcher func(request *http.Request, body []byte, recorded CassetteRequest) bool
+
+// MatchMethod matches request method.
+func MatchMethod() CassetteMatcher {
+	return func(request *http.Request, _ []byte, recorded CassetteRequest) bool {
+		return request.Method == recorded.Method
+	}
+}
+
+// MatchURL matches the full request URL.
+func MatchURL() CassetteMatcher {
+	return func(request *http.Request, _ []byte, recorded CassetteRequest) bool {
+		return request.URL.String() == recorded.URL
+	}
+}
+
+// MatchBody matches request body byte by byte.
+func MatchBody() CassetteMatcher {
+	return func(_ *http.Request, body []byte, recorded CassetteRequest) bool {
+		return bytes.Equal(body, recorded.Body.Bytes())
+	}
+}
+
+// MatchHeaders matches values of the given headers.
+func MatchHeaders(names ...string) CassetteMatcher {
+	return func(request *http.Request, _ []byte, recorded CassetteRequest) bool {
+		for _, name := range names {
+			if strings.Join(request.Header.Values(name), ",") != strings.Join(recorded.Header.Values(name), ",") {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// CassetteConfig configures Cassette.
+type CassetteConfig struct {
+	// Path of cassette file, YAML when it ends with ".yaml" or ".yml", JSON otherwise.
+	Path string
+	Mode CassetteMode
+	// Client calls the real service in record and passthrough mode, default http.DefaultClient.
+	Client HttpClient
+	// Matchers default MatchMethod and MatchURL.
+	Matchers []CassetteMatcher
+	// RedactHeaders are replaced with "REDACTED" before saving,
+	// default Authorization, Proxy-Authorization, Cookie and Set-Cookie.
+	RedactHeaders []string
+	// Redact modifies interaction before saving, e.g. to remove secret in body.
+	Redact func(interaction *Interaction)
+}
+
+// Cassette is HttpClient that records interactions to a file and replays them in tests.
+// In replay mode, each recorded interaction is used once in the recorded order,
+// so identical requests get their responses in the same order as they were recorded.
+type Cassette struct {
+	conf CassetteConfig
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+var _ HttpClient = &Cassette{}
+
+// NewCassette returns Cassette, the cassette file is loaded in replay mode.
+func NewCassette(conf CassetteConfig) (*Cassette, error) {
+	if conf.Path == "" && conf.Mode != CassettePassthrough {
+		return nil, errors.New("cassette path is empty")
+	}
+
+	if conf.Client == nil {
+		conf.Client = http.DefaultClient
+	}
+
+	if conf.Matchers == nil {
+		conf.Matchers = []CassetteMatcher{MatchMethod(), MatchURL()}
+	}
+
+	if conf.RedactHeaders == nil {
+		conf.RedactHeaders = defaultRedactHeaders
+	}
+
+	cassette := &Cassette{conf: conf}
+	if conf.Mode != CassetteReplay {
+		return cassette, nil
+	}
+
+	data, err := os.ReadFile(conf.Path)
+	if err != nil {
+		return nil, fmt.Errorf("fail read cassette: %s", err.Error())
+	}
+
+	if cassette.isYAML() {
+		err = yaml.Unmarshal(data, &cassette.interactions)
+	} else {
+		err = json.Unmarshal(data, &cassette.interactions)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("fail parse cassette %s: %s", conf.Path, err.Error())
+	}
+
+	cassette.used = make([]bool, len(cassette.interactions))
+	return cassette, nil
+}
+
+// Interactions returns the recorded or loaded interactions.
+func (c *Cassette) Interactions() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Interaction(nil), c.interactions...)
+}
+
+// Do replays, records or passes through request according to the mode.
+func (c *Cassette) Do(request *http.Request) (*http.Response, error) {
+	switch c.conf.Mode {
+	case CassettePassthrough:
+		return c.conf.Client.Do(request)
+	case CassetteRecord:
+		return c.record(request)
+	default:
+		return c.replay(request)
+	}
+}
+
+func (c *Cassette) replay(request *http.Request) (*http.Response, error) {
+	body, err := drainBody(request)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, interaction := range c.interactions {
+		if c.used[i] || !c.matches(request, body, interaction.Request) {
+			continue
+		}
+
+		c.used[i] = true
+		return interaction.Response.response(request), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s %s", ErrCassetteNoMatch, request.Method, request.URL.String())
+}
+
+func (c *Cassette) matches(request *http.Request, body []byte, recorded CassetteRequest) bool {
+	for _, match := range c.conf.Matchers {
+		if !match(request, body, recorded) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *Cassette) record(request *http.Request) (*http.Response, error) {
+	requestBody, err := drainBody(request)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Body = ioutil.NopCloser(bytes.NewReader(requestBody))
+	resp, err := c.conf.Client.Do(request)
+	if err != nil {
+		return resp, err
+	}
+
+	responseBody, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("fail read response to record: %s", err.Error())
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+
+	interaction := Interaction{
+		Request: CassetteRequest{
+			Method: request.Method,
+			URL:    request.URL.String(),
+			Header: request.Header.Clone(),
+			Body:   newCassetteBody(requestBody),
+		},
+		Response: CassetteResponse{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header.Clone(),
+			Body:       newCassetteBody(responseBody),
+		},
+	}
+	c.redact(&interaction)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interactions = append(c.interactions, interaction)
+	if err := c.save(); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (c *Cassette) redact(interaction *Interaction) {
+	for _, header := range []http.Header{interaction.Request.Header, interaction.Response.Header} {
+		for _, name := range c.conf.RedactHeaders {
+			if header.Get(name) != "" {
+				header.Set(name, "REDACTED")
+			}
+		}
+	}
+
+	if c.conf.Redact != nil {
+		c.conf.Redact(interaction)
+	}
+}
+
+// save writes every interaction to the cassette file atomically.
+func (c *Cassette) save() error {
+	var (
+		data []byte
+		err  error
+	)
+
+	if c.isYAML() {
+		data, err = yaml.Marshal(c.interactions)
+	} else {
+		data, err = json.MarshalIndent(c.interactions, "", "  ")
+	}
+
+	if err != nil {
+		return fmt.Errorf("fail encode cassette: %s", err.Error())
+	}
+
+	if err := writeFileAtomic(c.conf.Path, data); err != nil {
+		return fmt.Errorf("fail save cassette: %s", err.Error())
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it to path,
+// so readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (c *Cassette) isYAML() bool {
+	ext := strings.ToLower(filepath.Ext(c.conf.Path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+func (r CassetteResponse) response(request *http.Request) *http.Response {
+	return NewResponse(request, r.StatusCode, r.Header.Clone(), r.Body.Bytes())
+}
+
+// drainBody reads and closes request body.
+func drainBody(request *http.Request) ([]byte, error) {
+	if request.Body == nil {
+		return nil, nil
+	}
+
+	defer request.Body.Close()
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("fail read request body: %s", err.Error())
+	}
+
+	return body, nil
+}
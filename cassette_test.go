@@ -0,0 +1,141 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestCassette(t *testing.T) {
+	convey.Convey("Test Cassette", t, func() {
+		ctx := context.Background()
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&calls, 1)
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Header().Set("Set-Cookie", "session=secret")
+			if r.URL.Path == "/binary" {
+				_, _ = w.Write([]byte{0xff, 0x00, 0xfe})
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"call": %d, "body": %q, "token": "t0ken"}`, n, body)
+		}))
+		defer server.Close()
+
+		dir, _ := os.MkdirTemp("", "cassette")
+		defer os.RemoveAll(dir)
+
+		for _, name := range []string{"fixtures/partner.yaml", "fixtures/partner.json"} {
+			path := filepath.Join(dir, name)
+
+			convey.Convey("Should record and replay "+filepath.Ext(name), func() {
+				recorder, err := NewCassette(CassetteConfig{
+					Path: path,
+					Mode: CassetteRecord,
+					Redact: func(interaction *Interaction) {
+						interaction.Response.Body.Text = strings.ReplaceAll(interaction.Response.Body.Text, "t0ken", "REDACTED")
+					},
+				})
+				convey.So(err, convey.ShouldBeNil)
+
+				client, _ := DefaultClient(recorder)
+				header := http.Header{"Authorization": {"Bearer secret"}}
+				first, err := client.Post(ctx, "", server.URL+"/orders", header, []byte(`{"id": 1}`))
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(string(first.RespBody), convey.ShouldContainSubstring, `"token": "t0ken"`)
+
+				_, _ = client.Post(ctx, "", server.URL+"/orders", header, []byte(`{"id": 2}`))
+				_, _ = client.Get(ctx, "", server.URL+"/binary", http.Header{})
+				convey.So(len(recorder.Interactions()), convey.ShouldEqual, 3)
+
+				saved, _ := os.ReadFile(path)
+				convey.So(string(saved), convey.ShouldNotContainSubstring, "secret")
+				convey.So(string(saved), convey.ShouldNotContainSubstring, "t0ken")
+
+				player, err := NewCassette(CassetteConfig{Path: path})
+				convey.So(err, convey.ShouldBeNil)
+
+				client, _ = DefaultClient(player)
+				server.Close()
+
+				replayed, err := client.Post(ctx, "", server.URL+"/orders", http.Header{}, []byte(`{"id": 1}`))
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(replayed.Raw.StatusCode, convey.ShouldEqual, http.StatusOK)
+				convey.So(string(replayed.RespBody), convey.ShouldEqual, `{"call": 1, "body": "{\"id\": 1}", "token": "REDACTED"}`)
+				convey.So(replayed.Raw.Header.Get("Set-Cookie"), convey.ShouldEqual, "REDACTED")
+
+				replayed, _ = client.Post(ctx, "", server.URL+"/orders", http.Header{}, nil)
+				convey.So(string(replayed.RespBody), convey.ShouldContainSubstring, `"call": 2`)
+
+				binary, _ := client.Get(ctx, "", server.URL+"/binary", http.Header{})
+				convey.So(binary.RespBody, convey.ShouldResemble, []byte{0xff, 0x00, 0xfe})
+
+				_, err = player.Do(mustNewRequest(http.MethodPost, server.URL+"/orders"))
+				convey.So(errors.Is(err, ErrCassetteNoMatch), convey.ShouldBeTrue)
+			})
+		}
+
+		convey.Convey("Should match body and headers", func() {
+			path := filepath.Join(dir, "match.json")
+			recorder, _ := NewCassette(CassetteConfig{Path: path, Mode: CassetteRecord})
+			client, _ := DefaultClient(recorder)
+			_, _ = client.Post(ctx, "", server.URL+"/a", http.Header{"X-Tenant": {"a"}}, []byte(`1`))
+			_, _ = client.Post(ctx, "", server.URL+"/a", http.Header{"X-Tenant": {"b"}}, []byte(`2`))
+
+			player, _ := NewCassette(CassetteConfig{
+				Path:     path,
+				Matchers: []CassetteMatcher{MatchMethod(), MatchURL(), MatchBody(), MatchHeaders("X-Tenant")},
+			})
+			client, _ = DefaultClient(player)
+
+			resp, err := client.Post(ctx, "", server.URL+"/a", http.Header{"X-Tenant": {"b"}}, []byte(`2`))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(string(resp.RespBody), convey.ShouldContainSubstring, `"body": "2"`)
+
+			_, err = client.Post(ctx, "", server.URL+"/a", http.Header{"X-Tenant": {"b"}}, []byte(`1`))
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Should pass through without recording", func() {
+			passthrough, err := NewCassette(CassetteConfig{Mode: CassettePassthrough})
+			convey.So(err, convey.ShouldBeNil)
+
+			resp, err := passthrough.Do(mustNewRequest(http.MethodGet, server.URL))
+			convey.So(err, convey.ShouldBeNil)
+			_ = resp.Body.Close()
+			convey.So(passthrough.Interactions(), convey.ShouldBeEmpty)
+		})
+
+		convey.Convey("Should return error for missing or invalid cassette", func() {
+			_, err := NewCassette(CassetteConfig{})
+			convey.So(err, convey.ShouldNotBeNil)
+
+			_, err = NewCassette(CassetteConfig{Path: filepath.Join(dir, "missing.yaml")})
+			convey.So(err, convey.ShouldNotBeNil)
+
+			invalid := filepath.Join(dir, "invalid.json")
+			_ = os.WriteFile(invalid, []byte(`{`), 0o644)
+			_, err = NewCassette(CassetteConfig{Path: invalid})
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
+
+func mustNewRequest(method, url string) *http.Request {
+	request, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return request
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sony/gobreaker"
@@ -20,6 +21,25 @@ const (
 	StateOpen
 )
 
+// String returns the human readable name of the state.
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	default:
+		return fmt.Sprintf("unknown state: %d", s)
+	}
+}
+
+// MarshalText encodes state as its name, so it is readable in JSON.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
 type ReadyToTripFunc func(Counts) bool
 type OnStateChangeFunc func(name string, from State, to State)
 
@@ -31,7 +51,9 @@ type OnStateChangeFunc func(name string, from State, to State)
 // when the CircuitBreaker is half-open.
 // If MaxRequests is 0, the CircuitBreaker allows only 1 request.
 //
-// Interval is the cyclic period of the closed state
+// IsActive enables the CircuitBreaker, only requests to one of Paths go through the CircuitBreaker.
+//
+// Interval (IntervalTimeout) is the cyclic period of the closed state
 // for the CircuitBreaker to clear the internal Counts.
 // If Interval is 0, the CircuitBreaker doesn't clear internal Counts during the closed state.
 //
@@ -42,19 +64,20 @@ type OnStateChangeFunc func(name string, from State, to State)
 // ReadyToTrip is called with a copy of Counts whenever a request fails in the closed state.
 // If ReadyToTrip returns true, the CircuitBreaker will be placed into the open state.
 // If ReadyToTrip is nil, default ReadyToTrip is used.
-// Default ReadyToTrip returns true when the number of consecutive failures is more than 5.
+// Default ReadyToTrip returns true when the number of consecutive failures reaches Threshold,
+// or is more than 5 when Threshold is 0.
 //
 // OnStateChange is called whenever the state of the CircuitBreaker changes.
 type CBConfig struct {
-	Name            string
-	IsActive        bool
-	Timeout         int
-	IntervalTimeout int
-	Threshold       int
-	Paths           []string
-	MaxRequests     uint32
-	ReadyToTrip     ReadyToTripFunc
-	OnStateChange   OnStateChangeFunc
+	Name            string            `json:"name" yaml:"name"`
+	IsActive        bool              `json:"is_active" yaml:"is_active"`
+	Timeout         Duration          `json:"timeout" yaml:"timeout"`
+	IntervalTimeout Duration          `json:"interval_timeout" yaml:"interval_timeout"`
+	Threshold       int               `json:"threshold" yaml:"threshold"`
+	Paths           []string          `json:"paths" yaml:"paths"`
+	MaxRequests     uint32            `json:"max_requests" yaml:"max_requests"`
+	ReadyToTrip     ReadyToTripFunc   `json:"-" yaml:"-"`
+	OnStateChange   OnStateChangeFunc `json:"-" yaml:"-"`
 }
 
 // Counts holds the numbers of requests and their successes/failures.
@@ -63,20 +86,39 @@ type CBConfig struct {
 // Counts ignores the results of the requests sent before clearing.
 // This copies from gobreaker.Counts so that user don't need to know the external lib.
 type Counts struct {
-	Requests             uint32
-	TotalSuccesses       uint32
-	TotalFailures        uint32
-	ConsecutiveSuccesses uint32
-	ConsecutiveFailures  uint32
+	Requests             uint32 `json:"requests"`
+	TotalSuccesses       uint32 `json:"total_successes"`
+	TotalFailures        uint32 `json:"total_failures"`
+	ConsecutiveSuccesses uint32 `json:"consecutive_successes"`
+	ConsecutiveFailures  uint32 `json:"consecutive_failures"`
 }
 
 type circuitBreaker struct {
 	client         HttpClient
 	useBreaker     bool
-	breaker        *gobreaker.CircuitBreaker
 	whitelistPaths []string
+
+	mu             sync.RWMutex
+	breaker        *gobreaker.CircuitBreaker
+	settings       gobreaker.Settings
+	stateListener  OnStateChangeFunc
+	forced         forcedState
+	lastTransition time.Time
+
+	// forceMu serializes force, so from and to states of concurrent calls don't interleave.
+	// It is separate from mu, since reading gobreaker state may lock mu in OnStateChange.
+	forceMu sync.Mutex
 }
 
+// forcedState is the manual override set through ForceOpenBreaker or ForceCloseBreaker.
+type forcedState int
+
+const (
+	forcedNone forcedState = iota
+	forcedOpen
+	forcedClosed
+)
+
 // readyToTrip wraps gobreaker.ReadyToTrip function
 var readyToTrip = func(setting ReadyToTripFunc) func(gobreaker.Counts) bool {
 	if setting == nil {
@@ -101,30 +143,19 @@ var onStateChange = func(stateListener OnStateChangeFunc) func(name string, from
 	}
 
 	return func(name string, from gobreaker.State, to gobreaker.State) {
-		var (
-			internalFrom State
-			internalTo   State
-		)
-
-		switch from {
-		case gobreaker.StateClosed:
-			internalFrom = StateClosed
-		case gobreaker.StateHalfOpen:
-			internalFrom = StateHalfOpen
-		case gobreaker.StateOpen:
-			internalFrom = StateOpen
-		}
-
-		switch to {
-		case gobreaker.StateClosed:
-			internalTo = StateClosed
-		case gobreaker.StateHalfOpen:
-			internalTo = StateHalfOpen
-		case gobreaker.StateOpen:
-			internalTo = StateOpen
-		}
+		stateListener(name, fromGobreakerState(from), fromGobreakerState(to))
+	}
+}
 
-		stateListener(name, internalFrom, internalTo)
+// fromGobreakerState maps gobreaker.State to State
+func fromGobreakerState(state gobreaker.State) State {
+	switch state {
+	case gobreaker.StateHalfOpen:
+		return StateHalfOpen
+	case gobreaker.StateOpen:
+		return StateOpen
+	default:
+		return StateClosed
 	}
 }
 
@@ -133,21 +164,55 @@ func newCircuitBreaker(conf CBConfig, client HttpClient) *circuitBreaker {
 	cb.client = client
 	cb.useBreaker = conf.IsActive
 	cb.whitelistPaths = conf.Paths
-	cb.breaker = gobreaker.NewCircuitBreaker(gobreaker.Settings{
-		Name:          conf.Name,
-		MaxRequests:   conf.MaxRequests,
-		Interval:      time.Duration(conf.IntervalTimeout) * time.Second,
-		Timeout:       time.Duration(conf.Timeout) * time.Second,
-		ReadyToTrip:   readyToTrip(conf.ReadyToTrip),
-		OnStateChange: onStateChange(conf.OnStateChange),
-	})
+	cb.stateListener = conf.OnStateChange
+	cb.lastTransition = time.Now()
+
+	if conf.ReadyToTrip == nil && conf.Threshold > 0 {
+		conf.ReadyToTrip = func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= uint32(conf.Threshold)
+		}
+	}
+
+	listener := onStateChange(conf.OnStateChange)
+	cb.settings = gobreaker.Settings{
+		Name:        conf.Name,
+		MaxRequests: conf.MaxRequests,
+		Interval:    conf.IntervalTimeout.Std(),
+		Timeout:     conf.Timeout.Std(),
+		ReadyToTrip: readyToTrip(conf.ReadyToTrip),
+		OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
+			// gobreaker calls this while holding its own lock, never hold cb.mu here.
+			cb.markTransition()
+			if listener != nil {
+				listener(name, from, to)
+			}
+		},
+	}
+	cb.breaker = gobreaker.NewCircuitBreaker(cb.settings)
 
 	return cb
 }
 
+// Close removes the circuit breaker from the registry, unless another one has replaced it.
+func (cb *circuitBreaker) Close() error {
+	unregisterBreaker(cb)
+	return nil
+}
+
 func (cb *circuitBreaker) Do(request *http.Request) (*http.Response, error) {
 	if cb.useBreaker && cb.pathInWhitelist(request.URL.String()) {
-		cbResp, err := cb.breaker.Execute(func() (interface{}, error) {
+		cb.mu.RLock()
+		breaker, forced := cb.breaker, cb.forced
+		cb.mu.RUnlock()
+
+		switch forced {
+		case forcedOpen:
+			return nil, ErrBreakerForcedOpen
+		case forcedClosed:
+			return cb.client.Do(request)
+		}
+
+		cbResp, err := breaker.Execute(func() (interface{}, error) {
 			resp, err := cb.client.Do(request) // resp should be nil when err not nil
 			if err != nil {
 				// https://github.com/golang/go/blob/2d77d3330537e11a0d9a233ba5f4facf262e9d8c/src/net/http/client.go#L724
@@ -194,3 +259,69 @@ func (cb *circuitBreaker) pathInWhitelist(path string) bool {
 
 	return false
 }
+
+// markTransition records the time of the latest state change.
+func (cb *circuitBreaker) markTransition() {
+	cb.mu.Lock()
+	cb.lastTransition = time.Now()
+	cb.mu.Unlock()
+}
+
+// info returns a snapshot of the current breaker state.
+func (cb *circuitBreaker) info() BreakerInfo {
+	cb.mu.RLock()
+	breaker, forced := cb.breaker, cb.forced
+	cb.mu.RUnlock()
+
+	// breaker.State may trigger OnStateChange which locks cb.mu, so it must be called without holding it.
+	state := fromGobreakerState(breaker.State())
+	switch forced {
+	case forcedOpen:
+		state = StateOpen
+	case forcedClosed:
+		state = StateClosed
+	}
+
+	counts := breaker.Counts()
+
+	cb.mu.RLock()
+	lastTransition := cb.lastTransition
+	cb.mu.RUnlock()
+
+	return BreakerInfo{
+		Name:     cb.settings.Name,
+		IsActive: cb.useBreaker,
+		State:    state,
+		Forced:   forced != forcedNone,
+		Counts: Counts{
+			Requests:             counts.Requests,
+			TotalSuccesses:       counts.TotalSuccesses,
+			TotalFailures:        counts.TotalFailures,
+			ConsecutiveSuccesses: counts.ConsecutiveSuccesses,
+			ConsecutiveFailures:  counts.ConsecutiveFailures,
+		},
+		LastTransition: lastTransition,
+	}
+}
+
+// force sets the manual override, and notify OnStateChange if the visible state is changed.
+func (cb *circuitBreaker) force(forced forcedState) {
+	cb.forceMu.Lock()
+	from := cb.info().State
+
+	cb.mu.Lock()
+	cb.forced = forced
+	if forced == forcedNone {
+		// start again from clean closed state, with the same settings
+		cb.breaker = gobreaker.NewCircuitBreaker(cb.settings)
+	}
+	cb.lastTransition = time.Now()
+	cb.mu.Unlock()
+
+	to := cb.info().State
+	cb.forceMu.Unlock()
+
+	if from != to && cb.stateListener != nil {
+		cb.stateListener(cb.settings.Name, from, to)
+	}
+}
@@ -0,0 +1,191 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BreakerInfo is a snapshot of circuit breaker state at the time it is requested.
+type BreakerInfo struct {
+	Name           string    `json:"name"`
+	IsActive       bool      `json:"is_active"`
+	State          State     `json:"state"`
+	Forced         bool      `json:"forced"` // true when state is manually forced open or closed
+	Counts         Counts    `json:"counts"`
+	LastTransition time.Time `json:"last_transition"`
+}
+
+// breakers holds named circuit breakers created using WithCircuitBreaker.
+// When two breakers use the same name, the latest one replaces the previous one,
+// so a process holds at most one breaker per name. Close removes it.
+var breakers = struct {
+	sync.RWMutex
+	items map[string]*circuitBreaker
+}{
+	items: make(map[string]*circuitBreaker),
+}
+
+func registerBreaker(cb *circuitBreaker) {
+	if cb.settings.Name == "" {
+		return
+	}
+
+	breakers.Lock()
+	breakers.items[cb.settings.Name] = cb
+	breakers.Unlock()
+}
+
+func unregisterBreaker(cb *circuitBreaker) {
+	breakers.Lock()
+	defer breakers.Unlock()
+
+	if breakers.items[cb.settings.Name] == cb {
+		delete(breakers.items, cb.settings.Name)
+	}
+}
+
+func lookupBreaker(name string) (*circuitBreaker, error) {
+	breakers.RLock()
+	cb, ok := breakers.items[name]
+	breakers.RUnlock()
+
+	if !ok {
+		return nil, ErrBreakerNotFound
+	}
+
+	return cb, nil
+}
+
+// Breakers returns snapshot of all named circuit breakers sorted by name.
+func Breakers() []BreakerInfo {
+	breakers.RLock()
+	list := make([]*circuitBreaker, 0, len(breakers.items))
+	for _, cb := range breakers.items {
+		list = append(list, cb)
+	}
+	breakers.RUnlock()
+
+	infos := make([]BreakerInfo, 0, len(list))
+	for _, cb := range list {
+		infos = append(infos, cb.info())
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	return infos
+}
+
+// Breaker returns snapshot of circuit breaker with the given name.
+func Breaker(name string) (BreakerInfo, error) {
+	cb, err := lookupBreaker(name)
+	if err != nil {
+		return BreakerInfo{}, err
+	}
+
+	return cb.info(), nil
+}
+
+// ForceOpenBreaker rejects all requests with ErrBreakerForcedOpen until it is reset.
+func ForceOpenBreaker(name string) error {
+	cb, err := lookupBreaker(name)
+	if err != nil {
+		return err
+	}
+
+	cb.force(forcedOpen)
+	return nil
+}
+
+// ForceCloseBreaker lets all requests pass without being counted until it is reset.
+func ForceCloseBreaker(name string) error {
+	cb, err := lookupBreaker(name)
+	if err != nil {
+		return err
+	}
+
+	cb.force(forcedClosed)
+	return nil
+}
+
+// ResetBreaker removes forced state and clears the counts, the breaker starts again in closed state.
+func ResetBreaker(name string) error {
+	cb, err := lookupBreaker(name)
+	if err != nil {
+		return err
+	}
+
+	cb.force(forcedNone)
+	return nil
+}
+
+// BreakerHandler returns http.Handler to read and manage circuit breakers as JSON:
+//
+//	GET  /                          list all circuit breakers
+//	GET  /?name=payment             get circuit breaker named payment
+//	POST /?name=payment&action=open force open (other actions: close, reset)
+//
+// The handler has no authentication, anyone who can reach it can stop outgoing requests.
+// Serve it on an internal admin port or wrap it with your own authentication middleware.
+func BreakerHandler() http.Handler {
+	return http.HandlerFunc(serveBreaker)
+}
+
+func serveBreaker(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+
+	switch r.Method {
+	case http.MethodGet:
+		if name == "" {
+			writeBreakerJSON(w, http.StatusOK, Breakers())
+			return
+		}
+
+	case http.MethodPost:
+		var actions = map[string]func(string) error{
+			"open":  ForceOpenBreaker,
+			"close": ForceCloseBreaker,
+			"reset": ResetBreaker,
+		}
+
+		action, ok := actions[r.URL.Query().Get("action")]
+		if !ok {
+			writeBreakerError(w, http.StatusBadRequest, "action must be one of open, close or reset")
+			return
+		}
+
+		if err := action(name); err != nil {
+			writeBreakerError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeBreakerError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	info, err := Breaker(name)
+	if err != nil {
+		writeBreakerError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	writeBreakerJSON(w, http.StatusOK, info)
+}
+
+func writeBreakerError(w http.ResponseWriter, status int, msg string) {
+	writeBreakerJSON(w, status, map[string]string{
+		"error": msg,
+	})
+}
+
+func writeBreakerJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
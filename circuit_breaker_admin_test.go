@@ -0,0 +1,273 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestBreakerIntrospection(t *testing.T) {
+	convey.Convey("Circuit breaker introspection", t, func() {
+		request := &http.Request{}
+		request.URL = &url.URL{
+			Path: "/",
+		}
+
+		testClient := &mockClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusInternalServerError,
+				}, nil
+			},
+		}
+
+		var transitions []State
+		cb := newCircuitBreaker(CBConfig{
+			Name:     "test-introspection",
+			IsActive: true,
+			Paths:    []string{"/"},
+			ReadyToTrip: func(counts Counts) bool {
+				return counts.ConsecutiveFailures >= 2
+			},
+			OnStateChange: func(name string, from State, to State) {
+				transitions = append(transitions, to)
+			},
+		}, testClient)
+		registerBreaker(cb)
+
+		convey.Convey("Should return counts and state after requests", func() {
+			_, _ = cb.Do(request)
+
+			info, err := Breaker("test-introspection")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(info.State, convey.ShouldEqual, StateClosed)
+			convey.So(info.Counts.Requests, convey.ShouldEqual, uint32(1))
+			convey.So(info.Counts.ConsecutiveFailures, convey.ShouldEqual, uint32(1))
+
+			_, _ = cb.Do(request)
+
+			info, err = Breaker("test-introspection")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(info.State, convey.ShouldEqual, StateOpen)
+			convey.So(info.LastTransition.IsZero(), convey.ShouldBeFalse)
+			convey.So(transitions, convey.ShouldResemble, []State{StateOpen})
+		})
+
+		convey.Convey("Should be listed in Breakers", func() {
+			var found bool
+			for _, info := range Breakers() {
+				if info.Name == "test-introspection" {
+					found = true
+				}
+			}
+
+			convey.So(found, convey.ShouldBeTrue)
+		})
+
+		convey.Convey("Force open should reject request without calling client", func() {
+			called := false
+			testClient.DoFunc = func(req *http.Request) (*http.Response, error) {
+				called = true
+				return &http.Response{StatusCode: http.StatusOK}, nil
+			}
+
+			convey.So(ForceOpenBreaker("test-introspection"), convey.ShouldBeNil)
+
+			resp, err := cb.Do(request)
+			convey.So(resp, convey.ShouldBeNil)
+			convey.So(err, convey.ShouldEqual, ErrBreakerForcedOpen)
+			convey.So(called, convey.ShouldBeFalse)
+
+			info, _ := Breaker("test-introspection")
+			convey.So(info.State, convey.ShouldEqual, StateOpen)
+			convey.So(info.Forced, convey.ShouldBeTrue)
+			convey.So(transitions, convey.ShouldResemble, []State{StateOpen})
+		})
+
+		convey.Convey("Force close should pass request even when failing", func() {
+			convey.So(ForceCloseBreaker("test-introspection"), convey.ShouldBeNil)
+
+			for i := 0; i < 5; i++ {
+				resp, err := cb.Do(request)
+				convey.So(resp, convey.ShouldNotBeNil)
+				convey.So(err, convey.ShouldBeNil)
+			}
+
+			info, _ := Breaker("test-introspection")
+			convey.So(info.State, convey.ShouldEqual, StateClosed)
+			convey.So(info.Forced, convey.ShouldBeTrue)
+		})
+
+		convey.Convey("Reset should clear forced state and counts", func() {
+			convey.So(ForceOpenBreaker("test-introspection"), convey.ShouldBeNil)
+			convey.So(ResetBreaker("test-introspection"), convey.ShouldBeNil)
+
+			info, _ := Breaker("test-introspection")
+			convey.So(info.State, convey.ShouldEqual, StateClosed)
+			convey.So(info.Forced, convey.ShouldBeFalse)
+			convey.So(info.Counts, convey.ShouldResemble, Counts{})
+			convey.So(transitions, convey.ShouldResemble, []State{StateOpen, StateClosed})
+		})
+
+		convey.Convey("Unknown name should return ErrBreakerNotFound", func() {
+			_, err := Breaker("unknown")
+			convey.So(err, convey.ShouldEqual, ErrBreakerNotFound)
+			convey.So(ForceOpenBreaker("unknown"), convey.ShouldEqual, ErrBreakerNotFound)
+			convey.So(ForceCloseBreaker("unknown"), convey.ShouldEqual, ErrBreakerNotFound)
+			convey.So(ResetBreaker("unknown"), convey.ShouldEqual, ErrBreakerNotFound)
+		})
+
+		convey.Reset(func() {
+			_ = cb.Close()
+		})
+	})
+}
+
+func TestBreakerHandler(t *testing.T) {
+	convey.Convey("Circuit breaker http handler", t, func() {
+		cb := newCircuitBreaker(CBConfig{
+			Name:     "test-handler",
+			IsActive: true,
+		}, new(mockClient))
+		registerBreaker(cb)
+		convey.Reset(func() {
+			_ = cb.Close()
+		})
+
+		serve := func(method, target string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			BreakerHandler().ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+			return rec
+		}
+
+		convey.Convey("GET without name should list breakers", func() {
+			rec := serve(http.MethodGet, "/")
+			convey.So(rec.Code, convey.ShouldEqual, http.StatusOK)
+
+			var infos []map[string]interface{}
+			convey.So(json.Unmarshal(rec.Body.Bytes(), &infos), convey.ShouldBeNil)
+			convey.So(len(infos), convey.ShouldBeGreaterThan, 0)
+		})
+
+		convey.Convey("GET with name should return the breaker", func() {
+			rec := serve(http.MethodGet, "/?name=test-handler")
+			convey.So(rec.Code, convey.ShouldEqual, http.StatusOK)
+
+			var info map[string]interface{}
+			convey.So(json.Unmarshal(rec.Body.Bytes(), &info), convey.ShouldBeNil)
+			convey.So(info["name"], convey.ShouldEqual, "test-handler")
+			convey.So(info["state"], convey.ShouldEqual, "closed")
+		})
+
+		convey.Convey("POST open should force open the breaker", func() {
+			rec := serve(http.MethodPost, "/?name=test-handler&action=open")
+			convey.So(rec.Code, convey.ShouldEqual, http.StatusOK)
+
+			var info map[string]interface{}
+			convey.So(json.Unmarshal(rec.Body.Bytes(), &info), convey.ShouldBeNil)
+			convey.So(info["state"], convey.ShouldEqual, "open")
+			convey.So(info["forced"], convey.ShouldEqual, true)
+
+			rec = serve(http.MethodPost, "/?name=test-handler&action=reset")
+			convey.So(rec.Code, convey.ShouldEqual, http.StatusOK)
+		})
+
+		convey.Convey("Unknown name should return 404", func() {
+			convey.So(serve(http.MethodGet, "/?name=unknown").Code, convey.ShouldEqual, http.StatusNotFound)
+			convey.So(serve(http.MethodPost, "/?name=unknown&action=open").Code, convey.ShouldEqual, http.StatusNotFound)
+		})
+
+		convey.Convey("Unknown action should return 400", func() {
+			convey.So(serve(http.MethodPost, "/?name=test-handler&action=explode").Code, convey.ShouldEqual, http.StatusBadRequest)
+		})
+
+		convey.Convey("Other method should return 405", func() {
+			convey.So(serve(http.MethodDelete, "/").Code, convey.ShouldEqual, http.StatusMethodNotAllowed)
+		})
+	})
+}
+
+func TestBreakerRegistry(t *testing.T) {
+	convey.Convey("Circuit breaker registry", t, func() {
+		conf := CBConfig{Name: "test-registry", Timeout: Duration(time.Second)}
+		first, err := DefaultClient(new(mockClient), WithCircuitBreaker(conf))
+		convey.So(err, convey.ShouldBeNil)
+
+		convey.Convey("Should let the latest breaker with the same name win", func() {
+			second, err := DefaultClient(new(mockClient), WithCircuitBreaker(conf))
+			convey.So(err, convey.ShouldBeNil)
+
+			convey.So(ForceOpenBreaker("test-registry"), convey.ShouldBeNil)
+			convey.So(second.client.(*circuitBreaker).info().Forced, convey.ShouldBeTrue)
+			convey.So(first.client.(*circuitBreaker).info().Forced, convey.ShouldBeFalse)
+
+			convey.So(first.Close(), convey.ShouldBeNil)
+			_, err = Breaker("test-registry")
+			convey.So(err, convey.ShouldBeNil)
+
+			convey.So(second.Close(), convey.ShouldBeNil)
+			_, err = Breaker("test-registry")
+			convey.So(err, convey.ShouldEqual, ErrBreakerNotFound)
+		})
+
+		convey.Convey("Should report forced transitions in order", func() {
+			var mu sync.Mutex
+			var transitions []State
+			cb := newCircuitBreaker(CBConfig{Name: "test-force", OnStateChange: func(_ string, from, to State) {
+				mu.Lock()
+				transitions = append(transitions, from, to)
+				mu.Unlock()
+			}}, new(mockClient))
+
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					if i%2 == 0 {
+						cb.force(forcedOpen)
+					} else {
+						cb.force(forcedNone)
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			// every opening is matched by a closing, unless the breaker ends open
+			opened := 0
+			for i := 0; i < len(transitions); i += 2 {
+				convey.So(transitions[i], convey.ShouldNotEqual, transitions[i+1])
+				if transitions[i+1] == StateOpen {
+					opened++
+				} else {
+					opened--
+				}
+			}
+
+			want := 0
+			if cb.info().State == StateOpen {
+				want = 1
+			}
+			convey.So(opened, convey.ShouldEqual, want)
+		})
+
+		convey.Reset(func() {
+			_ = first.Close()
+		})
+	})
+}
+
+func TestStateString(t *testing.T) {
+	convey.Convey("State string", t, func() {
+		convey.So(StateClosed.String(), convey.ShouldEqual, "closed")
+		convey.So(StateHalfOpen.String(), convey.ShouldEqual, "half-open")
+		convey.So(StateOpen.String(), convey.ShouldEqual, "open")
+		convey.So(State(10).String(), convey.ShouldEqual, "unknown state: 10")
+	})
+}
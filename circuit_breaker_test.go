@@ -242,3 +242,28 @@ func TestPathInWhitelist(t *testing.T) {
 		})
 	})
 }
+
+func TestCircuitBreakerThreshold(t *testing.T) {
+	convey.Convey("Circuit breaker threshold", t, func() {
+		convey.Convey("Should open after threshold consecutive failures", func() {
+			testClient := &mockClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{StatusCode: http.StatusBadGateway}, nil
+				},
+			}
+
+			cb := newCircuitBreaker(CBConfig{
+				IsActive:  true,
+				Threshold: 2,
+				Paths:     []string{"/"},
+			}, testClient)
+
+			request := &http.Request{URL: &url.URL{Path: "/"}}
+			_, _ = cb.Do(request)
+			convey.So(cb.info().State, convey.ShouldEqual, StateClosed)
+
+			_, _ = cb.Do(request)
+			convey.So(cb.info().State, convey.ShouldEqual, StateOpen)
+		})
+	})
+}
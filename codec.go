@@ -0,0 +1,322 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec encodes and decodes body of a media type.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// CodecFunc adapts marshal and unmarshal function into Codec, e.g. CodecFunc{json.Marshal, json.Unmarshal}.
+type CodecFunc struct {
+	MarshalFunc   func(v interface{}) ([]byte, error)
+	UnmarshalFunc func(data []byte, v interface{}) error
+}
+
+func (c CodecFunc) Marshal(v interface{}) ([]byte, error) {
+	return c.MarshalFunc(v)
+}
+
+func (c CodecFunc) Unmarshal(data []byte, v interface{}) error {
+	return c.UnmarshalFunc(data, v)
+}
+
+// These constants are media types registered in DefaultCodecs.
+const (
+	MediaTypeJSON     = "application/json"
+	MediaTypeXML      = "application/xml"
+	MediaTypeForm     = "application/x-www-form-urlencoded"
+	MediaTypeProtobuf = "application/x-protobuf"
+	MediaTypeMsgpack  = "application/msgpack"
+	MediaTypeText     = "text/plain"
+)
+
+// CodecRegistry selects Codec by media type of Content-Type header.
+// Structured syntax suffix is also recognized, e.g. application/problem+json uses the JSON codec.
+type CodecRegistry struct {
+	mu     sync.RWMutex
+	codecs map[string]Codec
+	order  []string // registration order, the first one is preferred in Accept header
+}
+
+// DefaultCodecs is CodecRegistry with JSON, XML, form, protobuf, msgpack and plain text codec,
+// used by HttpResponse.Decode when WithCodecs is not used.
+var DefaultCodecs = NewCodecRegistry()
+
+// NewCodecRegistry returns CodecRegistry with JSON, XML, form, protobuf, msgpack and plain text codec.
+func NewCodecRegistry() *CodecRegistry {
+	r := &CodecRegistry{
+		codecs: make(map[string]Codec),
+	}
+
+	r.Register(MediaTypeJSON, CodecFunc{json.Marshal, json.Unmarshal})
+	r.Register(MediaTypeXML, CodecFunc{xml.Marshal, xml.Unmarshal})
+	r.Register("text/xml", CodecFunc{xml.Marshal, xml.Unmarshal})
+	r.Register(MediaTypeForm, CodecFunc{marshalForm, unmarshalForm})
+	r.Register(MediaTypeProtobuf, CodecFunc{marshalProto, unmarshalProto})
+	r.Register("application/protobuf", CodecFunc{marshalProto, unmarshalProto})
+	r.Register(MediaTypeMsgpack, CodecFunc{msgpack.Marshal, msgpack.Unmarshal})
+	r.Register("application/x-msgpack", CodecFunc{msgpack.Marshal, msgpack.Unmarshal})
+	r.Register(MediaTypeText, CodecFunc{marshalText, unmarshalText})
+
+	return r
+}
+
+// Register adds or replaces Codec of media type.
+func (r *CodecRegistry) Register(mediaType string, codec Codec) {
+	mediaType = strings.ToLower(mediaType)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.codecs[mediaType]; !ok {
+		r.order = append(r.order, mediaType)
+	}
+
+	r.codecs[mediaType] = codec
+}
+
+// Lookup returns Codec for Content-Type header value, e.g. "application/json; charset=utf-8".
+func (r *CodecRegistry) Lookup(contentType string) (Codec, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type %q: %s", contentType, err.Error())
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if codec, ok := r.codecs[mediaType]; ok {
+		return codec, nil
+	}
+
+	// structured syntax suffix, see RFC 6839
+	if i := strings.LastIndex(mediaType, "+"); i >= 0 {
+		main := mediaType[:strings.Index(mediaType, "/")+1]
+		if codec, ok := r.codecs[main+mediaType[i+1:]]; ok {
+			return codec, nil
+		}
+
+		if codec, ok := r.codecs["application/"+mediaType[i+1:]]; ok {
+			return codec, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, mediaType)
+}
+
+// Accept returns Accept header value listing registered media types in registration order.
+func (r *CodecRegistry) Accept() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	accept := make([]string, 0, len(r.order))
+	for i, mediaType := range r.order {
+		if i == 0 {
+			accept = append(accept, mediaType)
+			continue
+		}
+
+		accept = append(accept, mediaType+";q=0.9")
+	}
+
+	return strings.Join(accept, ", ")
+}
+
+// Marshal encodes v using the codec of contentType.
+func (r *CodecRegistry) Marshal(contentType string, v interface{}) ([]byte, error) {
+	codec, err := r.Lookup(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	return codec.Marshal(v)
+}
+
+// Unmarshal decodes data using the codec of contentType.
+func (r *CodecRegistry) Unmarshal(contentType string, data []byte, v interface{}) error {
+	codec, err := r.Lookup(contentType)
+	if err != nil {
+		return err
+	}
+
+	return codec.Unmarshal(data, v)
+}
+
+func marshalForm(v interface{}) ([]byte, error) {
+	switch form := v.(type) {
+	case url.Values:
+		return []byte(form.Encode()), nil
+	case map[string][]string:
+		return []byte(url.Values(form).Encode()), nil
+	case map[string]string:
+		values := url.Values{}
+		for key, value := range form {
+			values.Set(key, value)
+		}
+		return []byte(values.Encode()), nil
+	default:
+		return nil, fmt.Errorf("form codec can't marshal %T, use url.Values", v)
+	}
+}
+
+func unmarshalForm(data []byte, v interface{}) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+
+	switch out := v.(type) {
+	case *url.Values:
+		*out = values
+	case *map[string][]string:
+		*out = values
+	case *map[string]string:
+		*out = make(map[string]string, len(values))
+		for key := range values {
+			(*out)[key] = values.Get(key)
+		}
+	default:
+		return fmt.Errorf("form codec can't unmarshal into %T, use *url.Values", v)
+	}
+
+	return nil
+}
+
+func marshalProto(v interface{}) ([]byte, error) {
+	message, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf codec can't marshal %T, it is not proto.Message", v)
+	}
+
+	return proto.Marshal(message)
+}
+
+func unmarshalProto(data []byte, v interface{}) error {
+	message, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf codec can't unmarshal into %T, it is not proto.Message", v)
+	}
+
+	return proto.Unmarshal(data, message)
+}
+
+func marshalText(v interface{}) ([]byte, error) {
+	switch text := v.(type) {
+	case string:
+		return []byte(text), nil
+	case []byte:
+		return text, nil
+	case fmt.Stringer:
+		return []byte(text.String()), nil
+	default:
+		return nil, fmt.Errorf("text codec can't marshal %T", v)
+	}
+}
+
+func unmarshalText(data []byte, v interface{}) error {
+	switch out := v.(type) {
+	case *string:
+		*out = string(data)
+	case *[]byte:
+		*out = append((*out)[:0], data...)
+	default:
+		return errors.New("text codec can only unmarshal into *string or *[]byte")
+	}
+
+	return nil
+}
+
+// Send encodes body using the codec of requestHeader Content-Type, or JSON when it is empty,
+// and sets Accept header to the registered media types when the request has none.
+// Nil body sends request without body. requestHeader is not modified.
+func (r DefaultHttpRequester) Send(
+	ctx context.Context,
+	method,
+	correlationID,
+	path string,
+	requestHeader http.Header,
+	body interface{},
+) (ret HttpResponse, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Send")
+	defer func() {
+		span.Finish()
+		ctx.Done()
+	}()
+
+	codecs := r.codecs
+	if codecs == nil {
+		codecs = DefaultCodecs
+	}
+
+	requestHeader = cloneHeader(requestHeader)
+
+	if requestHeader.Get("Accept") == "" {
+		requestHeader.Set("Accept", codecs.Accept())
+	}
+
+	var data []byte
+	if body != nil {
+		if requestHeader.Get("Content-Type") == "" {
+			requestHeader.Set("Content-Type", MediaTypeJSON)
+		}
+
+		if data, err = codecs.Marshal(requestHeader.Get("Content-Type"), body); err != nil {
+			return ret, fmt.Errorf("fail encode request body: %s", err.Error())
+		}
+	}
+
+	ret, err = r.call(ctx, method, correlationID, path, requestHeader, data)
+	return
+}
+
+// decodeBody returns body shown in hook. Body of JSON media type, or of media type without codec, is decoded as JSON.
+// Other body is decoded by the codec of its media type when the codec can decode into interface{}, e.g. msgpack,
+// or into url.Values for form. Otherwise, e.g. XML or plain text, the body is shown as string.
+func decodeBody(mode JSONNumberMode, codecs *CodecRegistry, contentType string, data []byte) interface{} {
+	if codecs == nil {
+		codecs = DefaultCodecs
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	codec, err := codecs.Lookup(contentType)
+	if mediaType == MediaTypeJSON || strings.HasSuffix(mediaType, "+json") || err != nil {
+		if body, err := decodeJSONBody(mode, data); err == nil {
+			return body
+		}
+
+		return string(data)
+	}
+
+	if mediaType == MediaTypeForm {
+		var values url.Values
+		if err := codec.Unmarshal(data, &values); err == nil {
+			return values
+		}
+
+		return string(data)
+	}
+
+	var body interface{}
+	if err := codec.Unmarshal(data, &body); err == nil {
+		return body
+	}
+
+	return string(data)
+}
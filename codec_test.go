@@ -0,0 +1,241 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type codecSample struct {
+	Name   string `json:"name" xml:"name" msgpack:"name"`
+	Amount int64  `json:"amount" xml:"amount" msgpack:"amount"`
+}
+
+func TestCodecRegistry(t *testing.T) {
+	convey.Convey("Codec registry", t, func() {
+		registry := NewCodecRegistry()
+		sample := codecSample{Name: "budi", Amount: 1000}
+
+		convey.Convey("Struct should round trip in JSON, XML and msgpack", func() {
+			for _, contentType := range []string{"application/json; charset=utf-8", "application/xml", "text/xml", "application/msgpack", "application/vnd.partner+json"} {
+				data, err := registry.Marshal(contentType, sample)
+				convey.So(err, convey.ShouldBeNil)
+
+				var out codecSample
+				convey.So(registry.Unmarshal(contentType, data, &out), convey.ShouldBeNil)
+				convey.So(out, convey.ShouldResemble, sample)
+			}
+		})
+
+		convey.Convey("Protobuf should round trip proto.Message", func() {
+			data, err := registry.Marshal(MediaTypeProtobuf, wrapperspb.String("hello"))
+			convey.So(err, convey.ShouldBeNil)
+
+			out := &wrapperspb.StringValue{}
+			convey.So(registry.Unmarshal("application/protobuf", data, out), convey.ShouldBeNil)
+			convey.So(proto.Equal(out, wrapperspb.String("hello")), convey.ShouldBeTrue)
+
+			_, err = registry.Marshal(MediaTypeProtobuf, sample)
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(registry.Unmarshal(MediaTypeProtobuf, data, &sample), convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Form should round trip url.Values and map", func() {
+			data, err := registry.Marshal(MediaTypeForm, url.Values{"a": {"1", "2"}})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(string(data), convey.ShouldEqual, "a=1&a=2")
+
+			data, err = registry.Marshal(MediaTypeForm, map[string]string{"b": "x y"})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(string(data), convey.ShouldEqual, "b=x+y")
+
+			var values url.Values
+			convey.So(registry.Unmarshal(MediaTypeForm, []byte("a=1&a=2"), &values), convey.ShouldBeNil)
+			convey.So(values, convey.ShouldResemble, url.Values{"a": {"1", "2"}})
+
+			var flat map[string]string
+			convey.So(registry.Unmarshal(MediaTypeForm, []byte("a=1&a=2"), &flat), convey.ShouldBeNil)
+			convey.So(flat, convey.ShouldResemble, map[string]string{"a": "1"})
+
+			_, err = registry.Marshal(MediaTypeForm, sample)
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(registry.Unmarshal(MediaTypeForm, []byte("a=1"), &sample), convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Plain text should read into string or bytes", func() {
+			data, err := registry.Marshal("text/plain; charset=utf-8", "hello")
+			convey.So(err, convey.ShouldBeNil)
+
+			var text string
+			convey.So(registry.Unmarshal(MediaTypeText, data, &text), convey.ShouldBeNil)
+			convey.So(text, convey.ShouldEqual, "hello")
+
+			var raw []byte
+			convey.So(registry.Unmarshal(MediaTypeText, data, &raw), convey.ShouldBeNil)
+			convey.So(string(raw), convey.ShouldEqual, "hello")
+
+			convey.So(registry.Unmarshal(MediaTypeText, data, &sample), convey.ShouldNotBeNil)
+			_, err = registry.Marshal(MediaTypeText, 1)
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Unknown or invalid media type should return error", func() {
+			_, err := registry.Lookup("image/png")
+			convey.So(errors.Is(err, ErrUnsupportedMediaType), convey.ShouldBeTrue)
+
+			_, err = registry.Lookup(";;")
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Accept should prefer the first registered media type", func() {
+			registry := &CodecRegistry{codecs: map[string]Codec{}}
+			registry.Register("application/json", DefaultCodecs.codecs[MediaTypeJSON])
+			registry.Register("application/xml", DefaultCodecs.codecs[MediaTypeXML])
+			convey.So(registry.Accept(), convey.ShouldEqual, "application/json, application/xml;q=0.9")
+		})
+	})
+}
+
+func TestHttpResponseDecode(t *testing.T) {
+	convey.Convey("HttpResponse.Decode", t, func() {
+		convey.Convey("Should pick codec from Content-Type", func() {
+			resp := &HttpResponse{
+				RespBody: []byte(`<codecSample><name>budi</name><amount>1000</amount></codecSample>`),
+				Raw:      ResponseRaw{Header: http.Header{"Content-Type": {"application/xml"}}},
+			}
+
+			var out codecSample
+			convey.So(resp.Decode(context.Background(), &out), convey.ShouldBeNil)
+			convey.So(out, convey.ShouldResemble, codecSample{Name: "budi", Amount: 1000})
+		})
+
+		convey.Convey("Should use JSON when Content-Type is empty", func() {
+			resp := &HttpResponse{RespBody: []byte(`{"name": "budi"}`)}
+
+			var out codecSample
+			convey.So(resp.Decode(context.Background(), &out), convey.ShouldBeNil)
+			convey.So(out.Name, convey.ShouldEqual, "budi")
+		})
+
+		convey.Convey("Should return error for nil or unsupported response", func() {
+			var resp *HttpResponse
+			convey.So(resp.Decode(context.Background(), nil), convey.ShouldNotBeNil)
+
+			resp = &HttpResponse{Raw: ResponseRaw{Header: http.Header{"Content-Type": {"image/png"}}}}
+			convey.So(resp.Decode(context.Background(), nil), convey.ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSend(t *testing.T) {
+	convey.Convey("Test Send", t, func() {
+		var received *http.Request
+		var receivedBody []byte
+		testClient := &mockClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				received = req
+				receivedBody, _ = ioutil.ReadAll(req.Body)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{"Content-Type": {"application/msgpack"}},
+					Body:       ioutil.NopCloser(bytes.NewReader(receivedBody)),
+				}, nil
+			},
+		}
+
+		convey.Convey("Should encode body using Content-Type and decode response", func() {
+			client, err := DefaultClient(testClient, WithCodecs(NewCodecRegistry()))
+			convey.So(err, convey.ShouldBeNil)
+
+			resp, err := client.Send(context.Background(), http.MethodPost, "", "http://example.com/",
+				http.Header{"Content-Type": {"application/msgpack"}}, codecSample{Name: "budi", Amount: 1})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(received.Header.Get("Accept"), convey.ShouldStartWith, "application/json, ")
+
+			var out codecSample
+			convey.So(resp.Decode(context.Background(), &out), convey.ShouldBeNil)
+			convey.So(out, convey.ShouldResemble, codecSample{Name: "budi", Amount: 1})
+		})
+
+		convey.Convey("Should use JSON by default and send no body for nil", func() {
+			client, _ := DefaultClient(testClient)
+
+			_, err := client.Send(context.Background(), http.MethodPost, "", "http://example.com/", http.Header{}, codecSample{Name: "budi"})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(received.Header.Get("Content-Type"), convey.ShouldEqual, MediaTypeJSON)
+			convey.So(string(receivedBody), convey.ShouldEqual, `{"name":"budi","amount":0}`)
+
+			_, err = client.Send(context.Background(), http.MethodGet, "", "http://example.com/", http.Header{}, nil)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(receivedBody, convey.ShouldBeEmpty)
+		})
+
+		convey.Convey("Should not modify caller header", func() {
+			client, _ := DefaultClient(testClient)
+
+			header := http.Header{}
+			_, err := client.Send(context.Background(), http.MethodPost, "", "http://example.com/", header, codecSample{Name: "budi"})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(received.Header.Get("Content-Type"), convey.ShouldEqual, MediaTypeJSON)
+			convey.So(header, convey.ShouldBeEmpty)
+
+			_, err = client.Send(context.Background(), http.MethodPost, "", "http://example.com/", header, "plain")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(string(receivedBody), convey.ShouldEqual, `"plain"`)
+		})
+
+		convey.Convey("Should show body in hook using codec of Content-Type", func() {
+			hook := new(lastHook)
+			client, _ := DefaultClient(testClient, AddHook(hook))
+
+			_, err := client.Send(context.Background(), http.MethodPost, "", "http://example.com/",
+				http.Header{"Content-Type": {"application/msgpack"}}, codecSample{Name: "budi", Amount: 1})
+			convey.So(err, convey.ShouldBeNil)
+
+			request, ok := hook.data.Request.Body.(map[string]interface{})
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(request["name"], convey.ShouldEqual, "budi")
+
+			response, ok := hook.data.Response.Body.(map[string]interface{})
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(response["name"], convey.ShouldEqual, "budi")
+
+			_, err = client.Send(context.Background(), http.MethodPost, "", "http://example.com/",
+				http.Header{"Content-Type": {MediaTypeText}}, "123")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(hook.data.Request.Body, convey.ShouldEqual, "123")
+
+			_, err = client.Send(context.Background(), http.MethodPost, "", "http://example.com/",
+				http.Header{"Content-Type": {MediaTypeForm}}, url.Values{"amount": {"1"}})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(hook.data.Request.Body, convey.ShouldResemble, url.Values{"amount": {"1"}})
+
+			_, err = client.Send(context.Background(), http.MethodPost, "", "http://example.com/",
+				http.Header{"Content-Type": {"application/problem+json"}}, codecSample{Name: "budi"})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(hook.data.Request.Body, convey.ShouldResemble, map[string]interface{}{"name": "budi", "amount": float64(0)})
+		})
+
+		convey.Convey("Should return error when body can't be encoded", func() {
+			client, _ := DefaultClient(testClient)
+
+			_, err := client.Send(context.Background(), http.MethodPost, "", "http://example.com/",
+				http.Header{"Content-Type": {"image/png"}}, codecSample{})
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("WithCodecs should reject nil registry", func() {
+			client, err := DefaultClient(testClient, WithCodecs(nil))
+			convey.So(client, convey.ShouldBeNil)
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,204 @@
+package rest
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Encoding is HTTP content coding used in Content-Encoding and Accept-Encoding header.
+type Encoding string
+
+// These constants are supported Encoding.
+const (
+	EncodingGzip    Encoding = "gzip"
+	EncodingDeflate Encoding = "deflate"
+	EncodingZstd    Encoding = "zstd"
+	EncodingBrotli  Encoding = "br"
+)
+
+// acceptEncoding is the Accept-Encoding sent when response decoding is enabled
+const acceptEncoding = "gzip, deflate, zstd, br"
+
+// CompressionConfig configures WithCompression:
+//
+// Request is the encoding used to compress request body, empty means request body is not compressed.
+//
+// MinSize is the minimum request body size in bytes to be compressed, default 1024.
+// Small body usually gets bigger after compression.
+//
+// DecodeResponse sends Accept-Encoding of all supported Encoding and decodes response body
+// according to Content-Encoding, so HttpResponse.RespBody is always the decoded body.
+type CompressionConfig struct {
+	Request        Encoding `json:"request" yaml:"request"`
+	MinSize        int      `json:"min_size" yaml:"min_size"`
+	DecodeResponse bool     `json:"decode_response" yaml:"decode_response"`
+}
+
+// BodySize is the size of body in bytes, as it is sent on the wire (Compressed) and after decoding (Uncompressed).
+// Both values are equal when body is not compressed.
+type BodySize struct {
+	Compressed   int64 `json:"compressed"`
+	Uncompressed int64 `json:"uncompressed"`
+}
+
+func isSupportedEncoding(encoding Encoding) bool {
+	switch encoding {
+	case EncodingGzip, EncodingDeflate, EncodingZstd, EncodingBrotli:
+		return true
+	default:
+		return false
+	}
+}
+
+// compressBody encodes data using encoding.
+func compressBody(encoding Encoding, data []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	var w io.WriteCloser
+	switch encoding {
+	case EncodingGzip:
+		w = gzip.NewWriter(buf)
+	case EncodingDeflate:
+		// HTTP deflate is zlib format, see RFC 9110 section 8.4.1.2
+		w = zlib.NewWriter(buf)
+	case EncodingZstd:
+		zw, err := zstd.NewWriter(buf)
+		if err != nil {
+			return nil, err
+		}
+		w = zw
+	case EncodingBrotli:
+		w = brotli.NewWriter(buf)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decompressBody decodes data encoded using Content-Encoding, multiple codings are decoded in reverse order.
+// It returns ErrResponseTooLarge when decoded data is bigger than limit, limit <= 0 decodes without limit.
+func decompressBody(contentEncoding string, data []byte, limit int64) ([]byte, error) {
+	codings := strings.Split(contentEncoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := Encoding(strings.ToLower(strings.TrimSpace(codings[i])))
+		if coding == "" || coding == "identity" {
+			continue
+		}
+
+		var (
+			r   io.Reader
+			err error
+		)
+
+		switch coding {
+		case EncodingGzip, "x-gzip":
+			r, err = gzip.NewReader(bytes.NewReader(data))
+		case EncodingDeflate:
+			r, err = zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				// some server sends raw deflate without zlib header
+				r, err = flate.NewReader(bytes.NewReader(data)), nil
+			}
+		case EncodingZstd:
+			var zr *zstd.Decoder
+			zr, err = zstd.NewReader(bytes.NewReader(data))
+			if err == nil {
+				defer zr.Close()
+				r = zr
+			}
+		case EncodingBrotli:
+			r = brotli.NewReader(bytes.NewReader(data))
+		default:
+			return nil, fmt.Errorf("unsupported content encoding %q", coding)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("fail decode %s body: %s", coding, err.Error())
+		}
+
+		if data, err = readLimited(r, limit); err != nil {
+			if errors.Is(err, ErrResponseTooLarge) {
+				return nil, err
+			}
+
+			return nil, fmt.Errorf("fail decode %s body: %s", coding, err.Error())
+		}
+	}
+
+	return data, nil
+}
+
+// compressRequest compresses request body when it is bigger than MinSize, and returns the body sent on the wire.
+// Body is sent as is when caller already sets Content-Encoding, request header must be a copy of the caller header.
+func (c *CompressionConfig) compressRequest(request *http.Request, body []byte) ([]byte, error) {
+	if c == nil || c.Request == "" || len(body) < c.MinSize || request.Header.Get("Content-Encoding") != "" {
+		return body, nil
+	}
+
+	compressed, err := compressBody(c.Request, body)
+	if err != nil {
+		return nil, fmt.Errorf("fail compress request body: %s", err.Error())
+	}
+
+	request.Header.Set("Content-Encoding", string(c.Request))
+	request.Body = ioutil.NopCloser(bytes.NewReader(compressed))
+	request.ContentLength = int64(len(compressed))
+	request.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(compressed)), nil
+	}
+
+	return compressed, nil
+}
+
+// decodeResponse decodes response body according to Content-Encoding, like Go transport does for gzip.
+func (c *CompressionConfig) decodeResponse(raw *ResponseRaw, body []byte, limit int64) ([]byte, error) {
+	contentEncoding := raw.Header.Get("Content-Encoding")
+	if c == nil || !c.DecodeResponse || contentEncoding == "" {
+		return body, nil
+	}
+
+	decoded, err := decompressBody(contentEncoding, body, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	raw.Header.Del("Content-Encoding")
+	raw.Header.Del("Content-Length")
+	raw.ContentLength = -1
+	raw.Uncompressed = true
+
+	return decoded, nil
+}
+
+// Validate returns error for nonsensical compression config value.
+func (c CompressionConfig) Validate() error {
+	if c.Request != "" && !isSupportedEncoding(c.Request) {
+		return errors.New("compression.request must be one of gzip, deflate, zstd or br")
+	}
+
+	if c.MinSize < 0 {
+		return fmt.Errorf("compression.min_size must not be negative, got %d", c.MinSize)
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// lastHook keeps the last HookData received by AfterRequest.
+type lastHook struct {
+	NoopHook
+	data HookData
+}
+
+func (h *lastHook) AfterRequest(_ context.Context, data HookData) {
+	h.data = data
+}
+
+func TestCompressBody(t *testing.T) {
+	convey.Convey("Compress and decompress body", t, func() {
+		data := []byte(strings.Repeat(`{"amount": 1000}`, 100))
+
+		for _, encoding := range []Encoding{EncodingGzip, EncodingDeflate, EncodingZstd, EncodingBrotli} {
+			compressed, err := compressBody(encoding, data)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(compressed), convey.ShouldBeLessThan, len(data))
+
+			decompressed, err := decompressBody(string(encoding), compressed, 0)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(decompressed, convey.ShouldResemble, data)
+		}
+
+		convey.Convey("Multiple codings should be decoded in reverse order", func() {
+			gz, _ := compressBody(EncodingGzip, data)
+			br, _ := compressBody(EncodingBrotli, gz)
+
+			decompressed, err := decompressBody("gzip, br", br, 0)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(decompressed, convey.ShouldResemble, data)
+		})
+
+		convey.Convey("Unknown or corrupt coding should return error", func() {
+			_, err := compressBody("lzma", data)
+			convey.So(err, convey.ShouldNotBeNil)
+
+			_, err = decompressBody("lzma", data, 0)
+			convey.So(err, convey.ShouldNotBeNil)
+
+			_, err = decompressBody("gzip", data, 0)
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
+
+func TestWithCompression(t *testing.T) {
+	convey.Convey("Test WithCompression", t, func() {
+		largeBody := []byte(strings.Repeat(`{"amount": 1000}`, 100))
+
+		var received *http.Request
+		var receivedBody []byte
+		responseEncoding := ""
+		testClient := &mockClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				received = req
+				receivedBody, _ = ioutil.ReadAll(req.Body)
+
+				body := largeBody
+				header := http.Header{}
+				if responseEncoding != "" {
+					body, _ = compressBody(Encoding(responseEncoding), largeBody)
+					header.Set("Content-Encoding", responseEncoding)
+				}
+
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     header,
+					Body:       ioutil.NopCloser(bytes.NewReader(body)),
+				}, nil
+			},
+		}
+
+		hook := new(lastHook)
+
+		convey.Convey("Should return error on unsupported encoding", func() {
+			client, err := DefaultClient(testClient, WithCompression(CompressionConfig{Request: "lzma"}))
+			convey.So(client, convey.ShouldBeNil)
+			convey.So(err, convey.ShouldNotBeNil)
+
+			client, err = DefaultClient(testClient, WithCompression(CompressionConfig{MinSize: -1}))
+			convey.So(client, convey.ShouldBeNil)
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Should compress request body above threshold", func() {
+			client, err := DefaultClient(testClient, WithCompression(CompressionConfig{Request: EncodingZstd}), AddHook(hook))
+			convey.So(err, convey.ShouldBeNil)
+
+			_, err = client.Post(context.Background(), "", "http://example.com/", http.Header{}, largeBody)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(received.Header.Get("Content-Encoding"), convey.ShouldEqual, "zstd")
+			convey.So(received.ContentLength, convey.ShouldEqual, len(receivedBody))
+
+			decoded, err := decompressBody("zstd", receivedBody, 0)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(decoded, convey.ShouldResemble, largeBody)
+
+			convey.So(hook.data.RequestSize.Uncompressed, convey.ShouldEqual, len(largeBody))
+			convey.So(hook.data.RequestSize.Compressed, convey.ShouldEqual, len(receivedBody))
+			convey.So(hook.data.Request.Body, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Should compress each request sharing one header", func() {
+			client, _ := DefaultClient(testClient, WithCompression(CompressionConfig{Request: EncodingGzip}))
+
+			header := http.Header{}
+			for i := 0; i < 2; i++ {
+				_, err := client.Post(context.Background(), "", "http://example.com/", header, largeBody)
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(received.Header.Get("Content-Encoding"), convey.ShouldEqual, "gzip")
+
+				decoded, err := decompressBody("gzip", receivedBody, 0)
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(decoded, convey.ShouldResemble, largeBody)
+			}
+
+			convey.So(header.Get("Content-Encoding"), convey.ShouldBeEmpty)
+		})
+
+		convey.Convey("Should send body as is when caller sets Content-Encoding", func() {
+			client, _ := DefaultClient(testClient, WithCompression(CompressionConfig{Request: EncodingGzip}))
+			precompressed, _ := compressBody(EncodingBrotli, largeBody)
+
+			_, err := client.Post(context.Background(), "", "http://example.com/", http.Header{"Content-Encoding": {"br"}}, precompressed)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(received.Header.Get("Content-Encoding"), convey.ShouldEqual, "br")
+			convey.So(receivedBody, convey.ShouldResemble, precompressed)
+		})
+
+		convey.Convey("Should not compress request body below threshold", func() {
+			client, _ := DefaultClient(testClient, WithCompression(CompressionConfig{Request: EncodingGzip}), AddHook(hook))
+
+			_, err := client.Post(context.Background(), "", "http://example.com/", http.Header{}, []byte(`{}`))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(received.Header.Get("Content-Encoding"), convey.ShouldBeEmpty)
+			convey.So(string(receivedBody), convey.ShouldEqual, `{}`)
+			convey.So(hook.data.RequestSize, convey.ShouldResemble, BodySize{Compressed: 2, Uncompressed: 2})
+		})
+
+		convey.Convey("Should decode compressed response", func() {
+			client, _ := DefaultClient(testClient, WithCompression(CompressionConfig{DecodeResponse: true}), AddHook(hook))
+
+			for _, encoding := range []string{"gzip", "deflate", "zstd", "br"} {
+				responseEncoding = encoding
+
+				resp, err := client.Get(context.Background(), "", "http://example.com/", http.Header{})
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(received.Header.Get("Accept-Encoding"), convey.ShouldEqual, acceptEncoding)
+				convey.So(resp.RespBody, convey.ShouldResemble, largeBody)
+				convey.So(resp.Raw.Uncompressed, convey.ShouldBeTrue)
+				convey.So(resp.Raw.Header.Get("Content-Encoding"), convey.ShouldBeEmpty)
+				convey.So(hook.data.ResponseSize.Uncompressed, convey.ShouldEqual, len(largeBody))
+				convey.So(hook.data.ResponseSize.Compressed, convey.ShouldBeLessThan, len(largeBody))
+			}
+		})
+
+		convey.Convey("Should return error when response can't be decoded", func() {
+			client, _ := DefaultClient(&mockClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     http.Header{"Content-Encoding": {"gzip"}},
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte("not gzip"))),
+					}, nil
+				},
+			}, WithCompression(CompressionConfig{DecodeResponse: true}))
+
+			_, err := client.Get(context.Background(), "", "http://example.com/", http.Header{})
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,280 @@
+package rest
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// minTimeout is the smallest timeout that makes sense for a network call,
+// value below this is most likely a number of seconds written as time.Duration.
+const minTimeout = time.Millisecond
+
+// RequesterConfig is a single config document to build DefaultHttpRequester,
+// it configures the http client, circuit breaker and hooks in one place.
+//
+//	http:
+//	  client:
+//	    timeout: 2s
+//	  transport:
+//	    tls_handshake_timeout: 250ms
+//	circuit_breaker:
+//	  name: payment
+//	  is_active: true
+//	  timeout: 30s
+//	  threshold: 5
+//	  paths: ["/v1/payments"]
+//	hooks: ["logger"]
+type RequesterConfig struct {
+	HTTP           Config   `json:"http" yaml:"http"`
+	CircuitBreaker CBConfig `json:"circuit_breaker" yaml:"circuit_breaker"`
+	Hooks          []string `json:"hooks" yaml:"hooks"` // name of hooks passed to Build
+}
+
+// ParseConfig reads RequesterConfig from JSON or YAML document.
+func ParseConfig(doc []byte) (RequesterConfig, error) {
+	conf := RequesterConfig{}
+
+	trimmed := strings.TrimSpace(string(doc))
+	if strings.HasPrefix(trimmed, "{") {
+		decoder := json.NewDecoder(strings.NewReader(trimmed))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&conf); err != nil {
+			return conf, fmt.Errorf("fail parse json config: %s", err.Error())
+		}
+
+		return conf, nil
+	}
+
+	decoder := yaml.NewDecoder(strings.NewReader(trimmed))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&conf); err != nil && !errors.Is(err, io.EOF) {
+		return conf, fmt.Errorf("fail parse yaml config: %s", err.Error())
+	}
+
+	return conf, nil
+}
+
+// FromEnv overrides config value using environment variables.
+// The variable name is prefix followed by the upper-cased json field path joined by underscore,
+// e.g. with prefix "PAYMENT_" the client timeout is read from PAYMENT_HTTP_CLIENT_TIMEOUT=250ms.
+// Slice is written as comma separated value.
+func (c *RequesterConfig) FromEnv(prefix string) error {
+	return loadEnv(reflect.ValueOf(c).Elem(), strings.ToUpper(prefix))
+}
+
+func loadEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tag == "" || tag == "-" || !field.IsExported() {
+			continue
+		}
+
+		name := prefix + strings.ToUpper(tag)
+		value := v.Field(i)
+
+		if value.Kind() == reflect.Struct {
+			if _, ok := value.Addr().Interface().(encoding.TextUnmarshaler); !ok {
+				if err := loadEnv(value, name+"_"); err != nil {
+					return err
+				}
+
+				continue
+			}
+		}
+
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		if err := setEnvValue(value, raw); err != nil {
+			return fmt.Errorf("invalid env %s: %s", name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func setEnvValue(v reflect.Value, raw string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(raw))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Slice:
+		parts := make([]string, 0)
+		for _, p := range strings.Split(raw, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				parts = append(parts, p)
+			}
+		}
+
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, p := range parts {
+			if err := setEnvValue(slice.Index(i), p); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+// Validate returns error for nonsensical config value.
+func (c RequesterConfig) Validate() error {
+	return errors.Join(c.HTTP.Validate(), c.CircuitBreaker.Validate())
+}
+
+// Validate returns error for nonsensical http client config value.
+func (c Config) Validate() error {
+	var errs []error
+
+	errs = append(errs,
+		validateTimeout("client.timeout", c.Client.Timeout),
+		validateTimeout("transport.tls_handshake_timeout", c.Transport.TLSHandshakeTimeout),
+	)
+
+	errs = append(errs,
+		validateTimeout("transport.dial_timeout", c.Transport.DialTimeout),
+		validateTimeout("transport.idle_conn_timeout", c.Transport.IdleConnTimeout),
+		validateTimeout("transport.response_header_timeout", c.Transport.ResponseHeaderTimeout),
+		validateTimeout("transport.expect_continue_timeout", c.Transport.ExpectContinueTimeout),
+		validateNonNegative("transport.max_idle_conns", c.Transport.MaxIdleConns),
+		validateNonNegative("transport.max_idle_conns_per_host", c.Transport.MaxIdleConnsPerHost),
+		validateNonNegative("transport.max_conns_per_host", c.Transport.MaxConnsPerHost),
+	)
+
+	if c.Transport.MaxIdleConns > 0 && c.Transport.MaxIdleConnsPerHost > c.Transport.MaxIdleConns {
+		errs = append(errs, fmt.Errorf("transport.max_idle_conns_per_host %d is more than transport.max_idle_conns %d",
+			c.Transport.MaxIdleConnsPerHost, c.Transport.MaxIdleConns))
+	}
+
+	if c.Transport.MaxConnsPerHost > 0 && c.Transport.MaxIdleConnsPerHost > c.Transport.MaxConnsPerHost {
+		errs = append(errs, fmt.Errorf("transport.max_idle_conns_per_host %d is more than transport.max_conns_per_host %d",
+			c.Transport.MaxIdleConnsPerHost, c.Transport.MaxConnsPerHost))
+	}
+
+	errs = append(errs, c.Transport.TLS.Validate(), c.Proxy.Validate())
+
+	if c.Client.Timeout > 0 && c.Transport.TLSHandshakeTimeout > c.Client.Timeout {
+		errs = append(errs, fmt.Errorf("transport.tls_handshake_timeout %s is longer than client.timeout %s",
+			c.Transport.TLSHandshakeTimeout, c.Client.Timeout))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate returns error for nonsensical circuit breaker config value.
+func (c CBConfig) Validate() error {
+	var errs []error
+
+	errs = append(errs,
+		validateTimeout("circuit_breaker.timeout", c.Timeout),
+		validateTimeout("circuit_breaker.interval_timeout", c.IntervalTimeout),
+	)
+
+	errs = append(errs, validateNonNegative("circuit_breaker.threshold", c.Threshold))
+
+	if c.IsActive && len(c.Paths) == 0 {
+		errs = append(errs, errors.New("circuit_breaker.paths must not be empty when circuit breaker is active"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateTimeout(name string, d Duration) error {
+	if d < 0 {
+		return fmt.Errorf("%s must not be negative, got %s", name, d)
+	}
+
+	if d > 0 && d.Std() < minTimeout {
+		return fmt.Errorf("%s %s is too small, timeout is a duration instead of number of seconds, use duration such as \"250ms\" or \"5s\"", name, d)
+	}
+
+	return nil
+}
+
+func validateNonNegative(name string, n int) error {
+	if n < 0 {
+		return fmt.Errorf("%s must not be negative, got %d", name, n)
+	}
+
+	return nil
+}
+
+// Build creates DefaultHttpRequester from config.
+// Hooks listed in config are looked up by name in hooks, extra opts are applied last.
+func (c RequesterConfig) Build(hooks map[string]Hook, opts ...Option) (*DefaultHttpRequester, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	options := []Option{WithCircuitBreaker(c.CircuitBreaker)}
+	for _, name := range c.Hooks {
+		hook, ok := hooks[name]
+		if !ok {
+			return nil, fmt.Errorf("hook %q is not provided", name)
+		}
+
+		options = append(options, AddHook(hook))
+	}
+
+	client, err := BuildHttpClient(c.HTTP)
+	if err != nil {
+		return nil, err
+	}
+
+	return DefaultClient(client, append(options, opts...)...)
+}
+
+// LoadConfig builds DefaultHttpRequester from JSON or YAML config document.
+// When envPrefix is not empty, environment variables override the document, see RequesterConfig.FromEnv.
+func LoadConfig(doc []byte, envPrefix string, hooks map[string]Hook, opts ...Option) (*DefaultHttpRequester, error) {
+	conf, err := ParseConfig(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if envPrefix != "" {
+		if err := conf.FromEnv(envPrefix); err != nil {
+			return nil, err
+		}
+	}
+
+	return conf.Build(hooks, opts...)
+}
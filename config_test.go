@@ -0,0 +1,172 @@
+package rest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseConfig(t *testing.T) {
+	convey.Convey("Parse config", t, func() {
+		convey.Convey("Should parse YAML document", func() {
+			conf, err := ParseConfig([]byte(`
+http:
+  client:
+    timeout: 2s
+  transport:
+    tls_handshake_timeout: 250ms
+circuit_breaker:
+  name: payment
+  is_active: true
+  timeout: 30s
+  threshold: 3
+  paths: ["/v1/payments"]
+hooks: ["noop"]
+`))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(conf.HTTP.Client.Timeout.Std(), convey.ShouldEqual, 2*time.Second)
+			convey.So(conf.HTTP.Transport.TLSHandshakeTimeout.Std(), convey.ShouldEqual, 250*time.Millisecond)
+			convey.So(conf.CircuitBreaker.Name, convey.ShouldEqual, "payment")
+			convey.So(conf.CircuitBreaker.Threshold, convey.ShouldEqual, 3)
+			convey.So(conf.CircuitBreaker.Paths, convey.ShouldResemble, []string{"/v1/payments"})
+			convey.So(conf.Hooks, convey.ShouldResemble, []string{"noop"})
+		})
+
+		convey.Convey("Should parse JSON document", func() {
+			conf, err := ParseConfig([]byte(`{"http": {"client": {"timeout": "250ms"}}, "circuit_breaker": {"timeout": 10}}`))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(conf.HTTP.Client.Timeout.Std(), convey.ShouldEqual, 250*time.Millisecond)
+			convey.So(conf.CircuitBreaker.Timeout.Std(), convey.ShouldEqual, 10*time.Second)
+		})
+
+		convey.Convey("Should return error on unknown field", func() {
+			_, err := ParseConfig([]byte(`{"http": {"client": {"timeot": "1s"}}}`))
+			convey.So(err, convey.ShouldNotBeNil)
+
+			_, err = ParseConfig([]byte("http:\n  client:\n    timeot: 1s\n"))
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Empty document should return empty config", func() {
+			conf, err := ParseConfig(nil)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(conf, convey.ShouldResemble, RequesterConfig{})
+		})
+	})
+}
+
+func TestRequesterConfigFromEnv(t *testing.T) {
+	convey.Convey("Config from env", t, func() {
+		t.Setenv("TEST_HTTP_CLIENT_TIMEOUT", "250ms")
+		t.Setenv("TEST_CIRCUIT_BREAKER_IS_ACTIVE", "true")
+		t.Setenv("TEST_CIRCUIT_BREAKER_THRESHOLD", "7")
+		t.Setenv("TEST_CIRCUIT_BREAKER_MAX_REQUESTS", "2")
+		t.Setenv("TEST_CIRCUIT_BREAKER_PATHS", "/a, /b")
+		t.Setenv("TEST_HOOKS", "noop")
+
+		convey.Convey("Should override config value", func() {
+			conf := RequesterConfig{}
+			conf.CircuitBreaker.Name = "from-doc"
+
+			convey.So(conf.FromEnv("TEST_"), convey.ShouldBeNil)
+			convey.So(conf.HTTP.Client.Timeout.Std(), convey.ShouldEqual, 250*time.Millisecond)
+			convey.So(conf.CircuitBreaker.Name, convey.ShouldEqual, "from-doc")
+			convey.So(conf.CircuitBreaker.IsActive, convey.ShouldBeTrue)
+			convey.So(conf.CircuitBreaker.Threshold, convey.ShouldEqual, 7)
+			convey.So(conf.CircuitBreaker.MaxRequests, convey.ShouldEqual, uint32(2))
+			convey.So(conf.CircuitBreaker.Paths, convey.ShouldResemble, []string{"/a", "/b"})
+			convey.So(conf.Hooks, convey.ShouldResemble, []string{"noop"})
+		})
+
+		convey.Convey("Should return error on invalid value", func() {
+			t.Setenv("TEST_CIRCUIT_BREAKER_THRESHOLD", "many")
+
+			conf := RequesterConfig{}
+			convey.So(conf.FromEnv("TEST_"), convey.ShouldNotBeNil)
+		})
+	})
+}
+
+func TestRequesterConfigValidate(t *testing.T) {
+	convey.Convey("Config validation", t, func() {
+		convey.Convey("Zero config is valid", func() {
+			convey.So(RequesterConfig{}.Validate(), convey.ShouldBeNil)
+		})
+
+		convey.Convey("Negative or too small timeout is invalid", func() {
+			conf := RequesterConfig{}
+			conf.HTTP.Client.Timeout = Duration(-time.Second)
+			conf.CircuitBreaker.Timeout = 30 // 30ns, most likely meant 30 seconds
+			convey.So(conf.Validate(), convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("TLS handshake longer than client timeout is invalid", func() {
+			conf := Config{}
+			conf.Client.Timeout = Duration(time.Second)
+			conf.Transport.TLSHandshakeTimeout = Duration(2 * time.Second)
+			convey.So(conf.Validate(), convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Idle connection per host more than total is invalid", func() {
+			conf := Config{}
+			conf.Transport.MaxIdleConns = 10
+			conf.Transport.MaxIdleConnsPerHost = 20
+			convey.So(conf.Validate(), convey.ShouldNotBeNil)
+
+			conf.Transport.MaxIdleConns = -1
+			conf.Transport.MaxIdleConnsPerHost = 0
+			convey.So(conf.Validate(), convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Active circuit breaker without paths is invalid", func() {
+			convey.So(CBConfig{IsActive: true}.Validate(), convey.ShouldNotBeNil)
+			convey.So(CBConfig{Threshold: -1}.Validate(), convey.ShouldNotBeNil)
+		})
+	})
+}
+
+func TestLoadConfig(t *testing.T) {
+	convey.Convey("Load config", t, func() {
+		doc := []byte(`
+circuit_breaker:
+  name: test-load-config
+  is_active: true
+  threshold: 1
+  paths: ["/"]
+hooks: ["noop"]
+`)
+
+		convey.Convey("Should build requester with breaker and hooks", func() {
+			client, err := LoadConfig(doc, "", map[string]Hook{"noop": new(NoopHook)})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(client, convey.ShouldNotBeNil)
+			defer client.Close()
+			convey.So(len(client.hook), convey.ShouldEqual, 1)
+
+			info, err := Breaker("test-load-config")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(info.IsActive, convey.ShouldBeTrue)
+		})
+
+		convey.Convey("Should return error when hook is not provided", func() {
+			client, err := LoadConfig(doc, "", nil)
+			convey.So(client, convey.ShouldBeNil)
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Should return error when config is invalid", func() {
+			client, err := LoadConfig([]byte("http:\n  client:\n    timeout: -1s\n"), "", nil)
+			convey.So(client, convey.ShouldBeNil)
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Should return error when env is invalid", func() {
+			t.Setenv("LOAD_HTTP_CLIENT_TIMEOUT", "later")
+
+			client, err := LoadConfig(doc, "LOAD_", map[string]Hook{"noop": new(NoopHook)})
+			convey.So(client, convey.ShouldBeNil)
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
@@ -16,3 +16,18 @@ const httpHeaderSpanPropagatorKey = "Uber-Trace-Id"
 const correlationIDKey = "Correlation-ID"
 
 var ErrHttpTimeout = errors.New("Client.Timeout exceeded while awaiting headers")
+
+// ErrBreakerForcedOpen returned when request is rejected by circuit breaker that manually forced open
+var ErrBreakerForcedOpen = errors.New("circuit breaker is forced open")
+
+// ErrBreakerNotFound returned when no circuit breaker registered with the given name
+var ErrBreakerNotFound = errors.New("circuit breaker not found")
+
+// ErrCertificatePinMismatch returned when server certificate doesn't match any of ConfigTLS.PinnedSPKI
+var ErrCertificatePinMismatch = errors.New("server certificate doesn't match pinned public key")
+
+// ErrUnsupportedMediaType returned when no codec registered for the media type
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// ErrResponseTooLarge returned when response body is bigger than the limit, see WithMaxResponseBytes
+var ErrResponseTooLarge = errors.New("response body too large")
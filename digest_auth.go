@@ -0,0 +1,375 @@
+package rest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DigestAuth authorizes request using HTTP Digest authentication (RFC 7616), see WithDigestAuth.
+// The challenge of each host is cached, so following requests are authorized without 401 round trip.
+type DigestAuth struct {
+	username string
+	password string
+	cnonce   func() string
+
+	mu         sync.Mutex
+	challenges map[string]*digestChallenge
+}
+
+// digestChallenge is the parsed WWW-Authenticate Digest challenge.
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       []string
+	userhash  bool
+	stale     bool
+
+	nc uint32 // nonce count, guarded by DigestAuth.mu
+}
+
+// NewDigestAuth returns DigestAuth using username and password.
+func NewDigestAuth(username, password string) *DigestAuth {
+	return &DigestAuth{
+		username:   username,
+		password:   password,
+		cnonce:     randomCnonce,
+		challenges: make(map[string]*digestChallenge),
+	}
+}
+
+// do sends request, and sends it once more with Authorization when server returns Digest challenge.
+func (d *DigestAuth) do(request *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	host := request.URL.Host
+
+	authorized, preemptive, err := d.authorize(request, host)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := send(authorized)
+	if resp == nil {
+		return resp, err
+	}
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		d.nextNonce(host, resp.Header.Get("Authentication-Info"))
+		return resp, err
+	}
+
+	challenge, ok := parseDigestChallenge(resp.Header.Values("WWW-Authenticate"))
+	// wrong credentials, unless the cached nonce is expired
+	if !ok || preemptive != nil && !challenge.stale && challenge.nonce == preemptive.nonce {
+		return resp, err
+	}
+
+	body, known, errBody := readBody(request)
+	if errBody != nil || !known {
+		return resp, err
+	}
+
+	d.mu.Lock()
+	d.challenges[host] = challenge
+	d.mu.Unlock()
+
+	_, _ = ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	retry, _, err := d.authorize(request, host)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		retry.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	return send(retry)
+}
+
+// authorize returns a copy of request with Authorization using cached challenge of host,
+// or request as is when there is no challenge.
+func (d *DigestAuth) authorize(request *http.Request, host string) (*http.Request, *digestChallenge, error) {
+	d.mu.Lock()
+	challenge, ok := d.challenges[host]
+	if !ok {
+		d.mu.Unlock()
+		return request, nil, nil
+	}
+
+	challenge.nc++
+	nc := challenge.nc
+	cached := *challenge
+	d.mu.Unlock()
+
+	authorization, err := d.authorization(request, &cached, nc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	authorized := request.Clone(request.Context())
+	authorized.Header.Set("Authorization", authorization)
+	return authorized, &cached, nil
+}
+
+// authorization computes Authorization header value (RFC 7616 section 3.4).
+func (d *DigestAuth) authorization(request *http.Request, challenge *digestChallenge, nc uint32) (string, error) {
+	hash, sess, err := digestHash(challenge.algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	qop := ""
+	for _, offered := range challenge.qop {
+		if offered == "auth" {
+			qop = "auth"
+			break
+		}
+
+		if offered == "auth-int" {
+			qop = "auth-int"
+		}
+	}
+
+	if len(challenge.qop) > 0 && qop == "" {
+		return "", fmt.Errorf("unsupported digest qop %s", strings.Join(challenge.qop, ", "))
+	}
+
+	uri := request.URL.RequestURI()
+	cnonce := d.cnonce()
+	ncValue := fmt.Sprintf("%08x", nc)
+
+	ha1 := hash(d.username + ":" + challenge.realm + ":" + d.password)
+	if sess {
+		ha1 = hash(ha1 + ":" + challenge.nonce + ":" + cnonce)
+	}
+
+	a2 := request.Method + ":" + uri
+	if qop == "auth-int" {
+		body, known, err := readBody(request)
+		if err != nil || !known {
+			return "", errors.New("digest qop auth-int can't hash streamed body")
+		}
+
+		a2 += ":" + hash(string(body))
+	}
+
+	var response string
+	if qop == "" {
+		response = hash(ha1 + ":" + challenge.nonce + ":" + hash(a2))
+	} else {
+		response = hash(strings.Join([]string{ha1, challenge.nonce, ncValue, cnonce, qop, hash(a2)}, ":"))
+	}
+
+	username := d.username
+	if challenge.userhash {
+		username = hash(d.username + ":" + challenge.realm)
+	}
+
+	params := []string{
+		"username=" + quoteString(username),
+		"realm=" + quoteString(challenge.realm),
+		"uri=" + quoteString(uri),
+	}
+
+	if challenge.algorithm != "" {
+		params = append(params, "algorithm="+challenge.algorithm)
+	}
+
+	params = append(params, "nonce="+quoteString(challenge.nonce))
+	if qop != "" {
+		params = append(params, "nc="+ncValue, "cnonce="+quoteString(cnonce), "qop="+qop)
+	}
+
+	params = append(params, "response="+quoteString(response))
+	if challenge.opaque != "" {
+		params = append(params, "opaque="+quoteString(challenge.opaque))
+	}
+
+	if challenge.userhash {
+		params = append(params, "userhash=true")
+	}
+
+	return "Digest " + strings.Join(params, ", "), nil
+}
+
+// nextNonce replaces the cached nonce with nextnonce of Authentication-Info (RFC 7616 section 3.5).
+func (d *DigestAuth) nextNonce(host, authenticationInfo string) {
+	if authenticationInfo == "" {
+		return
+	}
+
+	for _, challenge := range parseAuthParams(authenticationInfo) {
+		next, ok := challenge["nextnonce"]
+		if !ok {
+			continue
+		}
+
+		d.mu.Lock()
+		if cached, ok := d.challenges[host]; ok && cached.nonce != next {
+			cached.nonce = next
+			cached.nc = 0
+		}
+		d.mu.Unlock()
+	}
+}
+
+// digestHash returns hash function of algorithm, and whether it's session variant.
+func digestHash(algorithm string) (func(string) string, bool, error) {
+	name := strings.ToUpper(algorithm)
+	sess := strings.HasSuffix(name, "-SESS")
+	name = strings.TrimSuffix(name, "-SESS")
+
+	switch name {
+	case "", "MD5":
+		return func(s string) string {
+			sum := md5.Sum([]byte(s))
+			return hex.EncodeToString(sum[:])
+		}, sess, nil
+	case "SHA-256":
+		return func(s string) string {
+			sum := sha256.Sum256([]byte(s))
+			return hex.EncodeToString(sum[:])
+		}, sess, nil
+	case "SHA-512-256":
+		return func(s string) string {
+			sum := sha512.Sum512_256([]byte(s))
+			return hex.EncodeToString(sum[:])
+		}, sess, nil
+	default:
+		return nil, false, fmt.Errorf("unsupported digest algorithm %s", algorithm)
+	}
+}
+
+// digestAlgorithmRank prefers stronger algorithm when server offers several challenges.
+var digestAlgorithmRank = map[string]int{
+	"":                 1,
+	"MD5":              1,
+	"MD5-SESS":         1,
+	"SHA-256":          2,
+	"SHA-256-SESS":     2,
+	"SHA-512-256":      3,
+	"SHA-512-256-SESS": 3,
+}
+
+// parseDigestChallenge returns the strongest supported Digest challenge in WWW-Authenticate headers.
+func parseDigestChallenge(headers []string) (*digestChallenge, bool) {
+	var best *digestChallenge
+	for _, header := range headers {
+		for _, params := range parseAuthParams(header) {
+			if !strings.EqualFold(params[""], "digest") {
+				continue
+			}
+
+			challenge := &digestChallenge{
+				realm:     params["realm"],
+				nonce:     params["nonce"],
+				opaque:    params["opaque"],
+				algorithm: params["algorithm"],
+				userhash:  strings.EqualFold(params["userhash"], "true"),
+				stale:     strings.EqualFold(params["stale"], "true"),
+			}
+
+			for _, qop := range strings.Split(params["qop"], ",") {
+				if qop = strings.TrimSpace(qop); qop != "" {
+					challenge.qop = append(challenge.qop, qop)
+				}
+			}
+
+			rank, ok := digestAlgorithmRank[strings.ToUpper(challenge.algorithm)]
+			if !ok || challenge.nonce == "" {
+				continue
+			}
+
+			if best == nil || rank > digestAlgorithmRank[strings.ToUpper(best.algorithm)] {
+				best = challenge
+			}
+		}
+	}
+
+	return best, best != nil
+}
+
+// parseAuthParams parses challenges of WWW-Authenticate or params of Authentication-Info (RFC 7235 section 2.1),
+// the scheme of each challenge is keyed by empty string.
+func parseAuthParams(header string) []map[string]string {
+	var (
+		challenges []map[string]string
+		current    map[string]string
+	)
+
+	for i := 0; i < len(header); {
+		// skip separators
+		if c := header[i]; c == ' ' || c == '\t' || c == ',' {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(header) && !strings.ContainsRune(" \t,=", rune(header[i])) {
+			i++
+		}
+		token := header[start:i]
+
+		j := i
+		for j < len(header) && (header[j] == ' ' || header[j] == '\t') {
+			j++
+		}
+
+		if j >= len(header) || header[j] != '=' {
+			// a token without "=" starts a new challenge
+			current = map[string]string{"": token}
+			challenges = append(challenges, current)
+			continue
+		}
+
+		i = j + 1
+		for i < len(header) && (header[i] == ' ' || header[i] == '\t') {
+			i++
+		}
+
+		var value strings.Builder
+		if i < len(header) && header[i] == '"' {
+			for i++; i < len(header) && header[i] != '"'; i++ {
+				if header[i] == '\\' && i+1 < len(header) {
+					i++
+				}
+				value.WriteByte(header[i])
+			}
+			i++
+		} else {
+			for i < len(header) && !strings.ContainsRune(" \t,", rune(header[i])) {
+				value.WriteByte(header[i])
+				i++
+			}
+		}
+
+		if current == nil {
+			current = map[string]string{}
+			challenges = append(challenges, current)
+		}
+
+		if token != "" {
+			current[strings.ToLower(token)] = value.String()
+		}
+	}
+
+	return challenges
+}
+
+func randomCnonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
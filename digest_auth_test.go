@@ -0,0 +1,165 @@
+package rest
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestDigestAuthorization(t *testing.T) {
+	convey.Convey("RFC 7616 section 3.9.1 example", t, func() {
+		auth := NewDigestAuth("Mufasa", "Circle of Life")
+		auth.cnonce = func() string { return "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ" }
+
+		request, _ := http.NewRequest(http.MethodGet, "http://www.example.org/dir/index.html", nil)
+		header := `Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=SHA-256, ` +
+			`nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS", ` +
+			`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=MD5, ` +
+			`nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`
+
+		convey.Convey("Should prefer SHA-256 challenge", func() {
+			challenge, ok := parseDigestChallenge([]string{`Basic realm="x"`, header})
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(challenge.algorithm, convey.ShouldEqual, "SHA-256")
+			convey.So(challenge.qop, convey.ShouldResemble, []string{"auth", "auth-int"})
+
+			authorization, err := auth.authorization(request, challenge, 1)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(authorization, convey.ShouldEqual, `Digest username="Mufasa", realm="http-auth@example.org", `+
+				`uri="/dir/index.html", algorithm=SHA-256, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", `+
+				`nc=00000001, cnonce="f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", qop=auth, `+
+				`response="753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1", `+
+				`opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`)
+		})
+
+		convey.Convey("Should compute MD5 response", func() {
+			challenge, _ := parseDigestChallenge([]string{strings.SplitN(header, ", Digest ", 2)[1]})
+			convey.So(challenge, convey.ShouldBeNil)
+
+			challenge, _ = parseDigestChallenge([]string{"Digest " + strings.SplitN(header, ", Digest ", 2)[1]})
+			authorization, err := auth.authorization(request, challenge, 1)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(authorization, convey.ShouldContainSubstring, `response="8ca523f5e9506fed4657c9700eebdbec"`)
+		})
+
+		convey.Convey("Should hash body for auth-int and username for userhash", func() {
+			challenge := &digestChallenge{realm: "r", nonce: "n", qop: []string{"auth-int"}, userhash: true}
+			post, _ := http.NewRequest(http.MethodPost, "http://www.example.org/", strings.NewReader("body"))
+
+			authorization, err := auth.authorization(post, challenge, 1)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(authorization, convey.ShouldContainSubstring, "qop=auth-int")
+			convey.So(authorization, convey.ShouldContainSubstring, `username="`+md5Hex("Mufasa:r")+`"`)
+			convey.So(authorization, convey.ShouldEndWith, "userhash=true")
+
+			post.GetBody = nil
+			_, err = auth.authorization(post, challenge, 1)
+			convey.So(err, convey.ShouldNotBeNil)
+
+			_, err = auth.authorization(post, &digestChallenge{algorithm: "SHA-1"}, 1)
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// newDigestServer verifies MD5 qop=auth Digest, nonce changes to "n2" after stale is set.
+func newDigestServer(stale *int32, challenges *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce := "n1"
+		if atomic.LoadInt32(stale) == 1 {
+			nonce = "n2"
+		}
+
+		var params map[string]string
+		if list := parseAuthParams(r.Header.Get("Authorization")); len(list) > 0 {
+			params = list[0]
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		ha1 := md5Hex("user:realm:pass")
+		ha2 := md5Hex(r.Method + ":" + r.URL.RequestURI())
+		want := md5Hex(strings.Join([]string{ha1, params["nonce"], params["nc"], params["cnonce"], "auth", ha2}, ":"))
+
+		if params == nil || params["response"] != want || params["nonce"] != nonce {
+			atomic.AddInt32(challenges, 1)
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="realm", qop="auth", nonce="%s", stale=%t`,
+				nonce, params != nil && params["response"] == want))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		_, _ = fmt.Fprintf(w, `{"nc": "%s", "body": %q}`, params["nc"], body)
+	}))
+}
+
+func TestWithDigestAuth(t *testing.T) {
+	convey.Convey("Test WithDigestAuth", t, func() {
+		ctx := context.Background()
+		var stale, challenges int32
+		server := newDigestServer(&stale, &challenges)
+		defer server.Close()
+
+		hook := new(lastHook)
+		client, err := DefaultClient(http.DefaultClient, WithDigestAuth("user", "pass"), AddHook(hook))
+		convey.So(err, convey.ShouldBeNil)
+
+		convey.Convey("Should answer challenge, replay body and track nonce count", func() {
+			resp, err := client.Post(ctx, "", server.URL+"/a", http.Header{}, []byte(`{"id": 1}`))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusOK)
+			convey.So(string(resp.RespBody), convey.ShouldEqual, `{"nc": "00000001", "body": "{\"id\": 1}"}`)
+			convey.So(hook.data.Request.Header.Get("Authorization"), convey.ShouldBeEmpty)
+
+			resp, err = client.Get(ctx, "", server.URL+"/b?q=1", http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(string(resp.RespBody), convey.ShouldEqual, `{"nc": "00000002", "body": ""}`)
+			convey.So(atomic.LoadInt32(&challenges), convey.ShouldEqual, 1)
+
+			convey.Convey("Should retry with new nonce when stale", func() {
+				atomic.StoreInt32(&stale, 1)
+
+				resp, err := client.Get(ctx, "", server.URL+"/c", http.Header{})
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(string(resp.RespBody), convey.ShouldEqual, `{"nc": "00000001", "body": ""}`)
+				convey.So(atomic.LoadInt32(&challenges), convey.ShouldEqual, 2)
+			})
+		})
+
+		convey.Convey("Should return 401 for wrong password", func() {
+			client, _ := DefaultClient(http.DefaultClient, WithDigestAuth("user", "wrong"))
+
+			resp, err := client.Get(ctx, "", server.URL+"/", http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusUnauthorized)
+			convey.So(atomic.LoadInt32(&challenges), convey.ShouldEqual, 2)
+		})
+
+		convey.Convey("Should not replay streamed body", func() {
+			resp, err := client.PostMultipart(ctx, "", server.URL+"/", http.Header{}, NewMultipart().Field("a", "1"))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusUnauthorized)
+		})
+
+		convey.Convey("Should not be used with token source", func() {
+			_, err := DefaultClient(http.DefaultClient, WithDigestAuth("user", "pass"), WithTokenSource(&ClientCredentials{}))
+			convey.So(err, convey.ShouldNotBeNil)
+
+			_, err = DefaultClient(http.DefaultClient, WithTokenSource(&ClientCredentials{}), WithDigestAuth("user", "pass"))
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
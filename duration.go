@@ -0,0 +1,83 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is time.Duration that can be read from JSON, YAML and environment variables
+// using Go duration string such as "250ms" or "1m30s".
+// For backward compatibility, plain number is read as seconds.
+type Duration time.Duration
+
+// Std returns Duration as time.Duration.
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+// String returns Go duration string, e.g. "250ms".
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalText encodes Duration as Go duration string.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText parses Go duration string, or number in seconds.
+func (d *Duration) UnmarshalText(text []byte) error {
+	value := string(text)
+	if value == "" {
+		*d = 0
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err == nil {
+		*d = Duration(parsed)
+		return nil
+	}
+
+	seconds, errFloat := strconv.ParseFloat(value, 64)
+	if errFloat != nil {
+		return fmt.Errorf("invalid duration %q: %s", value, err.Error())
+	}
+
+	*d = Duration(seconds * float64(time.Second))
+	return nil
+}
+
+// UnmarshalJSON accepts both string "250ms" and number in seconds.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		*d = 0
+		return nil
+	case float64:
+		*d = Duration(v * float64(time.Second))
+		return nil
+	case string:
+		return d.UnmarshalText([]byte(v))
+	default:
+		return fmt.Errorf("invalid duration %s", string(data))
+	}
+}
+
+// UnmarshalYAML accepts both string "250ms" and number in seconds.
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("invalid duration at line %d: must be a scalar", node.Line)
+	}
+
+	return d.UnmarshalText([]byte(node.Value))
+}
@@ -0,0 +1,55 @@
+package rest
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDurationUnmarshal(t *testing.T) {
+	convey.Convey("Duration unmarshal", t, func() {
+		convey.Convey("JSON string should be parsed as Go duration", func() {
+			var d Duration
+			convey.So(json.Unmarshal([]byte(`"250ms"`), &d), convey.ShouldBeNil)
+			convey.So(d.Std(), convey.ShouldEqual, 250*time.Millisecond)
+		})
+
+		convey.Convey("JSON number should be parsed as seconds", func() {
+			var d Duration
+			convey.So(json.Unmarshal([]byte(`1.5`), &d), convey.ShouldBeNil)
+			convey.So(d.Std(), convey.ShouldEqual, 1500*time.Millisecond)
+		})
+
+		convey.Convey("JSON invalid value should return error", func() {
+			var d Duration
+			convey.So(json.Unmarshal([]byte(`"soon"`), &d), convey.ShouldNotBeNil)
+			convey.So(json.Unmarshal([]byte(`true`), &d), convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("YAML string and number should be parsed", func() {
+			var v struct {
+				A Duration `yaml:"a"`
+				B Duration `yaml:"b"`
+			}
+			convey.So(yaml.Unmarshal([]byte("a: 1m30s\nb: 2"), &v), convey.ShouldBeNil)
+			convey.So(v.A.Std(), convey.ShouldEqual, 90*time.Second)
+			convey.So(v.B.Std(), convey.ShouldEqual, 2*time.Second)
+		})
+
+		convey.Convey("YAML non scalar should return error", func() {
+			var v struct {
+				A Duration `yaml:"a"`
+			}
+			convey.So(yaml.Unmarshal([]byte("a: [1]"), &v), convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Marshal should write Go duration string", func() {
+			b, err := json.Marshal(Duration(250 * time.Millisecond))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(string(b), convey.ShouldEqual, `"250ms"`)
+		})
+	})
+}
@@ -0,0 +1,326 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoadBalancePolicy chooses the endpoint of each request, see WithEndpoints.
+type LoadBalancePolicy string
+
+const (
+	// RoundRobin sends requests to each endpoint in turn.
+	RoundRobin LoadBalancePolicy = "round_robin"
+	// LeastOutstanding sends request to the endpoint with the fewest requests in flight.
+	LeastOutstanding LoadBalancePolicy = "least_outstanding"
+	// WeightedRandom sends request to a random endpoint, chance is proportional to Endpoint.Weight.
+	WeightedRandom LoadBalancePolicy = "weighted_random"
+)
+
+// Endpoint is a base URL of the service, e.g. "http://10.0.0.1:8080" or "https://host/api".
+type Endpoint struct {
+	URL    string `json:"url" yaml:"url"`
+	Weight int    `json:"weight" yaml:"weight"` // used by WeightedRandom, default 1
+}
+
+// EndpointsConfig configures WithEndpoints.
+type EndpointsConfig struct {
+	// Service is the logical host name in request path, e.g. "payments" in "http://payments/v1/charges".
+	Service   string            `json:"service" yaml:"service"`
+	Endpoints []Endpoint        `json:"endpoints" yaml:"endpoints"`
+	Policy    LoadBalancePolicy `json:"policy" yaml:"policy"` // default RoundRobin
+	// KeepHost sends the logical service host in Host header instead of the endpoint host, see rewriteHost.
+	KeepHost bool `json:"keep_host" yaml:"keep_host"`
+
+	// MaxFailures is the number of consecutive failures, error or 5xx status, after which
+	// the endpoint is ejected for EjectionTime. Default 5, negative disables ejection.
+	MaxFailures  int      `json:"max_failures" yaml:"max_failures"`
+	EjectionTime Duration `json:"ejection_time" yaml:"ejection_time"` // default 30 seconds
+
+	// HealthCheckPath is joined to every endpoint URL and requested with GET every HealthCheckInterval,
+	// endpoint is healthy when it returns 2xx. Empty disables health check.
+	// Checks run in background until DefaultHttpRequester.Close is called.
+	HealthCheckPath     string     `json:"health_check_path" yaml:"health_check_path"`
+	HealthCheckInterval Duration   `json:"health_check_interval" yaml:"health_check_interval"` // default 10 seconds
+	HealthCheckTimeout  Duration   `json:"health_check_timeout" yaml:"health_check_timeout"`   // default 2 seconds
+	HealthCheckClient   HttpClient `json:"-" yaml:"-"`                                         // default the client given to DefaultClient, without options
+}
+
+// Validate returns error when config is invalid.
+func (c EndpointsConfig) Validate() error {
+	var errs []error
+	if c.Service == "" {
+		errs = append(errs, errors.New("service name is empty"))
+	}
+
+	if len(c.Endpoints) == 0 {
+		errs = append(errs, fmt.Errorf("service %s has no endpoint", c.Service))
+	}
+
+	for _, endpoint := range c.Endpoints {
+		u, err := url.Parse(endpoint.URL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("endpoint %q of service %s is not absolute URL", endpoint.URL, c.Service))
+		}
+
+		if endpoint.Weight < 0 {
+			errs = append(errs, fmt.Errorf("endpoint %q of service %s has negative weight", endpoint.URL, c.Service))
+		}
+	}
+
+	switch c.Policy {
+	case "", RoundRobin, LeastOutstanding, WeightedRandom:
+	default:
+		errs = append(errs, fmt.Errorf("unknown load balance policy %q", c.Policy))
+	}
+
+	return errors.Join(errs...)
+}
+
+// endpointState is an endpoint with its health, guarded by balancer mu.
+type endpointState struct {
+	url         *url.URL
+	weight      int
+	outstanding int
+	failures    int
+	ejectedTill time.Time
+	unhealthy   bool
+}
+
+func (e *endpointState) available(now time.Time) bool {
+	return !e.unhealthy && !now.Before(e.ejectedTill)
+}
+
+// balancer sends requests to the logical service host to one of its endpoints.
+type balancer struct {
+	client HttpClient
+	conf   EndpointsConfig
+	random func(n int) int
+
+	mu        sync.Mutex
+	endpoints []*endpointState
+	next      int
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
+	once    sync.Once
+}
+
+func newBalancer(conf EndpointsConfig, client HttpClient) *balancer {
+	b := &balancer{client: client, conf: conf, random: rand.Intn, stop: make(chan struct{})}
+	for _, endpoint := range conf.Endpoints {
+		u, _ := url.Parse(endpoint.URL)
+		weight := endpoint.Weight
+		if weight == 0 {
+			weight = 1
+		}
+
+		b.endpoints = append(b.endpoints, &endpointState{url: u, weight: weight})
+	}
+
+	if conf.HealthCheckPath != "" {
+		b.stopped.Add(1)
+		go b.healthCheckLoop()
+	}
+
+	return b
+}
+
+// Close stops health checks.
+func (b *balancer) Close() error {
+	b.once.Do(func() {
+		close(b.stop)
+	})
+
+	b.stopped.Wait()
+	return nil
+}
+
+// Do sends request to one of the endpoints, see rewriteHost for its Host header.
+func (b *balancer) Do(request *http.Request) (*http.Response, error) {
+	if !strings.EqualFold(request.URL.Host, b.conf.Service) {
+		return b.client.Do(request)
+	}
+
+	endpoint := b.pick()
+	out := request.Clone(request.Context())
+	out.URL = endpointURL(endpoint.url, request.URL)
+	out.Host = rewriteHost(request, b.conf.KeepHost)
+
+	resp, err := b.client.Do(out)
+	b.release(endpoint, err != nil || resp == nil || resp.StatusCode >= http.StatusInternalServerError)
+	return resp, err
+}
+
+// rewriteHost returns Host header of request sent to another host by WithEndpoints or WithSRV.
+// It is empty, so the target host is sent, unless keep is set or the request is signed,
+// since signers run before the request is rewritten and have signed the logical host.
+func rewriteHost(request *http.Request, keep bool) string {
+	if keep || isSigned(request.Context()) {
+		return requestHost(request)
+	}
+
+	return ""
+}
+
+// pick chooses endpoint by policy among available endpoints, or among all endpoints when none is available,
+// so a wrong health check or ejection doesn't cut the whole service off.
+func (b *balancer) pick() *endpointState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	candidates := make([]*endpointState, 0, len(b.endpoints))
+	for _, endpoint := range b.endpoints {
+		if endpoint.available(now) {
+			candidates = append(candidates, endpoint)
+		}
+	}
+
+	if len(candidates) == 0 {
+		candidates = b.endpoints
+	}
+
+	var picked *endpointState
+	switch b.conf.Policy {
+	case LeastOutstanding:
+		// start from the next endpoint, so ties are spread in turn
+		start := b.next % len(candidates)
+		b.next++
+		for i := range candidates {
+			candidate := candidates[(start+i)%len(candidates)]
+			if picked == nil || candidate.outstanding < picked.outstanding {
+				picked = candidate
+			}
+		}
+	case WeightedRandom:
+		total := 0
+		for _, candidate := range candidates {
+			total += candidate.weight
+		}
+
+		roll := b.random(total)
+		for _, candidate := range candidates {
+			if roll < candidate.weight {
+				picked = candidate
+				break
+			}
+			roll -= candidate.weight
+		}
+	default:
+		picked = candidates[b.next%len(candidates)]
+		b.next++
+	}
+
+	picked.outstanding++
+	return picked
+}
+
+// release records result of the request sent to endpoint.
+func (b *balancer) release(endpoint *endpointState, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	endpoint.outstanding--
+	if !failed {
+		endpoint.failures = 0
+		return
+	}
+
+	endpoint.failures++
+	if b.conf.MaxFailures > 0 && endpoint.failures >= b.conf.MaxFailures {
+		endpoint.ejectedTill = time.Now().Add(b.conf.EjectionTime.Std())
+		endpoint.failures = 0
+	}
+}
+
+// healthCheckLoop checks every endpoint right away, then every HealthCheckInterval until Close is called,
+// so endpoints are marked healthy or unhealthy even while the requester is idle.
+func (b *balancer) healthCheckLoop() {
+	defer b.stopped.Done()
+
+	ticker := time.NewTicker(b.conf.HealthCheckInterval.Std())
+	defer ticker.Stop()
+
+	for {
+		b.healthCheck()
+
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// healthCheck checks every endpoint concurrently and updates their health.
+func (b *balancer) healthCheck() {
+	b.mu.Lock()
+	endpoints := append([]*endpointState(nil), b.endpoints...)
+	b.mu.Unlock()
+
+	healthy := make([]bool, len(endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func(i int, endpoint *endpointState) {
+			defer wg.Done()
+			healthy[i] = b.check(endpoint.url)
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, endpoint := range endpoints {
+		endpoint.unhealthy = !healthy[i]
+		if healthy[i] {
+			endpoint.ejectedTill = time.Time{}
+		}
+	}
+}
+
+func (b *balancer) check(base *url.URL) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), b.conf.HealthCheckTimeout.Std())
+	defer cancel()
+
+	target, err := url.Parse(b.conf.HealthCheckPath)
+	if err != nil {
+		return false
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpointURL(base, target).String(), nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := b.conf.HealthCheckClient.Do(request)
+	if err != nil {
+		return false
+	}
+
+	_ = resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode <= 299
+}
+
+// endpointURL returns target path and query on the endpoint base URL.
+func endpointURL(base, target *url.URL) *url.URL {
+	u := *base
+	u.Path = strings.TrimSuffix(base.Path, "/") + "/" + strings.TrimPrefix(target.Path, "/")
+	u.RawPath = ""
+	if target.RawPath != "" {
+		u.RawPath = strings.TrimSuffix(base.EscapedPath(), "/") + "/" + strings.TrimPrefix(target.RawPath, "/")
+	}
+
+	u.RawQuery = target.RawQuery
+	u.Fragment = ""
+	return &u
+}
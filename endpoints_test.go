@@ -0,0 +1,247 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// newEndpointServer answers its name, or 500 while failing is set, and /api/health answers 503 while down is set.
+func newEndpointServer(name string, failing, down *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/health" {
+			if atomic.LoadInt32(down) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			return
+		}
+
+		if atomic.LoadInt32(failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		_, _ = w.Write([]byte(name + " " + r.URL.RequestURI()))
+	}))
+}
+
+func TestWithEndpoints(t *testing.T) {
+	convey.Convey("Test WithEndpoints", t, func() {
+		ctx := context.Background()
+		var failing, down [3]int32
+		var endpoints []Endpoint
+		for i, name := range []string{"a", "b", "c"} {
+			server := newEndpointServer(name, &failing[i], &down[i])
+			defer server.Close()
+			endpoints = append(endpoints, Endpoint{URL: server.URL + "/api"})
+		}
+
+		names := func(client *DefaultHttpRequester, n int) []string {
+			var got []string
+			for i := 0; i < n; i++ {
+				resp, err := client.Get(ctx, "", "http://payments/v1/charges?id=1", http.Header{})
+				convey.So(err, convey.ShouldBeNil)
+				got = append(got, string(resp.RespBody[:1]))
+			}
+			return got
+		}
+
+		convey.Convey("Should rewrite logical host with round robin", func() {
+			client, err := DefaultClient(http.DefaultClient, WithEndpoints(EndpointsConfig{Service: "payments", Endpoints: endpoints}))
+			convey.So(err, convey.ShouldBeNil)
+
+			resp, _ := client.Get(ctx, "", "http://payments/v1/charges?id=1", http.Header{})
+			convey.So(string(resp.RespBody), convey.ShouldEqual, "a /api/v1/charges?id=1")
+			convey.So(names(client, 4), convey.ShouldResemble, []string{"b", "c", "a", "b"})
+
+			resp, err = client.Get(ctx, "", endpoints[2].URL+"/direct", http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(string(resp.RespBody), convey.ShouldEqual, "c /api/direct")
+		})
+
+		convey.Convey("Should eject endpoint after consecutive failures and bring it back after ejection time", func() {
+			client, _ := DefaultClient(http.DefaultClient, WithEndpoints(EndpointsConfig{
+				Service:      "payments",
+				Endpoints:    endpoints,
+				MaxFailures:  2,
+				EjectionTime: Duration(100 * time.Millisecond),
+			}))
+
+			atomic.StoreInt32(&failing[1], 1)
+			convey.So(names(client, 6), convey.ShouldResemble, []string{"a", "b", "c", "a", "b", "c"})
+			convey.So(names(client, 4), convey.ShouldResemble, []string{"a", "c", "a", "c"})
+
+			atomic.StoreInt32(&failing[1], 0)
+			time.Sleep(100 * time.Millisecond)
+			convey.So(names(client, 3), convey.ShouldContain, "b")
+		})
+
+		convey.Convey("Should skip endpoint failing health check while the client is idle", func() {
+			atomic.StoreInt32(&down[0], 1)
+			client, _ := DefaultClient(http.DefaultClient, WithEndpoints(EndpointsConfig{
+				Service:             "payments",
+				Endpoints:           endpoints,
+				HealthCheckPath:     "/health",
+				HealthCheckInterval: Duration(20 * time.Millisecond),
+			}))
+			defer client.Close()
+
+			time.Sleep(50 * time.Millisecond)
+			convey.So(names(client, 4), convey.ShouldNotContain, "a")
+
+			atomic.StoreInt32(&down[0], 0)
+			time.Sleep(50 * time.Millisecond)
+			convey.So(names(client, 3), convey.ShouldContain, "a")
+
+			convey.So(client.Close(), convey.ShouldBeNil)
+			atomic.StoreInt32(&down[0], 1)
+			time.Sleep(50 * time.Millisecond)
+			convey.So(names(client, 3), convey.ShouldContain, "a")
+		})
+
+		convey.Convey("Should use every endpoint when none is available", func() {
+			for i := range down {
+				atomic.StoreInt32(&down[i], 1)
+			}
+
+			client, _ := DefaultClient(http.DefaultClient, WithEndpoints(EndpointsConfig{
+				Service:         "payments",
+				Endpoints:       endpoints,
+				HealthCheckPath: "/health",
+			}))
+			defer client.Close()
+
+			time.Sleep(50 * time.Millisecond)
+			convey.So(names(client, 3), convey.ShouldResemble, []string{"a", "b", "c"})
+		})
+
+		convey.Convey("Should send health check with the client given to DefaultClient", func() {
+			var probes int32
+			upstream := &mockClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&probes, 1)
+				return doFuncMock([]byte(`{}`), nil)(req)
+			}}
+
+			client, _ := DefaultClient(upstream,
+				WithCircuitBreaker(CBConfig{Name: "endpoints-health", Timeout: Duration(time.Second)}),
+				WithCache(NewMemoryCacheStore(10)),
+				WithEndpoints(EndpointsConfig{
+					Service:         "payments",
+					Endpoints:       []Endpoint{{URL: "http://a"}},
+					HealthCheckPath: "/health",
+				}),
+			)
+			defer client.Close()
+
+			b := client.client.(*balancer)
+			convey.So(b.conf.HealthCheckClient, convey.ShouldEqual, upstream)
+			time.Sleep(20 * time.Millisecond)
+			convey.So(atomic.LoadInt32(&probes), convey.ShouldEqual, 1)
+		})
+
+		convey.Convey("Should send endpoint host, or logical host when kept or signed", func() {
+			var host string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				host = r.Host
+			}))
+			defer server.Close()
+
+			conf := EndpointsConfig{Service: "payments", Endpoints: []Endpoint{{URL: server.URL}}}
+			client, _ := DefaultClient(http.DefaultClient, WithEndpoints(conf))
+			_, err := client.Get(ctx, "", "http://payments/v1/charges", http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(host, convey.ShouldEqual, server.Listener.Addr().String())
+
+			conf.KeepHost = true
+			client, _ = DefaultClient(http.DefaultClient, WithEndpoints(conf))
+			_, _ = client.Get(ctx, "", "http://payments/v1/charges", http.Header{})
+			convey.So(host, convey.ShouldEqual, "payments")
+
+			conf.KeepHost = false
+			client, _ = DefaultClient(http.DefaultClient, WithEndpoints(conf), WithHMAC(HMACConfig{Secret: []byte("secret")}))
+			_, _ = client.Get(ctx, "", "http://payments/v1/charges", http.Header{})
+			convey.So(host, convey.ShouldEqual, "payments")
+		})
+
+		convey.Convey("Should not panic when client returns no response and no error", func() {
+			client, _ := DefaultClient(&mockClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+				return nil, nil
+			}}, WithEndpoints(EndpointsConfig{Service: "payments", Endpoints: endpoints}))
+
+			convey.So(func() {
+				_, _ = client.Get(ctx, "", "http://payments/v1/charges", http.Header{})
+			}, convey.ShouldNotPanic)
+		})
+
+		convey.Convey("Should pick by weight and by outstanding requests", func() {
+			b := newBalancer(EndpointsConfig{
+				Service:   "payments",
+				Endpoints: []Endpoint{{URL: "http://a", Weight: 1}, {URL: "http://b", Weight: 3}},
+				Policy:    WeightedRandom,
+			}, http.DefaultClient)
+
+			for roll, want := range []string{"a", "b", "b", "b"} {
+				roll := roll
+				b.random = func(n int) int { return roll }
+				convey.So(b.pick().url.Host, convey.ShouldEqual, want)
+			}
+
+			b = newBalancer(EndpointsConfig{
+				Service:   "payments",
+				Endpoints: []Endpoint{{URL: "http://a"}, {URL: "http://b"}, {URL: "http://c"}},
+				Policy:    LeastOutstanding,
+			}, http.DefaultClient)
+
+			a := b.pick()
+			c := b.pick()
+			convey.So(a.url.Host, convey.ShouldEqual, "a")
+			convey.So(c.url.Host, convey.ShouldEqual, "b")
+			convey.So(b.pick().url.Host, convey.ShouldEqual, "c")
+
+			b.release(a, false)
+			convey.So(b.pick().url.Host, convey.ShouldEqual, "a")
+		})
+
+		convey.Convey("Should balance concurrent requests without race", func() {
+			client, _ := DefaultClient(http.DefaultClient, WithEndpoints(EndpointsConfig{
+				Service:   "payments",
+				Endpoints: endpoints,
+				Policy:    LeastOutstanding,
+			}))
+
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, _ = client.Get(ctx, "", "http://payments/", http.Header{})
+				}()
+			}
+			wg.Wait()
+		})
+
+		convey.Convey("Should reject invalid config", func() {
+			for _, conf := range []EndpointsConfig{
+				{Endpoints: endpoints},
+				{Service: "payments"},
+				{Service: "payments", Endpoints: []Endpoint{{URL: "/relative"}}},
+				{Service: "payments", Endpoints: []Endpoint{{URL: "http://a", Weight: -1}}},
+				{Service: "payments", Endpoints: endpoints, Policy: "random"},
+			} {
+				_, err := DefaultClient(http.DefaultClient, WithEndpoints(conf))
+				convey.So(err, convey.ShouldNotBeNil)
+			}
+		})
+
+		convey.Convey("Should join base path and escaped path", func() {
+			base, _ := url.Parse("http://10.0.0.1:8080/api/")
+			target, _ := url.Parse("http://payments/files/a%2Fb?x=1#top")
+			convey.So(endpointURL(base, target).String(), convey.ShouldEqual, "http://10.0.0.1:8080/api/files/a%2Fb?x=1")
+		})
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/armiariyan/rest"
 	"github.com/opentracing/opentracing-go"
@@ -20,7 +21,14 @@ func main() {
 		tag: tag,
 	}
 
-	client := &http.Client{}
+	client, err := rest.BuildHttpClient(rest.Config{
+		Client: rest.ConfigClient{Timeout: rest.Duration(30 * time.Second)},
+	})
+	if err != nil {
+		log.Fatal(err)
+		return
+	}
+
 	httpClient, err := rest.DefaultClient(client, rest.AddHook(requestLogger))
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,325 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FaultKind is the kind of fault injected by FaultInjector.
+type FaultKind string
+
+const (
+	// FaultLatency delays the request by FaultRule.Latency, then sends it.
+	FaultLatency FaultKind = "latency"
+	// FaultStatus returns FaultRule.StatusCode and FaultRule.Body without calling upstream.
+	FaultStatus FaultKind = "status"
+	// FaultDrop fails the request as if the connection is dropped before response.
+	FaultDrop FaultKind = "drop"
+	// FaultTruncate sends the request and cuts the response body after FaultRule.TruncateBytes.
+	FaultTruncate FaultKind = "truncate"
+	// FaultTimeout fails the request with ErrHttpTimeout without calling upstream.
+	FaultTimeout FaultKind = "timeout"
+)
+
+// FaultRule injects Fault to Probability of requests matching Method, Host and Paths,
+// empty Method, Host or Paths matches any. Path ending with "*" matches the prefix.
+type FaultRule struct {
+	Name          string    `json:"name" yaml:"name"`
+	Fault         FaultKind `json:"fault" yaml:"fault"`
+	Probability   float64   `json:"probability" yaml:"probability"` // 0 < probability <= 1
+	Method        string    `json:"method" yaml:"method"`
+	Host          string    `json:"host" yaml:"host"`
+	Paths         []string  `json:"paths" yaml:"paths"`
+	Latency       Duration  `json:"latency" yaml:"latency"`               // used by FaultLatency
+	StatusCode    int       `json:"status_code" yaml:"status_code"`       // used by FaultStatus
+	Body          string    `json:"body" yaml:"body"`                     // used by FaultStatus
+	TruncateBytes int       `json:"truncate_bytes" yaml:"truncate_bytes"` // used by FaultTruncate
+}
+
+// Validate returns error when the rule can't inject its fault.
+func (f FaultRule) Validate() error {
+	var errs []error
+	if f.Probability <= 0 || f.Probability > 1 {
+		errs = append(errs, fmt.Errorf("fault rule %s probability %v must be in (0, 1]", f.Name, f.Probability))
+	}
+
+	switch f.Fault {
+	case FaultLatency:
+		if f.Latency <= 0 {
+			errs = append(errs, fmt.Errorf("fault rule %s latency must be positive", f.Name))
+		}
+	case FaultStatus:
+		if f.StatusCode < 100 || f.StatusCode > 599 {
+			errs = append(errs, fmt.Errorf("fault rule %s status code %d is invalid", f.Name, f.StatusCode))
+		}
+	case FaultTruncate:
+		if f.TruncateBytes < 0 {
+			errs = append(errs, fmt.Errorf("fault rule %s truncate bytes must not be negative", f.Name))
+		}
+	case FaultDrop, FaultTimeout:
+	default:
+		errs = append(errs, fmt.Errorf("fault rule %s has unknown fault %q", f.Name, f.Fault))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (f FaultRule) matches(request *http.Request) bool {
+	if f.Method != "" && !strings.EqualFold(f.Method, request.Method) {
+		return false
+	}
+
+	if f.Host != "" && !strings.EqualFold(f.Host, request.URL.Host) {
+		return false
+	}
+
+	if len(f.Paths) == 0 {
+		return true
+	}
+
+	for _, path := range f.Paths {
+		if prefix, ok := strings.CutSuffix(path, "*"); ok && strings.HasPrefix(request.URL.Path, prefix) {
+			return true
+		}
+
+		if path == request.URL.Path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FaultInjector holds fault rules that can be changed and toggled at runtime, see WithFaultInjection.
+type FaultInjector struct {
+	enabled int32
+	random  func() float64
+
+	mu    sync.RWMutex
+	rules []FaultRule
+}
+
+// NewFaultInjector returns enabled FaultInjector with rules.
+func NewFaultInjector(rules ...FaultRule) (*FaultInjector, error) {
+	injector := &FaultInjector{random: rand.Float64}
+	if err := injector.SetRules(rules...); err != nil {
+		return nil, err
+	}
+
+	injector.Enable()
+	return injector, nil
+}
+
+// SetRules replaces the rules, the old rules are kept when one of rules is invalid.
+func (f *FaultInjector) SetRules(rules ...FaultRule) error {
+	var errs []error
+	for _, rule := range rules {
+		errs = append(errs, rule.Validate())
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rules = append([]FaultRule(nil), rules...)
+	return nil
+}
+
+// Rules returns the current rules.
+func (f *FaultInjector) Rules() []FaultRule {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return append([]FaultRule(nil), f.rules...)
+}
+
+// Enable starts injecting faults.
+func (f *FaultInjector) Enable() {
+	atomic.StoreInt32(&f.enabled, 1)
+}
+
+// Disable stops injecting faults, requests are sent as is.
+func (f *FaultInjector) Disable() {
+	atomic.StoreInt32(&f.enabled, 0)
+}
+
+// Enabled reports whether faults are injected.
+func (f *FaultInjector) Enabled() bool {
+	return atomic.LoadInt32(&f.enabled) == 1
+}
+
+// pick returns rules to apply to request, each matching rule is rolled independently.
+func (f *FaultInjector) pick(request *http.Request) []FaultRule {
+	if !f.Enabled() {
+		return nil
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var picked []FaultRule
+	for _, rule := range f.rules {
+		if rule.matches(request) && f.random() < rule.Probability {
+			picked = append(picked, rule)
+		}
+	}
+
+	return picked
+}
+
+type faultsKey struct{}
+
+// injectedFaults collects faults injected to one call, so they can be reported in HookData.
+type injectedFaults struct {
+	mu    sync.Mutex
+	kinds []FaultKind
+}
+
+func (i *injectedFaults) add(kind FaultKind) {
+	if i == nil {
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.kinds = append(i.kinds, kind)
+}
+
+func (i *injectedFaults) list() []FaultKind {
+	if i == nil {
+		return nil
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return append([]FaultKind(nil), i.kinds...)
+}
+
+type faultClient struct {
+	client   HttpClient
+	injector *FaultInjector
+}
+
+func newFaultClient(injector *FaultInjector, client HttpClient) *faultClient {
+	return &faultClient{client: client, injector: injector}
+}
+
+func (c *faultClient) Do(request *http.Request) (*http.Response, error) {
+	rules := c.injector.pick(request)
+	if len(rules) == 0 {
+		return c.client.Do(request)
+	}
+
+	record, _ := request.Context().Value(faultsKey{}).(*injectedFaults)
+	truncate := -1
+	for _, rule := range rules {
+		record.add(rule.Fault)
+
+		// request isn't sent upstream on these faults, so its body is closed here as a RoundTripper does
+		switch rule.Fault {
+		case FaultLatency:
+			if err := sleepContext(request.Context(), rule.Latency.Std()); err != nil {
+				closeRequestBody(request)
+				return nil, err
+			}
+		case FaultStatus:
+			closeRequestBody(request)
+			return faultResponse(request, rule), nil
+		case FaultDrop:
+			closeRequestBody(request)
+			return nil, &url.Error{
+				Op:  request.Method,
+				URL: request.URL.String(),
+				Err: fmt.Errorf("connection dropped by fault injection: %w", io.ErrUnexpectedEOF),
+			}
+		case FaultTimeout:
+			closeRequestBody(request)
+			return nil, ErrHttpTimeout
+		case FaultTruncate:
+			if truncate < 0 || rule.TruncateBytes < truncate {
+				truncate = rule.TruncateBytes
+			}
+		}
+	}
+
+	resp, err := c.client.Do(request)
+	if err != nil || truncate < 0 {
+		return resp, err
+	}
+
+	resp.Body = &truncatedBody{body: resp.Body, remaining: int64(truncate)}
+	return resp, nil
+}
+
+func faultResponse(request *http.Request, rule FaultRule) *http.Response {
+	return NewResponse(request, rule.StatusCode, http.Header{"Content-Type": {"text/plain; charset=utf-8"}}, []byte(rule.Body))
+}
+
+func closeRequestBody(request *http.Request) {
+	if request.Body != nil {
+		_ = request.Body.Close()
+	}
+}
+
+// truncatedBody returns io.ErrUnexpectedEOF after remaining bytes, as a connection closed mid-body does.
+// Body that ends at or before the cut isn't truncated, so its EOF is returned as is.
+type truncatedBody struct {
+	body      io.ReadCloser
+	remaining int64
+	err       error // returned once the cut is reached
+}
+
+func (t *truncatedBody) Read(p []byte) (int, error) {
+	if t.err != nil {
+		return 0, t.err
+	}
+
+	if t.remaining <= 0 {
+		var next [1]byte
+		if n, err := io.ReadFull(t.body, next[:]); n == 0 && err != nil {
+			t.err = err
+		} else {
+			t.err = io.ErrUnexpectedEOF
+		}
+
+		return 0, t.err
+	}
+
+	if int64(len(p)) > t.remaining {
+		p = p[:t.remaining]
+	}
+
+	n, err := t.body.Read(p)
+	t.remaining -= int64(n)
+	return n, err
+}
+
+func (t *truncatedBody) Close() error {
+	return t.body.Close()
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,150 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestFaultInjection(t *testing.T) {
+	convey.Convey("Test WithFaultInjection", t, func() {
+		ctx := context.Background()
+		var calls int32
+		upstream := &mockClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&calls, 1)
+			return doFuncMock([]byte(`{"status": "ok"}`), nil)(req)
+		}}
+
+		injector, err := NewFaultInjector()
+		convey.So(err, convey.ShouldBeNil)
+
+		hook := new(lastHook)
+		client, err := DefaultClient(upstream, WithFaultInjection(injector), AddHook(hook))
+		convey.So(err, convey.ShouldBeNil)
+
+		convey.Convey("Should return status without calling upstream on matching route", func() {
+			err := injector.SetRules(FaultRule{
+				Fault:       FaultStatus,
+				Probability: 1,
+				Method:      http.MethodPost,
+				Paths:       []string{"/v1/payments/*"},
+				StatusCode:  http.StatusServiceUnavailable,
+				Body:        "injected",
+			})
+			convey.So(err, convey.ShouldBeNil)
+
+			resp, err := client.Post(ctx, "", "http://pay.example.com/v1/payments/1", http.Header{}, nil)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusServiceUnavailable)
+			convey.So(string(resp.RespBody), convey.ShouldEqual, "injected")
+			convey.So(hook.data.Faults, convey.ShouldResemble, []FaultKind{FaultStatus})
+			convey.So(atomic.LoadInt32(&calls), convey.ShouldEqual, 0)
+
+			resp, _ = client.Get(ctx, "", "http://pay.example.com/v1/payments/1", http.Header{})
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusOK)
+			convey.So(hook.data.Faults, convey.ShouldBeEmpty)
+
+			convey.Convey("Should be toggled at runtime", func() {
+				injector.Disable()
+				resp, _ := client.Post(ctx, "", "http://pay.example.com/v1/payments/1", http.Header{}, nil)
+				convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusOK)
+
+				injector.Enable()
+				resp, _ = client.Post(ctx, "", "http://pay.example.com/v1/payments/1", http.Header{}, nil)
+				convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusServiceUnavailable)
+			})
+		})
+
+		convey.Convey("Should add latency then call upstream", func() {
+			_ = injector.SetRules(FaultRule{Fault: FaultLatency, Probability: 1, Host: "pay.example.com", Latency: Duration(30 * time.Millisecond)})
+
+			start := time.Now()
+			resp, err := client.Get(ctx, "", "http://pay.example.com/", http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusOK)
+			convey.So(time.Since(start), convey.ShouldBeGreaterThanOrEqualTo, 30*time.Millisecond)
+			convey.So(hook.data.Faults, convey.ShouldResemble, []FaultKind{FaultLatency})
+
+			_, _ = client.Get(ctx, "", "http://other.example.com/", http.Header{})
+			convey.So(hook.data.Faults, convey.ShouldBeEmpty)
+		})
+
+		convey.Convey("Should return timeout, drop connection and truncate body", func() {
+			_ = injector.SetRules(FaultRule{Fault: FaultTimeout, Probability: 1})
+			_, err := client.Get(ctx, "", "http://pay.example.com/", http.Header{})
+			convey.So(err, convey.ShouldEqual, ErrHttpTimeout)
+			convey.So(hook.data.Faults, convey.ShouldResemble, []FaultKind{FaultTimeout})
+
+			_ = injector.SetRules(FaultRule{Fault: FaultDrop, Probability: 1})
+			_, err = client.Get(ctx, "", "http://pay.example.com/", http.Header{})
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(err.Error(), convey.ShouldContainSubstring, "connection dropped by fault injection")
+
+			_ = injector.SetRules(FaultRule{Fault: FaultTruncate, Probability: 1, TruncateBytes: 5})
+			_, err = client.Get(ctx, "", "http://pay.example.com/", http.Header{})
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(err.Error(), convey.ShouldContainSubstring, "unexpected EOF")
+			convey.So(atomic.LoadInt32(&calls), convey.ShouldEqual, 1)
+
+			_ = injector.SetRules(FaultRule{Fault: FaultTruncate, Probability: 1, TruncateBytes: len(`{"status": "ok"}`)})
+			resp, err := client.Get(ctx, "", "http://pay.example.com/", http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(string(resp.RespBody), convey.ShouldEqual, `{"status": "ok"}`)
+		})
+
+		convey.Convey("Should close request body when upstream is not called", func() {
+			for _, rule := range []FaultRule{
+				{Fault: FaultStatus, Probability: 1, StatusCode: http.StatusServiceUnavailable},
+				{Fault: FaultDrop, Probability: 1},
+				{Fault: FaultTimeout, Probability: 1},
+			} {
+				_ = injector.SetRules(rule)
+				body := &closeTracker{Reader: strings.NewReader("data")}
+				request, _ := http.NewRequest(http.MethodPost, "http://pay.example.com/", body)
+
+				resp, _ := newFaultClient(injector, upstream).Do(request)
+				if resp != nil {
+					_ = resp.Body.Close()
+				}
+				convey.So(body.isClosed(), convey.ShouldBeTrue)
+			}
+		})
+
+		convey.Convey("Should inject by probability", func() {
+			_ = injector.SetRules(FaultRule{Fault: FaultTimeout, Probability: 0.5})
+			rolls := []float64{0.7, 0.2}
+			injector.random = func() float64 {
+				roll := rolls[0]
+				rolls = rolls[1:]
+				return roll
+			}
+
+			_, err := client.Get(ctx, "", "http://pay.example.com/", http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+
+			_, err = client.Get(ctx, "", "http://pay.example.com/", http.Header{})
+			convey.So(err, convey.ShouldEqual, ErrHttpTimeout)
+		})
+
+		convey.Convey("Should reject invalid rules and keep the old ones", func() {
+			_ = injector.SetRules(FaultRule{Fault: FaultTimeout, Probability: 1})
+
+			err := injector.SetRules(
+				FaultRule{Name: "zero", Fault: FaultDrop},
+				FaultRule{Name: "status", Fault: FaultStatus, Probability: 1},
+				FaultRule{Name: "latency", Fault: FaultLatency, Probability: 1},
+				FaultRule{Name: "unknown", Fault: "explode", Probability: 1},
+			)
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(len(injector.Rules()), convey.ShouldEqual, 1)
+
+			_, err = DefaultClient(upstream, WithFaultInjection(nil))
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
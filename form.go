@@ -0,0 +1,257 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// errMultipartSent is returned when Multipart is sent again, its parts are already read and closed.
+var errMultipartSent = errors.New("multipart body is already sent, build a new Multipart for each request")
+
+// Multipart builds multipart/form-data body, parts are streamed to the server in the order they are added
+// without buffering the files in memory. It can be sent only once.
+type Multipart struct {
+	boundary string
+	parts    []multipartPart
+	form     *multipart.Form
+	sent     int32
+}
+
+type multipartPart struct {
+	header textproto.MIMEHeader
+	reader io.Reader
+}
+
+// NewMultipart returns empty Multipart with random boundary.
+func NewMultipart() *Multipart {
+	return &Multipart{
+		boundary: multipart.NewWriter(io.Discard).Boundary(),
+		form: &multipart.Form{
+			Value: make(map[string][]string),
+			File:  make(map[string][]*multipart.FileHeader),
+		},
+	}
+}
+
+// SetBoundary overrides the random boundary, see multipart.Writer.SetBoundary for the allowed value.
+func (m *Multipart) SetBoundary(boundary string) error {
+	if err := multipart.NewWriter(io.Discard).SetBoundary(boundary); err != nil {
+		return err
+	}
+
+	m.boundary = boundary
+	return nil
+}
+
+// ContentType returns Content-Type header value including the boundary.
+func (m *Multipart) ContentType() string {
+	return mime.FormatMediaType("multipart/form-data", map[string]string{"boundary": m.boundary})
+}
+
+// Field adds form field.
+func (m *Multipart) Field(name, value string) *Multipart {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": name}))
+
+	m.parts = append(m.parts, multipartPart{header: header, reader: strings.NewReader(value)})
+	m.form.Value[name] = append(m.form.Value[name], value)
+	return m
+}
+
+// File adds file read from reader, Content-Type of the part is application/octet-stream.
+// The reader is read when the request is sent, and closed after that when it is io.Closer.
+func (m *Multipart) File(fieldName, fileName string, reader io.Reader) *Multipart {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{
+		"name":     fieldName,
+		"filename": fileName,
+	}))
+	header.Set("Content-Type", "application/octet-stream")
+
+	return m.Part(header, reader)
+}
+
+// Part adds part with custom header, e.g. to set Content-Type of a file.
+// Part with filename in Content-Disposition is shown as file in hook, otherwise as field.
+func (m *Multipart) Part(header textproto.MIMEHeader, reader io.Reader) *Multipart {
+	m.parts = append(m.parts, multipartPart{header: header, reader: reader})
+
+	_, params, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	name := params["name"]
+	if filename, ok := params["filename"]; ok {
+		size := int64(-1)
+		if sized, ok := reader.(interface{ Len() int }); ok {
+			size = int64(sized.Len())
+		}
+
+		m.form.File[name] = append(m.form.File[name], &multipart.FileHeader{
+			Filename: filename,
+			Header:   header,
+			Size:     size, // -1 when unknown before it is sent
+		})
+	} else if name != "" {
+		m.form.Value[name] = append(m.form.Value[name], "")
+	}
+
+	return m
+}
+
+// Reader returns the body streaming every part, it can only be read once.
+// Parts are written in background goroutine started on the first Read, Close stops it.
+// Part readers that are io.Closer are closed once read, or on Close when they are not read.
+// Reader of Multipart that is already sent fails on Read.
+func (m *Multipart) Reader() io.ReadCloser {
+	if !atomic.CompareAndSwapInt32(&m.sent, 0, 1) {
+		return &multipartReader{err: errMultipartSent}
+	}
+
+	return &multipartReader{multipart: m}
+}
+
+type multipartReader struct {
+	multipart *Multipart
+	err       error // returned by Read instead of the parts
+	once      sync.Once
+	reader    *io.PipeReader
+}
+
+func (r *multipartReader) start() {
+	pr, pw := io.Pipe()
+	r.reader = pr
+
+	go func() {
+		w := multipart.NewWriter(pw)
+		_ = w.SetBoundary(r.multipart.boundary)
+
+		parts := r.multipart.parts
+		for i, part := range parts {
+			dst, err := w.CreatePart(part.header)
+			if err == nil {
+				_, err = io.Copy(dst, part.reader)
+			}
+
+			closePart(part)
+
+			if err != nil {
+				// the pipe is closed mid-stream, the remaining parts are never read
+				for _, rest := range parts[i+1:] {
+					closePart(rest)
+				}
+
+				_ = pw.CloseWithError(fmt.Errorf("fail write multipart: %s", err.Error()))
+				return
+			}
+		}
+
+		_ = pw.CloseWithError(w.Close())
+	}()
+}
+
+func closePart(part multipartPart) {
+	if closer, ok := part.reader.(io.Closer); ok {
+		_ = closer.Close()
+	}
+}
+
+func (r *multipartReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	r.once.Do(r.start)
+	if r.reader == nil {
+		// closed before the first Read
+		return 0, io.ErrClosedPipe
+	}
+
+	return r.reader.Read(p)
+}
+
+func (r *multipartReader) Close() error {
+	started := true
+	r.once.Do(func() {
+		// never read, the writer goroutine isn't started to close the parts
+		started = false
+		if r.multipart != nil {
+			for _, part := range r.multipart.parts {
+				closePart(part)
+			}
+		}
+	})
+
+	if !started || r.reader == nil {
+		return nil
+	}
+
+	return r.reader.Close()
+}
+
+// PostForm sends form as application/x-www-form-urlencoded body.
+func (r DefaultHttpRequester) PostForm(
+	ctx context.Context,
+	correlationID,
+	path string,
+	requestHeader http.Header,
+	form url.Values,
+) (ret HttpResponse, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "PostForm")
+	defer func() {
+		span.Finish()
+		ctx.Done()
+	}()
+
+	if form == nil {
+		form = url.Values{}
+	}
+
+	requestHeader = cloneHeader(requestHeader)
+	requestHeader.Set("Content-Type", "application/x-www-form-urlencoded")
+	ret, err = r.do(ctx, http.MethodPost, correlationID, path, requestHeader, outgoingBody{
+		data: []byte(form.Encode()),
+		form: form,
+	})
+	return
+}
+
+// PostMultipart sends body as multipart/form-data, streaming the parts without buffering them in memory.
+func (r DefaultHttpRequester) PostMultipart(
+	ctx context.Context,
+	correlationID,
+	path string,
+	requestHeader http.Header,
+	body *Multipart,
+) (ret HttpResponse, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "PostMultipart")
+	defer func() {
+		span.Finish()
+		ctx.Done()
+	}()
+
+	if body == nil {
+		body = NewMultipart()
+	}
+
+	if atomic.LoadInt32(&body.sent) == 1 {
+		return ret, errMultipartSent
+	}
+
+	requestHeader = cloneHeader(requestHeader)
+	requestHeader.Set("Content-Type", body.ContentType())
+	ret, err = r.do(ctx, http.MethodPost, correlationID, path, requestHeader, outgoingBody{
+		stream:        body.Reader(),
+		multipartForm: body.form,
+	})
+	return
+}
@@ -0,0 +1,189 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestPostForm(t *testing.T) {
+	convey.Convey("Test PostForm", t, func() {
+		var received url.Values
+		var contentType string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentType = r.Header.Get("Content-Type")
+			_ = r.ParseForm()
+			received = r.PostForm
+		}))
+		defer srv.Close()
+
+		hook := new(lastHook)
+		client, _ := DefaultClient(http.DefaultClient, AddHook(hook))
+
+		form := url.Values{"name": {"budi"}, "amount": {"1000"}}
+		header := http.Header{}
+		_, err := client.PostForm(context.Background(), "", srv.URL+"/?channel=web", header, form)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(contentType, convey.ShouldEqual, "application/x-www-form-urlencoded")
+		convey.So(header, convey.ShouldBeEmpty)
+		convey.So(received, convey.ShouldResemble, form)
+
+		convey.So(hook.data.Request.PostForm, convey.ShouldResemble, form)
+		convey.So(hook.data.Request.Form.Get("channel"), convey.ShouldEqual, "web")
+		convey.So(hook.data.Request.Form.Get("name"), convey.ShouldEqual, "budi")
+		convey.So(hook.data.Request.Body, convey.ShouldResemble, form)
+	})
+}
+
+// closeTracker records whether the reader is closed.
+type closeTracker struct {
+	io.Reader
+	closed int32
+}
+
+func (c *closeTracker) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return nil
+}
+
+func (c *closeTracker) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
+func TestPostMultipart(t *testing.T) {
+	convey.Convey("Test PostMultipart", t, func() {
+		type upload struct {
+			fields   map[string][]string
+			files    map[string]string
+			fileType string
+		}
+
+		received := upload{}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			received.fields = r.MultipartForm.Value
+			received.files = map[string]string{}
+			for name, headers := range r.MultipartForm.File {
+				f, _ := headers[0].Open()
+				content, _ := ioutil.ReadAll(f)
+				received.files[name+"/"+headers[0].Filename] = string(content)
+				received.fileType = headers[0].Header.Get("Content-Type")
+			}
+		}))
+		defer srv.Close()
+
+		hook := new(lastHook)
+		client, _ := DefaultClient(http.DefaultClient, AddHook(hook))
+
+		convey.Convey("Should stream fields and files", func() {
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Disposition", `form-data; name="statement"; filename="statement.csv"`)
+			header.Set("Content-Type", "text/csv")
+
+			body := NewMultipart().
+				Field("account", "123").
+				File("ktp", "ktp.jpg", strings.NewReader("jpeg bytes")).
+				Part(header, ioutil.NopCloser(strings.NewReader("a,b\n1,2")))
+
+			resp, err := client.PostMultipart(context.Background(), "", srv.URL, http.Header{}, body)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusOK)
+			convey.So(received.fields, convey.ShouldResemble, map[string][]string{"account": {"123"}})
+			convey.So(received.files, convey.ShouldResemble, map[string]string{
+				"ktp/ktp.jpg":             "jpeg bytes",
+				"statement/statement.csv": "a,b\n1,2",
+			})
+
+			convey.So(hook.data.Request.Header.Get("Content-Type"), convey.ShouldStartWith, "multipart/form-data; boundary=")
+			convey.So(hook.data.Request.PostForm.Get("account"), convey.ShouldEqual, "123")
+			convey.So(hook.data.Request.MultipartForm.File["ktp"][0].Filename, convey.ShouldEqual, "ktp.jpg")
+			convey.So(hook.data.Request.MultipartForm.File["ktp"][0].Size, convey.ShouldEqual, 10)
+			convey.So(hook.data.Request.MultipartForm.File["statement"][0].Size, convey.ShouldEqual, -1)
+			convey.So(hook.data.RequestSize.Uncompressed, convey.ShouldBeGreaterThan, 0)
+		})
+
+		convey.Convey("Should use custom boundary", func() {
+			body := NewMultipart().Field("a", "1")
+			convey.So(body.SetBoundary("my-boundary"), convey.ShouldBeNil)
+			convey.So(body.ContentType(), convey.ShouldEqual, "multipart/form-data; boundary=my-boundary")
+			convey.So(body.SetBoundary(""), convey.ShouldNotBeNil)
+
+			_, err := client.PostMultipart(context.Background(), "", srv.URL, http.Header{}, body)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(received.fields, convey.ShouldResemble, map[string][]string{"a": {"1"}})
+		})
+
+		convey.Convey("Should fail when file can't be read", func() {
+			body := NewMultipart().File("ktp", "ktp.jpg", &nopReader{err: errors.New("disk error")})
+
+			_, err := client.PostMultipart(context.Background(), "", srv.URL, http.Header{}, body)
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Closing unread body should not block", func() {
+			reader := NewMultipart().Field("a", "1").Reader()
+			convey.So(reader.Close(), convey.ShouldBeNil)
+		})
+
+		convey.Convey("Should close files when request fails before the body is read", func() {
+			file := &closeTracker{Reader: strings.NewReader("jpeg bytes")}
+			_, err := client.PostMultipart(context.Background(), "", "://bad", http.Header{}, NewMultipart().File("ktp", "ktp.jpg", file))
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(file.isClosed(), convey.ShouldBeTrue)
+
+			signed, _ := DefaultClient(http.DefaultClient, WithSigV4(SigV4Config{
+				AccessKeyID:     "key",
+				SecretAccessKey: "secret",
+				Region:          "us-east-1",
+				Service:         "execute-api",
+			}))
+			file = &closeTracker{Reader: strings.NewReader("jpeg bytes")}
+			_, err = signed.PostMultipart(context.Background(), "", srv.URL, http.Header{}, NewMultipart().File("ktp", "ktp.jpg", file))
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(file.isClosed(), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("Should close remaining files when body is closed mid-stream", func() {
+			first := &closeTracker{Reader: strings.NewReader(strings.Repeat("a", 1<<16))}
+			second := &closeTracker{Reader: strings.NewReader("b")}
+			reader := NewMultipart().File("first", "a.txt", first).File("second", "b.txt", second).Reader()
+
+			_, _ = reader.Read(make([]byte, 1))
+			convey.So(reader.Close(), convey.ShouldBeNil)
+
+			deadline := time.Now().Add(time.Second)
+			for (!first.isClosed() || !second.isClosed()) && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			convey.So(first.isClosed(), convey.ShouldBeTrue)
+			convey.So(second.isClosed(), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("Should reject Multipart that is already sent", func() {
+			body := NewMultipart().File("ktp", "ktp.jpg", strings.NewReader("jpeg bytes"))
+			_, err := client.PostMultipart(context.Background(), "", srv.URL, http.Header{}, body)
+			convey.So(err, convey.ShouldBeNil)
+
+			_, err = client.PostMultipart(context.Background(), "", srv.URL, http.Header{}, body)
+			convey.So(err, convey.ShouldEqual, errMultipartSent)
+
+			_, err = body.Reader().Read(make([]byte, 1))
+			convey.So(err, convey.ShouldEqual, errMultipartSent)
+		})
+	})
+}
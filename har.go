@@ -0,0 +1,480 @@
+package rest
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// HAR is HTTP Archive 1.2 document, see http://www.softwareishard.com/blog/har-12-spec/.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the root of HAR document.
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator is the application that created HAR document.
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is one request and its response.
+type HAREntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"` // milliseconds
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+	Error           string      `json:"_error,omitempty"` // custom field, error returned by the call
+}
+
+// HARRequest is the request of HAREntry.
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+	Comment     string         `json:"comment,omitempty"`
+}
+
+// HARResponse is the response of HAREntry.
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARNameValue is a header, cookie, query or form param.
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is the request body.
+type HARPostData struct {
+	MimeType string         `json:"mimeType"`
+	Text     string         `json:"text"`
+	Params   []HARNameValue `json:"params,omitempty"`
+}
+
+// HARContent is the response body.
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// HARTimings is the duration of each phase in milliseconds, -1 when it doesn't apply.
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"` // includes SSL
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// HARConfig configures HARHook, either Path or Dir must be set.
+type HARConfig struct {
+	// Path of HAR file rewritten every FlushInterval, keeping the last MaxEntries.
+	Path string
+	// Dir of rotating HAR files named rest-<creation time>.har, a new file is started after MaxEntries.
+	Dir string
+	// MaxEntries default 1000.
+	MaxEntries int
+	// FlushInterval is how often new entries are written in background, default 1 second.
+	FlushInterval Duration
+	// MaxFiles removes the oldest files in Dir above this number, 0 keeps every file.
+	MaxFiles int
+	// RedactHeaders are replaced with "REDACTED", default Authorization, Proxy-Authorization, Cookie and Set-Cookie.
+	RedactHeaders []string
+	// Creator default name "github.com/armiariyan/rest".
+	Creator HARCreator
+	// OnError is called when HAR file can't be written.
+	OnError func(err error)
+}
+
+// HARHook is Hook that writes every request and response in HTTP Archive 1.2 format,
+// the file can be opened in browser devtools. Entries are kept in memory and written in background,
+// so requests don't wait for file I/O. Call Close to write the last entries and stop the writer.
+type HARHook struct {
+	conf HARConfig
+
+	mu      sync.Mutex
+	entries []HAREntry
+	file    string    // current file in Dir mode
+	dirty   bool      // entries are not written yet
+	rotated []harFile // full files in Dir mode not written yet
+
+	writeMu sync.Mutex // serializes writes of the background writer and Flush
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// harFile is a document to write to path.
+type harFile struct {
+	path string
+	doc  HAR
+}
+
+var _ Hook = &HARHook{}
+
+// NewHARHook returns HARHook writing to conf.Path or conf.Dir.
+func NewHARHook(conf HARConfig) (*HARHook, error) {
+	if (conf.Path == "") == (conf.Dir == "") {
+		return nil, errors.New("either HAR path or dir must be set")
+	}
+
+	if conf.MaxEntries <= 0 {
+		conf.MaxEntries = 1000
+	}
+
+	if conf.RedactHeaders == nil {
+		conf.RedactHeaders = defaultRedactHeaders
+	}
+
+	if conf.Creator.Name == "" {
+		conf.Creator.Name = "github.com/armiariyan/rest"
+	}
+
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = Duration(time.Second)
+	}
+
+	if conf.Dir != "" {
+		if err := os.MkdirAll(conf.Dir, 0o755); err != nil {
+			return nil, fmt.Errorf("fail create HAR dir: %s", err.Error())
+		}
+	}
+
+	h := &HARHook{conf: conf, file: conf.Path, stop: make(chan struct{}), done: make(chan struct{})}
+	go h.run()
+
+	return h, nil
+}
+
+// run writes new entries every FlushInterval until Close is called.
+func (h *HARHook) run() {
+	defer close(h.done)
+
+	ticker := time.NewTicker(h.conf.FlushInterval.Std())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			if err := h.Flush(); err != nil && h.conf.OnError != nil {
+				h.conf.OnError(err)
+			}
+		}
+	}
+}
+
+// Flush writes entries that are not written yet.
+func (h *HARHook) Flush() error {
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	h.mu.Lock()
+	files := h.rotated
+	h.rotated = nil
+	if h.dirty {
+		files = append(files, harFile{path: h.file, doc: h.document()})
+		h.dirty = false
+	}
+	h.mu.Unlock()
+
+	var errs []error
+	for _, file := range files {
+		if err := h.write(file); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Close stops the background writer and writes the last entries.
+// Entries of requests sent after Close are only written by Flush.
+func (h *HARHook) Close() error {
+	h.once.Do(func() {
+		close(h.stop)
+	})
+
+	<-h.done
+	return h.Flush()
+}
+
+// BeforeRequest does nothing, the entry is written after response.
+func (h *HARHook) BeforeRequest(_ context.Context, _ HookData) {}
+
+// AfterRequest appends the request and its response to HAR file, the file is written in background.
+func (h *HARHook) AfterRequest(ctx context.Context, data HookData) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "HARHook.AfterRequest")
+	defer func() {
+		span.Finish()
+		ctx.Done()
+	}()
+
+	entry := h.entry(data)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.conf.Dir != "" && (h.file == "" || len(h.entries) >= h.conf.MaxEntries) {
+		if h.dirty {
+			h.rotated = append(h.rotated, harFile{path: h.file, doc: h.document()})
+		}
+
+		h.file = filepath.Join(h.conf.Dir, "rest-"+time.Now().UTC().Format("20060102T150405.000000000Z")+".har")
+		h.entries = nil
+	}
+
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > h.conf.MaxEntries {
+		h.entries = append([]HAREntry(nil), h.entries[len(h.entries)-h.conf.MaxEntries:]...)
+	}
+	h.dirty = true
+}
+
+// HAR returns the document of the current file.
+func (h *HARHook) HAR() HAR {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.document()
+}
+
+func (h *HARHook) document() HAR {
+	entries := append([]HAREntry{}, h.entries...)
+	return HAR{Log: HARLog{Version: "1.2", Creator: h.conf.Creator, Entries: entries}}
+}
+
+func (h *HARHook) write(file harFile) error {
+	data, err := json.MarshalIndent(file.doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("fail encode HAR: %s", err.Error())
+	}
+
+	if err := writeFileAtomic(file.path, data); err != nil {
+		return fmt.Errorf("fail write HAR: %s", err.Error())
+	}
+
+	if h.conf.Dir == "" || h.conf.MaxFiles <= 0 {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(h.conf.Dir, "rest-*.har"))
+	if err != nil {
+		return err
+	}
+
+	// file name starts with the time, so the oldest is the first
+	sort.Strings(files)
+	for len(files) > h.conf.MaxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return fmt.Errorf("fail remove old HAR: %s", err.Error())
+		}
+		files = files[1:]
+	}
+
+	return nil
+}
+
+func (h *HARHook) entry(data HookData) HAREntry {
+	timings := harTimings(data.Timings)
+	entry := HAREntry{
+		StartedDateTime: data.StartTime.Format(time.RFC3339Nano),
+		Request:         h.request(data),
+		Response:        h.response(data),
+		Timings:         timings,
+	}
+
+	// time is the sum of phases, ssl is already part of connect and -1 means the phase doesn't apply
+	for _, phase := range []float64{timings.Blocked, timings.DNS, timings.Connect, timings.Send, timings.Wait, timings.Receive} {
+		if phase > 0 {
+			entry.Time += phase
+		}
+	}
+
+	if data.Error != nil {
+		entry.Error = data.Error.Error()
+	}
+
+	if data.CorrelationID != "" {
+		entry.Comment = "correlation id " + data.CorrelationID
+	}
+
+	return entry
+}
+
+func (h *HARHook) request(data HookData) HARRequest {
+	request := HARRequest{
+		Method:      data.Request.Method,
+		URL:         data.URL,
+		HTTPVersion: protoOrDefault(data.Request.Proto),
+		Cookies:     []HARNameValue{},
+		Headers:     h.headers(data.Request.Header),
+		QueryString: []HARNameValue{},
+		HeadersSize: -1,
+		BodySize:    data.RequestSize.Compressed,
+	}
+
+	if data.Request.URL != nil {
+		request.URL = data.Request.URL.String()
+		request.QueryString = nameValues(data.Request.URL.Query())
+	}
+
+	mimeType := data.Request.Header.Get("Content-Type")
+	switch body := data.Request.Body.(type) {
+	case nil:
+		if data.Request.MultipartForm != nil || data.RequestSize.Uncompressed > 0 {
+			request.PostData = &HARPostData{MimeType: mimeType}
+		}
+	case url.Values:
+		request.PostData = &HARPostData{MimeType: mimeType, Text: body.Encode(), Params: nameValues(body)}
+	case string:
+		if body != "" {
+			request.PostData = &HARPostData{MimeType: mimeType, Text: body}
+		}
+	default:
+		text, _ := json.Marshal(body)
+		request.PostData = &HARPostData{MimeType: mimeType, Text: string(text)}
+	}
+
+	return request
+}
+
+func (h *HARHook) response(data HookData) HARResponse {
+	raw := data.Response
+	response := HARResponse{
+		Status:      raw.StatusCode,
+		StatusText:  http.StatusText(raw.StatusCode),
+		HTTPVersion: protoOrDefault(raw.Proto),
+		Cookies:     []HARNameValue{},
+		Headers:     h.headers(raw.Header),
+		RedirectURL: raw.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    data.ResponseSize.Compressed,
+		Content: HARContent{
+			Size:     data.ResponseSize.Uncompressed,
+			MimeType: raw.Header.Get("Content-Type"),
+		},
+	}
+
+	switch body := raw.Body.(type) {
+	case nil:
+	case string:
+		if utf8.ValidString(body) {
+			response.Content.Text = body
+		} else {
+			response.Content.Text = base64.StdEncoding.EncodeToString([]byte(body))
+			response.Content.Encoding = "base64"
+		}
+	default:
+		text, _ := json.Marshal(body)
+		response.Content.Text = string(text)
+	}
+
+	return response
+}
+
+func (h *HARHook) headers(header http.Header) []HARNameValue {
+	redacted := make(http.Header, len(header))
+	for key, values := range header {
+		redacted[key] = values
+	}
+
+	for _, name := range h.conf.RedactHeaders {
+		if redacted.Get(name) != "" {
+			redacted.Set(name, "REDACTED")
+		}
+	}
+
+	return nameValues(redacted)
+}
+
+// nameValues returns sorted name and value pairs.
+func nameValues(values map[string][]string) []HARNameValue {
+	pairs := []HARNameValue{}
+	for name, list := range values {
+		for _, value := range list {
+			pairs = append(pairs, HARNameValue{Name: name, Value: value})
+		}
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return strings.ToLower(pairs[i].Name) < strings.ToLower(pairs[j].Name)
+	})
+
+	return pairs
+}
+
+func harTimings(timings Timings) HARTimings {
+	ms := func(d Duration) float64 {
+		return float64(d.Std()) / float64(time.Millisecond)
+	}
+
+	optional := func(d Duration) float64 {
+		if d <= 0 {
+			return -1
+		}
+
+		return ms(d)
+	}
+
+	return HARTimings{
+		Blocked: optional(timings.Blocked),
+		DNS:     optional(timings.DNS),
+		Connect: optional(timings.Connect + timings.TLS),
+		Send:    ms(timings.Send),
+		Wait:    ms(timings.Wait),
+		Receive: ms(timings.Receive),
+		SSL:     optional(timings.TLS),
+	}
+}
+
+func protoOrDefault(proto string) string {
+	if proto == "" {
+		return "HTTP/1.1"
+	}
+
+	return proto
+}
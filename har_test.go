@@ -0,0 +1,160 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestHARHook(t *testing.T) {
+	convey.Convey("Test HARHook", t, func() {
+		ctx := context.Background()
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Set-Cookie", "session=secret")
+			_, _ = w.Write([]byte(`{"id": 1}`))
+		}))
+		defer server.Close()
+
+		dir, _ := os.MkdirTemp("", "har")
+		defer os.RemoveAll(dir)
+
+		convey.Convey("Should write HAR 1.2 file with redacted headers and timings", func() {
+			path := filepath.Join(dir, "traffic.har")
+			hook, err := NewHARHook(HARConfig{Path: path})
+			convey.So(err, convey.ShouldBeNil)
+
+			client, _ := DefaultClient(http.DefaultClient, AddHook(hook))
+			header := http.Header{"Authorization": {"Bearer secret"}, "Content-Type": {"application/json"}}
+			_, err = client.Post(ctx, "abc", server.URL+"/orders?expand=items", header, []byte(`{"amount": 10}`))
+			convey.So(err, convey.ShouldBeNil)
+			_, _ = client.PostForm(ctx, "", server.URL+"/login", http.Header{}, url.Values{"user": {"a"}})
+
+			convey.So(hook.Close(), convey.ShouldBeNil)
+
+			saved, err := os.ReadFile(path)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(string(saved), convey.ShouldNotContainSubstring, "secret")
+
+			var doc HAR
+			convey.So(json.Unmarshal(saved, &doc), convey.ShouldBeNil)
+			convey.So(doc.Log.Version, convey.ShouldEqual, "1.2")
+			convey.So(len(doc.Log.Entries), convey.ShouldEqual, 2)
+
+			entry := doc.Log.Entries[0]
+			convey.So(entry.Request.Method, convey.ShouldEqual, http.MethodPost)
+			convey.So(entry.Request.URL, convey.ShouldEqual, server.URL+"/orders?expand=items")
+			convey.So(entry.Request.QueryString, convey.ShouldResemble, []HARNameValue{{Name: "expand", Value: "items"}})
+			convey.So(entry.Request.Headers, convey.ShouldContain, HARNameValue{Name: "Authorization", Value: "REDACTED"})
+			convey.So(entry.Request.PostData.Text, convey.ShouldEqual, `{"amount":10}`)
+			convey.So(entry.Request.BodySize, convey.ShouldEqual, 14)
+			convey.So(entry.Comment, convey.ShouldEqual, "correlation id abc")
+
+			convey.So(entry.Response.Status, convey.ShouldEqual, http.StatusOK)
+			convey.So(entry.Response.StatusText, convey.ShouldEqual, "OK")
+			convey.So(entry.Response.Content.MimeType, convey.ShouldEqual, "application/json")
+			convey.So(entry.Response.Content.Text, convey.ShouldEqual, `{"id":1}`)
+			convey.So(entry.Response.Content.Size, convey.ShouldEqual, 9)
+			convey.So(entry.Response.Headers, convey.ShouldContain, HARNameValue{Name: "Set-Cookie", Value: "REDACTED"})
+
+			convey.So(entry.Time, convey.ShouldBeGreaterThan, 0)
+			convey.So(entry.Timings.Connect, convey.ShouldBeGreaterThan, 0)
+			convey.So(entry.Timings.SSL, convey.ShouldEqual, -1)
+			convey.So(entry.Timings.Wait, convey.ShouldBeGreaterThanOrEqualTo, 0)
+
+			form := doc.Log.Entries[1].Request.PostData
+			convey.So(form.Text, convey.ShouldEqual, "user=a")
+			convey.So(form.Params, convey.ShouldResemble, []HARNameValue{{Name: "user", Value: "a"}})
+			convey.So(doc.Log.Entries[1].Timings.Connect, convey.ShouldEqual, -1)
+		})
+
+		convey.Convey("Should record timings of signed request", func() {
+			hook := new(lastHook)
+			transport := &http.Transport{}
+			defer transport.CloseIdleConnections()
+
+			client, _ := DefaultClient(&http.Client{Transport: transport}, WithHMAC(HMACConfig{Secret: []byte("secret")}), AddHook(hook))
+			_, err := client.Post(ctx, "", server.URL+"/orders", http.Header{}, []byte(`{"amount": 10}`))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(hook.data.Timings.Connect, convey.ShouldBeGreaterThan, 0)
+			convey.So(hook.data.Timings.Send, convey.ShouldBeGreaterThan, 0)
+			convey.So(hook.data.Timings.Wait, convey.ShouldBeLessThan, hook.data.Timings.Total)
+		})
+
+		convey.Convey("Should record error and binary body", func() {
+			hook, _ := NewHARHook(HARConfig{Path: filepath.Join(dir, "error.har")})
+			defer hook.Close()
+			client, _ := DefaultClient(&mockClient{DoFunc: doFuncMock([]byte{0xff, 0xfe}, errors.New("reset"))}, AddHook(hook))
+			_, _ = client.Get(ctx, "", "http://api.example.com/", http.Header{})
+
+			entry := hook.HAR().Log.Entries[0]
+			convey.So(entry.Error, convey.ShouldEqual, "reset")
+			convey.So(entry.Response.Content.Encoding, convey.ShouldEqual, "base64")
+			convey.So(entry.Response.Content.Text, convey.ShouldEqual, "//4=")
+			convey.So(entry.Timings.Wait, convey.ShouldEqual, entry.Time)
+		})
+
+		convey.Convey("Should rotate files in dir", func() {
+			hook, err := NewHARHook(HARConfig{Dir: filepath.Join(dir, "rotate"), MaxEntries: 2, MaxFiles: 2})
+			convey.So(err, convey.ShouldBeNil)
+
+			client, _ := DefaultClient(http.DefaultClient, AddHook(hook))
+			for i := 0; i < 5; i++ {
+				_, _ = client.Get(ctx, "", server.URL, http.Header{})
+			}
+			convey.So(hook.Close(), convey.ShouldBeNil)
+
+			files, _ := filepath.Glob(filepath.Join(dir, "rotate", "rest-*.har"))
+			convey.So(len(files), convey.ShouldEqual, 2)
+			convey.So(len(hook.HAR().Log.Entries), convey.ShouldEqual, 1)
+		})
+
+		convey.Convey("Should keep last MaxEntries in file", func() {
+			hook, _ := NewHARHook(HARConfig{Path: filepath.Join(dir, "last.har"), MaxEntries: 2})
+			defer hook.Close()
+			client, _ := DefaultClient(http.DefaultClient, AddHook(hook))
+			for _, path := range []string{"/1", "/2", "/3"} {
+				_, _ = client.Get(ctx, "", server.URL+path, http.Header{})
+			}
+
+			entries := hook.HAR().Log.Entries
+			convey.So(len(entries), convey.ShouldEqual, 2)
+			convey.So(entries[0].Request.URL, convey.ShouldEqual, server.URL+"/2")
+		})
+
+		convey.Convey("Should write new entries in background", func() {
+			path := filepath.Join(dir, "background.har")
+			hook, _ := NewHARHook(HARConfig{Path: path, FlushInterval: Duration(10 * time.Millisecond)})
+			defer hook.Close()
+
+			client, _ := DefaultClient(http.DefaultClient, AddHook(hook))
+			_, _ = client.Get(ctx, "", server.URL, http.Header{})
+
+			var doc HAR
+			deadline := time.Now().Add(time.Second)
+			for len(doc.Log.Entries) == 0 && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+				saved, _ := os.ReadFile(path)
+				_ = json.Unmarshal(saved, &doc)
+			}
+			convey.So(len(doc.Log.Entries), convey.ShouldEqual, 1)
+		})
+
+		convey.Convey("Should require either path or dir", func() {
+			_, err := NewHARHook(HARConfig{})
+			convey.So(err, convey.ShouldNotBeNil)
+
+			_, err = NewHARHook(HARConfig{Path: "a.har", Dir: dir})
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
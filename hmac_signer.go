@@ -0,0 +1,196 @@
+package rest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HMACComponent is a value included in HMAC string to sign.
+type HMACComponent string
+
+const (
+	HMACMethod       HMACComponent = "method"      // upper case method, e.g. "POST"
+	HMACPath         HMACComponent = "path"        // escaped path, e.g. "/v1/payments"
+	HMACPathQuery    HMACComponent = "path-query"  // escaped path and query, e.g. "/v1/payments?page=1"
+	HMACHost         HMACComponent = "host"        // host with port, if any
+	HMACTimestamp    HMACComponent = "timestamp"   // value of HMACConfig.TimestampHeader
+	HMACBodyDigest   HMACComponent = "body-digest" // SHA-256 of the body, encoded using HMACConfig.Encoding
+	HMACBody         HMACComponent = "body"        // the body as is
+	HMACHeaderPrefix               = "header:"     // value of a header, e.g. "header:X-Client-Id"
+)
+
+// HMACConfig configures legacy HMAC-SHA256 signature used by many payment partners,
+// the signature is computed over Components joined by Separator.
+type HMACConfig struct {
+	Secret []byte
+	// KeyID is sent in KeyIDHeader when both are set, e.g. "X-Client-Id".
+	KeyID       string
+	KeyIDHeader string
+	// SignatureHeader holds the signature, default "X-Signature".
+	SignatureHeader string
+	// SignaturePrefix is put before the signature, e.g. "HMAC-SHA256 ".
+	SignaturePrefix string
+	// TimestampHeader holds the signing time, default "X-Timestamp".
+	TimestampHeader string
+	// TimestampFormat is "unix" (default), "unix-milli", or a Go time layout such as time.RFC3339.
+	TimestampFormat string
+	// Components default method, path-query, timestamp and body-digest.
+	Components []HMACComponent
+	// Separator joins Components, default "\n".
+	Separator string
+	// Encoding of signature and body digest, "hex" (default) or "base64".
+	Encoding string
+}
+
+// Validate returns error when secret is empty or encoding is unknown.
+func (c HMACConfig) Validate() error {
+	var errs []error
+	if len(c.Secret) == 0 {
+		errs = append(errs, errors.New("hmac secret is empty"))
+	}
+
+	switch c.Encoding {
+	case "", "hex", "base64":
+	default:
+		errs = append(errs, fmt.Errorf("unsupported hmac encoding %q", c.Encoding))
+	}
+
+	for _, component := range c.Components {
+		switch component {
+		case HMACMethod, HMACPath, HMACPathQuery, HMACHost, HMACTimestamp, HMACBodyDigest, HMACBody:
+		default:
+			if !strings.HasPrefix(string(component), HMACHeaderPrefix) {
+				errs = append(errs, fmt.Errorf("unsupported hmac component %q", component))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// HMACSigner signs request using HMACConfig, see WithHMAC.
+type HMACSigner struct {
+	conf HMACConfig
+	now  func() time.Time
+}
+
+var _ RequestSigner = &HMACSigner{}
+
+// NewHMACSigner returns HMACSigner for conf.
+func NewHMACSigner(conf HMACConfig) (*HMACSigner, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	if conf.SignatureHeader == "" {
+		conf.SignatureHeader = "X-Signature"
+	}
+
+	if conf.TimestampHeader == "" {
+		conf.TimestampHeader = "X-Timestamp"
+	}
+
+	if conf.TimestampFormat == "" {
+		conf.TimestampFormat = "unix"
+	}
+
+	if conf.Components == nil {
+		conf.Components = []HMACComponent{HMACMethod, HMACPathQuery, HMACTimestamp, HMACBodyDigest}
+	}
+
+	if conf.Separator == "" {
+		conf.Separator = "\n"
+	}
+
+	if conf.Encoding == "" {
+		conf.Encoding = "hex"
+	}
+
+	return &HMACSigner{conf: conf, now: time.Now}, nil
+}
+
+// Sign sets timestamp, key id and signature header of request.
+func (s *HMACSigner) Sign(_ context.Context, request *http.Request) error {
+	request.Header.Set(s.conf.TimestampHeader, s.timestamp(s.now()))
+	if s.conf.KeyID != "" && s.conf.KeyIDHeader != "" {
+		request.Header.Set(s.conf.KeyIDHeader, s.conf.KeyID)
+	}
+
+	stringToSign, err := s.stringToSign(request)
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, s.conf.Secret)
+	mac.Write([]byte(stringToSign))
+
+	request.Header.Set(s.conf.SignatureHeader, s.conf.SignaturePrefix+s.encode(mac.Sum(nil)))
+	return nil
+}
+
+func (s *HMACSigner) stringToSign(request *http.Request) (string, error) {
+	values := make([]string, 0, len(s.conf.Components))
+	for _, component := range s.conf.Components {
+		switch component {
+		case HMACMethod:
+			values = append(values, strings.ToUpper(request.Method))
+		case HMACPath:
+			values = append(values, request.URL.EscapedPath())
+		case HMACPathQuery:
+			values = append(values, request.URL.RequestURI())
+		case HMACHost:
+			values = append(values, requestHost(request))
+		case HMACTimestamp:
+			values = append(values, request.Header.Get(s.conf.TimestampHeader))
+		case HMACBody, HMACBodyDigest:
+			body, known, err := readBody(request)
+			if err != nil {
+				return "", fmt.Errorf("fail read body for hmac: %s", err.Error())
+			}
+
+			if !known {
+				return "", errors.New("hmac can't sign streamed body")
+			}
+
+			if component == HMACBody {
+				values = append(values, string(body))
+				continue
+			}
+
+			digest := sha256.Sum256(body)
+			values = append(values, s.encode(digest[:]))
+		default:
+			values = append(values, request.Header.Get(strings.TrimPrefix(string(component), HMACHeaderPrefix)))
+		}
+	}
+
+	return strings.Join(values, s.conf.Separator), nil
+}
+
+func (s *HMACSigner) timestamp(now time.Time) string {
+	switch s.conf.TimestampFormat {
+	case "unix":
+		return strconv.FormatInt(now.Unix(), 10)
+	case "unix-milli":
+		return strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10)
+	default:
+		return now.UTC().Format(s.conf.TimestampFormat)
+	}
+}
+
+func (s *HMACSigner) encode(data []byte) string {
+	if s.conf.Encoding == "base64" {
+		return base64.StdEncoding.EncodeToString(data)
+	}
+
+	return hex.EncodeToString(data)
+}
@@ -0,0 +1,115 @@
+package rest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestHMACSigner(t *testing.T) {
+	convey.Convey("HMAC signer", t, func() {
+		ctx := context.Background()
+		now := time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.UTC)
+		sign := func(secret, data string) []byte {
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write([]byte(data))
+			return mac.Sum(nil)
+		}
+
+		convey.Convey("Should sign method, path, timestamp and body digest by default", func() {
+			signer, err := NewHMACSigner(HMACConfig{Secret: []byte("secret"), KeyID: "partner", KeyIDHeader: "X-Client-Id"})
+			convey.So(err, convey.ShouldBeNil)
+			signer.now = func() time.Time { return now }
+
+			request, _ := http.NewRequest(http.MethodPost, "https://api.example.com/v1/pay?ref=1", strings.NewReader(`{"amount": 1}`))
+			convey.So(signer.Sign(ctx, request), convey.ShouldBeNil)
+
+			digest := sha256.Sum256([]byte(`{"amount": 1}`))
+			want := sign("secret", "POST\n/v1/pay?ref=1\n1704164645\n"+hex.EncodeToString(digest[:]))
+			convey.So(request.Header.Get("X-Timestamp"), convey.ShouldEqual, "1704164645")
+			convey.So(request.Header.Get("X-Client-Id"), convey.ShouldEqual, "partner")
+			convey.So(request.Header.Get("X-Signature"), convey.ShouldEqual, hex.EncodeToString(want))
+		})
+
+		convey.Convey("Should follow configured scheme", func() {
+			signer, err := NewHMACSigner(HMACConfig{
+				Secret:          []byte("secret"),
+				SignatureHeader: "Authorization",
+				SignaturePrefix: "HMAC ",
+				TimestampHeader: "X-Date",
+				TimestampFormat: time.RFC3339,
+				Components:      []HMACComponent{HMACHost, HMACPath, HMACTimestamp, HMACHeaderPrefix + "X-Nonce", HMACBody},
+				Separator:       "|",
+				Encoding:        "base64",
+			})
+			convey.So(err, convey.ShouldBeNil)
+			signer.now = func() time.Time { return now }
+
+			request, _ := http.NewRequest(http.MethodGet, "https://api.example.com/v1/pay?ref=1", nil)
+			request.Header.Set("X-Nonce", "n1")
+			convey.So(signer.Sign(ctx, request), convey.ShouldBeNil)
+
+			want := sign("secret", "api.example.com|/v1/pay|2024-01-02T03:04:05Z|n1|")
+			convey.So(request.Header.Get("Authorization"), convey.ShouldEqual, "HMAC "+base64.StdEncoding.EncodeToString(want))
+		})
+
+		convey.Convey("Should format unix milli timestamp", func() {
+			signer, _ := NewHMACSigner(HMACConfig{Secret: []byte("secret"), TimestampFormat: "unix-milli"})
+			convey.So(signer.timestamp(now), convey.ShouldEqual, "1704164645006")
+		})
+
+		convey.Convey("Should return error for streamed body", func() {
+			signer, _ := NewHMACSigner(HMACConfig{Secret: []byte("secret")})
+			request, _ := http.NewRequest(http.MethodPost, "https://api.example.com/", strings.NewReader("data"))
+			request.GetBody = nil
+
+			convey.So(signer.Sign(ctx, request), convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Should validate config", func() {
+			_, err := NewHMACSigner(HMACConfig{Encoding: "base32", Components: []HMACComponent{"query"}})
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(err.Error(), convey.ShouldContainSubstring, "secret")
+			convey.So(err.Error(), convey.ShouldContainSubstring, "base32")
+			convey.So(err.Error(), convey.ShouldContainSubstring, "query")
+		})
+	})
+}
+
+func TestWithHMAC(t *testing.T) {
+	convey.Convey("Test WithHMAC", t, func() {
+		var sent *http.Request
+		testClient := &mockClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				sent = req
+				return doFuncMock([]byte(`{}`), nil)(req)
+			},
+		}
+
+		hook := new(lastHook)
+		client, err := DefaultClient(testClient, AddHook(hook), WithHMAC(HMACConfig{
+			Secret:     []byte("secret"),
+			Components: []HMACComponent{HMACMethod, HMACHeaderPrefix + "Correlation-ID"},
+		}))
+		convey.So(err, convey.ShouldBeNil)
+
+		_, err = client.Get(context.Background(), "abc", "https://example.com/", http.Header{})
+		convey.So(err, convey.ShouldBeNil)
+
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte("GET\nabc"))
+		convey.So(sent.Header.Get("X-Signature"), convey.ShouldEqual, hex.EncodeToString(mac.Sum(nil)))
+		convey.So(hook.data.Request.Header.Get("X-Signature"), convey.ShouldBeEmpty)
+
+		_, err = DefaultClient(testClient, WithHMAC(HMACConfig{}))
+		convey.So(err, convey.ShouldNotBeNil)
+	})
+}
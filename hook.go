@@ -11,13 +11,20 @@ type Hook interface {
 }
 
 type HookData struct {
-	Error         error       `json:"error"`
-	URL           string      `json:"url"`
-	CURL          string      `json:"curl"`
-	StartTime     time.Time   `json:"start_time"`
-	Request       HttpRequest `json:"request"`
-	Response      ResponseRaw `json:"response"`
-	CorrelationID string      `json:"correlation_id"`
+	Error          error       `json:"error"`
+	URL            string      `json:"url"`
+	CURL           string      `json:"curl"`
+	StartTime      time.Time   `json:"start_time"`
+	Request        HttpRequest `json:"request"`
+	Response       ResponseRaw `json:"response"`
+	CorrelationID  string      `json:"correlation_id"`
+	IdempotencyKey string      `json:"idempotency_key,omitempty"` // see WithIdempotency
+	Collapsed      bool        `json:"collapsed"`                 // response is shared with identical request in flight, see WithSingleflight
+	RequestSize    BodySize    `json:"request_size"`
+	ResponseSize   BodySize    `json:"response_size"`
+	Faults         []FaultKind `json:"faults,omitempty"` // faults injected to this request, see WithFaultInjection
+	Timings        Timings     `json:"timings"`
+	Truncated      bool        `json:"truncated,omitempty"` // response body exceeds the limit and is not read entirely, see WithMaxResponseBytes
 }
 
 type NoopHook struct{}
@@ -1,39 +1,158 @@
 package rest
 
 import (
+	"crypto/tls"
+	"log"
+	"net"
 	"net/http"
 	"time"
 )
 
+// ConfigTransport configures http.Transport, zero value uses the default written in each field.
 type ConfigTransport struct {
-	TLSHandshakeTimeout int `json:"tls_handshake_timeout"` // in second, default 5 seconds
+	TLSHandshakeTimeout   Duration  `json:"tls_handshake_timeout" yaml:"tls_handshake_timeout"`     // default 5 seconds
+	DialTimeout           Duration  `json:"dial_timeout" yaml:"dial_timeout"`                       // default 5 seconds
+	KeepAlive             Duration  `json:"keep_alive" yaml:"keep_alive"`                           // default 30 seconds, negative disables TCP keep-alive
+	MaxIdleConns          int       `json:"max_idle_conns" yaml:"max_idle_conns"`                   // default 512
+	MaxIdleConnsPerHost   int       `json:"max_idle_conns_per_host" yaml:"max_idle_conns_per_host"` // default 128
+	MaxConnsPerHost       int       `json:"max_conns_per_host" yaml:"max_conns_per_host"`           // default 0, means no limit
+	IdleConnTimeout       Duration  `json:"idle_conn_timeout" yaml:"idle_conn_timeout"`             // default 90 seconds
+	ResponseHeaderTimeout Duration  `json:"response_header_timeout" yaml:"response_header_timeout"` // default 0, means only limited by client timeout
+	ExpectContinueTimeout Duration  `json:"expect_continue_timeout" yaml:"expect_continue_timeout"` // default 1 second
+	DisableHTTP2          bool      `json:"disable_http2" yaml:"disable_http2"`                     // default false, HTTP/2 is used when server supports it
+	DisableCompression    bool      `json:"disable_compression" yaml:"disable_compression"`         // default false, gzip is requested transparently
+	TLS                   ConfigTLS `json:"tls" yaml:"tls"`
 }
 
 type ConfigClient struct {
-	Timeout int `json:"timeout"` // in second, default 30 seconds
+	Timeout Duration `json:"timeout" yaml:"timeout"` // default 30 seconds
 }
 
 type Config struct {
-	Transport ConfigTransport `json:"transport"`
-	Client    ConfigClient    `json:"client"`
+	Transport ConfigTransport `json:"transport" yaml:"transport"`
+	Client    ConfigClient    `json:"client" yaml:"client"`
+	Proxy     ConfigProxy     `json:"proxy" yaml:"proxy"`
 }
 
-// NewHttpClient return golang native http client
+// withDefault fills zero value with production-ready default.
+func (c ConfigTransport) withDefault() ConfigTransport {
+	if c.TLSHandshakeTimeout <= 0 {
+		c.TLSHandshakeTimeout = Duration(5 * time.Second)
+	}
+
+	if c.DialTimeout <= 0 {
+		c.DialTimeout = Duration(5 * time.Second)
+	}
+
+	if c.KeepAlive == 0 {
+		c.KeepAlive = Duration(30 * time.Second)
+	}
+
+	if c.MaxIdleConns <= 0 {
+		c.MaxIdleConns = 512
+	}
+
+	if c.MaxIdleConnsPerHost <= 0 {
+		c.MaxIdleConnsPerHost = 128
+	}
+
+	if c.IdleConnTimeout <= 0 {
+		c.IdleConnTimeout = Duration(90 * time.Second)
+	}
+
+	if c.ExpectContinueTimeout <= 0 {
+		c.ExpectContinueTimeout = Duration(time.Second)
+	}
+
+	return c
+}
+
+// newTransport returns http.Transport configured using ConfigTransport
+func newTransport(config ConfigTransport) (*http.Transport, error) {
+	config = config.withDefault()
+
+	tlsConfig, err := newTLSConfig(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   config.DialTimeout.Std(),
+		KeepAlive: config.KeepAlive.Std(),
+	}
+
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   config.TLSHandshakeTimeout.Std(),
+		MaxIdleConns:          config.MaxIdleConns,
+		MaxIdleConnsPerHost:   config.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       config.MaxConnsPerHost,
+		IdleConnTimeout:       config.IdleConnTimeout.Std(),
+		ResponseHeaderTimeout: config.ResponseHeaderTimeout.Std(),
+		ExpectContinueTimeout: config.ExpectContinueTimeout.Std(),
+		ForceAttemptHTTP2:     !config.DisableHTTP2,
+		DisableCompression:    config.DisableCompression,
+		TLSClientConfig:       tlsConfig,
+	}
+
+	if config.DisableHTTP2 {
+		// non-nil empty map disables HTTP/2, see http.Transport.TLSNextProto
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+
+	return transport, nil
+}
+
+// NewHttpClient return golang native http client.
+// When config can't be loaded, e.g. TLS certificate file is missing, the error is logged and every request
+// sent using the client fails with it, so a broken TLS config never falls back to a weaker one.
+//
+// Deprecated: use BuildHttpClient, which returns the error when the client is built.
 func NewHttpClient(config Config) *http.Client {
-	if config.Transport.TLSHandshakeTimeout <= 0 {
-		config.Transport.TLSHandshakeTimeout = 5
+	client, err := BuildHttpClient(config)
+	if err != nil {
+		log.Printf("rest: fail build http client: %s", err.Error())
+		return &http.Client{Transport: errorTransport{err: err}}
+	}
+
+	return client
+}
+
+// errorTransport fails every request with err.
+type errorTransport struct {
+	err error
+}
+
+func (t errorTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body != nil {
+		_ = request.Body.Close()
+	}
+
+	return nil, t.err
+}
+
+// BuildHttpClient return golang native http client, or error when config is invalid or TLS config can't be loaded.
+// Timeout below 1ms is rejected, since it is most likely a number of seconds written before timeouts became Duration.
+func BuildHttpClient(config Config) (*http.Client, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
 	}
 
 	if config.Client.Timeout <= 0 {
-		config.Client.Timeout = 30
+		config.Client.Timeout = Duration(30 * time.Second)
 	}
 
-	var netTransport = &http.Transport{
-		TLSHandshakeTimeout: time.Duration(config.Transport.TLSHandshakeTimeout) * time.Second,
+	transport, err := newTransport(config.Transport)
+	if err != nil {
+		return nil, err
 	}
 
-	return &http.Client{
-		Transport: netTransport,
-		Timeout:   time.Duration(config.Client.Timeout) * time.Second,
+	if transport.Proxy, err = newProxySelector(config.Proxy); err != nil {
+		return nil, err
 	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   config.Client.Timeout.Std(),
+	}, nil
 }
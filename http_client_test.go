@@ -2,6 +2,7 @@ package rest
 
 import (
 	"testing"
+	"time"
 
 	"github.com/smartystreets/goconvey/convey"
 )
@@ -13,5 +14,61 @@ func TestNewHttpClient(t *testing.T) {
 			netClient := NewHttpClient(conf)
 			convey.So(netClient, convey.ShouldNotBeNil)
 		})
+
+		convey.Convey("Should reject timeout written as number of seconds", func() {
+			_, err := BuildHttpClient(Config{Client: ConfigClient{Timeout: 30}})
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(err.Error(), convey.ShouldContainSubstring, "client.timeout 30ns is too small")
+
+			_, err = BuildHttpClient(Config{Transport: ConfigTransport{TLSHandshakeTimeout: 5}})
+			convey.So(err, convey.ShouldNotBeNil)
+
+			_, err = NewHttpClient(Config{Client: ConfigClient{Timeout: 30}}).Get("http://example.com/")
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(err.Error(), convey.ShouldContainSubstring, "client.timeout 30ns is too small")
+
+			_, err = DefaultClient(NewHttpClient(Config{}), WithCircuitBreaker(CBConfig{Timeout: 60}))
+			convey.So(err, convey.ShouldNotBeNil)
+
+			_, err = DefaultClient(NewHttpClient(Config{}), WithCircuitBreaker(CBConfig{Timeout: Duration(time.Minute)}))
+			convey.So(err, convey.ShouldBeNil)
+		})
+	})
+}
+
+func TestNewTransport(t *testing.T) {
+	convey.Convey("Test new transport", t, func() {
+		convey.Convey("Zero config should use production-ready default", func() {
+			transport, err := newTransport(ConfigTransport{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(transport.TLSHandshakeTimeout, convey.ShouldEqual, 5*time.Second)
+			convey.So(transport.MaxIdleConns, convey.ShouldEqual, 512)
+			convey.So(transport.MaxIdleConnsPerHost, convey.ShouldEqual, 128)
+			convey.So(transport.MaxConnsPerHost, convey.ShouldEqual, 0)
+			convey.So(transport.IdleConnTimeout, convey.ShouldEqual, 90*time.Second)
+			convey.So(transport.ExpectContinueTimeout, convey.ShouldEqual, time.Second)
+			convey.So(transport.ForceAttemptHTTP2, convey.ShouldBeTrue)
+			convey.So(transport.TLSNextProto, convey.ShouldBeNil)
+			convey.So(transport.DialContext, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Config value should be used", func() {
+			transport, err := newTransport(ConfigTransport{
+				MaxIdleConns:          10,
+				MaxIdleConnsPerHost:   5,
+				MaxConnsPerHost:       20,
+				ResponseHeaderTimeout: Duration(250 * time.Millisecond),
+				DisableHTTP2:          true,
+				DisableCompression:    true,
+			})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(transport.MaxIdleConns, convey.ShouldEqual, 10)
+			convey.So(transport.MaxIdleConnsPerHost, convey.ShouldEqual, 5)
+			convey.So(transport.MaxConnsPerHost, convey.ShouldEqual, 20)
+			convey.So(transport.ResponseHeaderTimeout, convey.ShouldEqual, 250*time.Millisecond)
+			convey.So(transport.ForceAttemptHTTP2, convey.ShouldBeFalse)
+			convey.So(transport.TLSNextProto, convey.ShouldNotBeNil)
+			convey.So(transport.DisableCompression, convey.ShouldBeTrue)
+		})
 	})
 }
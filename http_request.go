@@ -3,12 +3,16 @@ package rest
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/opentracing/opentracing-go"
@@ -18,12 +22,27 @@ import (
 
 // DefaultHttpRequester will simplify http request specific to this package's need
 type DefaultHttpRequester struct {
-	client HttpClient
-	hook   []Hook
+	client      HttpClient
+	hook        []Hook
+	flight      *flightGroup
+	compression *CompressionConfig
+	codecs      *CodecRegistry
+	jsonNumber  JSONNumberMode
+	tokens      TokenSource
+	digest      *DigestAuth
+	signers     []RequestSigner
+	faults      *FaultInjector
+	idempotency *IdempotencyConfig
+
+	maxResponseBytes int64
+
+	base    HttpClient  // client given to DefaultClient, without options
+	closers []io.Closer // background work started by options, see Close
 }
 
 // Validates that current implementation is implement HttpRequester interface.
 var _ HttpRequester = &DefaultHttpRequester{}
+var _ FormRequester = &DefaultHttpRequester{}
 
 // DefaultClient will do http request using selected client.
 // By using this, you can log http
@@ -35,10 +54,12 @@ func DefaultClient(client HttpClient, opts ...Option) (*DefaultHttpRequester, er
 	defaultClient := &DefaultHttpRequester{
 		client: client,
 		hook:   make([]Hook, 0),
+		base:   client,
 	}
 
 	for _, o := range opts {
 		if err := o(defaultClient); err != nil {
+			_ = defaultClient.Close()
 			return nil, err
 		}
 	}
@@ -46,6 +67,19 @@ func DefaultClient(client HttpClient, opts ...Option) (*DefaultHttpRequester, er
 	return defaultClient, nil
 }
 
+// Close stops background work started by options, such as WithEndpoints health checks.
+// The requester can still send requests after Close.
+func (r *DefaultHttpRequester) Close() error {
+	var errs []error
+	for _, closer := range r.closers {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 func (r DefaultHttpRequester) beforeHook(ctx context.Context, data HookData) {
 	for _, hook := range r.hook {
 		if hook == nil {
@@ -145,11 +179,37 @@ func (r DefaultHttpRequester) call(
 	path string,
 	requestHeader http.Header,
 	requestBody []byte,
+) (ret HttpResponse, err error) {
+	return r.do(ctx, method, correlationID, path, requestHeader, outgoingBody{data: requestBody})
+}
+
+// outgoingBody is the request body sent by do
+type outgoingBody struct {
+	data          []byte
+	stream        io.Reader       // sent instead of data with unknown length, e.g. multipart upload
+	form          url.Values      // url-encoded form, shown in hook
+	multipartForm *multipart.Form // multipart fields and files, shown in hook
+}
+
+func (r DefaultHttpRequester) do(
+	ctx context.Context,
+	method,
+	correlationID,
+	path string,
+	requestHeader http.Header,
+	outgoing outgoingBody,
 ) (ret HttpResponse, err error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "call")
 	now := time.Now()
 	request := &http.Request{}
 	requestRaw := HttpRequest{}
+	collapsed := false
+	idempotencyKey := ""
+	truncated := false
+	var faults *injectedFaults
+	timing := newTimingTrace(now)
+	requestSize := BodySize{}
+	responseSize := BodySize{}
 
 	span.LogFields(
 		log.String("method", method),
@@ -157,17 +217,33 @@ func (r DefaultHttpRequester) call(
 		log.Object("header", requestHeader),
 	)
 
+	// the request gets its own header, so headers set below such as idempotency key
+	// don't leak into the next request sent with the same caller header
+	requestHeader = cloneHeader(requestHeader)
+
 	requestHeader.Set(correlationIDKey, correlationID)
 
+	// closed even when the request fails before the stream is read, so readers of its parts such as files are closed
+	if closer, ok := outgoing.stream.(io.Closer); ok {
+		defer closer.Close()
+	}
+
 	defer func() {
 		r.afterHook(ctx, HookData{
-			Error:         err,
-			URL:           path,
-			CURL:          ret.CURL,
-			StartTime:     now,
-			Request:       requestRaw,
-			Response:      ret.Raw,
-			CorrelationID: correlationID,
+			Error:          err,
+			URL:            path,
+			CURL:           ret.CURL,
+			StartTime:      now,
+			Request:        requestRaw,
+			Response:       ret.Raw,
+			CorrelationID:  correlationID,
+			IdempotencyKey: idempotencyKey,
+			Collapsed:      collapsed,
+			RequestSize:    requestSize,
+			ResponseSize:   responseSize,
+			Faults:         faults.list(),
+			Timings:        timing.timings(),
+			Truncated:      truncated,
 		})
 
 		span.Finish()
@@ -177,12 +253,16 @@ func (r DefaultHttpRequester) call(
 	request.Method = method
 	request.URL = &url.URL{}
 	request.Header = requestHeader
-	request.Body = ioutil.NopCloser(bytes.NewBuffer(requestBody))
-	request.ContentLength = int64(len(requestBody))
+	request.Body = ioutil.NopCloser(bytes.NewBuffer(outgoing.data))
+	request.ContentLength = int64(len(outgoing.data))
+	request.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(outgoing.data)), nil
+	}
 
 	ret = HttpResponse{}
 	ret.CURL = ""
 	ret.Raw = ResponseRaw{}
+	ret.codecs = r.codecs
 
 	requestURL, err := url.Parse(path)
 	if err != nil {
@@ -202,18 +282,78 @@ func (r DefaultHttpRequester) call(
 	}
 
 	request.URL = requestURL
+	if r.faults != nil {
+		faults = new(injectedFaults)
+		ctx = context.WithValue(ctx, faultsKey{}, faults)
+	}
+
+	// the limit is put in ctx, so clients buffering the body such as cache stop reading at the limit too
+	limit, ok := maxResponseBytesFromContext(ctx)
+	if !ok && r.maxResponseBytes > 0 {
+		limit = r.maxResponseBytes
+		ctx = ContextWithMaxResponseBytes(ctx, limit)
+	}
+
+	// ctx carries the trace, so copies of the request made by signer and authorization keep it
+	ctx = httptrace.WithClientTrace(ctx, timing.trace())
 	request = request.WithContext(ctx)
 	_ = span.Tracer().Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(request.Header))
 
+	if r.compression != nil && r.compression.DecodeResponse && request.Header.Get("Accept-Encoding") == "" {
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+
+	if r.codecs != nil && request.Header.Get("Accept") == "" {
+		request.Header.Set("Accept", r.codecs.Accept())
+	}
+
+	idempotencyKey, err = r.idempotency.apply(ctx, request)
+	if err != nil {
+		return ret, err
+	}
+
 	if command, errCurl := http2curl.GetCurlCommand(request); errCurl == nil {
 		ret.CURL = command.String()
 	}
 
+	if outgoing.stream != nil {
+		// stream can only be read once, so it is set after curl command is generated
+		stream := &countingReader{reader: outgoing.stream}
+		request.Body = stream
+		request.ContentLength = -1
+		request.GetBody = nil
+
+		defer func() {
+			requestSize = BodySize{
+				Compressed:   stream.count(),
+				Uncompressed: stream.count(),
+			}
+		}()
+	} else {
+		// compress after curl command is generated, so the command stays readable and reproducible
+		wireBody, err := r.compression.compressRequest(request, outgoing.data)
+		if err != nil {
+			return ret, err
+		}
+
+		requestSize = BodySize{
+			Compressed:   int64(len(wireBody)),
+			Uncompressed: int64(len(outgoing.data)),
+		}
+	}
+
 	var reqBodyInterface interface{}
-	if err := json.Unmarshal(requestBody, &reqBodyInterface); err != nil {
-		reqBodyInterface = string(requestBody)
+	switch {
+	case outgoing.form != nil:
+		reqBodyInterface = outgoing.form
+	case outgoing.multipartForm != nil:
+		reqBodyInterface = nil
+	default:
+		reqBodyInterface = decodeBody(r.jsonNumber, r.codecs, request.Header.Get("Content-Type"), outgoing.data)
 	}
 
+	form, postForm := outgoing.values(requestURL)
+
 	requestRaw = HttpRequest{
 		Method:           request.Method,
 		URL:              requestURL,
@@ -226,9 +366,9 @@ func (r DefaultHttpRequester) call(
 		TransferEncoding: request.TransferEncoding,
 		Close:            request.Close,
 		Host:             request.Host,
-		Form:             request.Form,
-		PostForm:         request.PostForm,
-		MultipartForm:    request.MultipartForm,
+		Form:             form,
+		PostForm:         postForm,
+		MultipartForm:    outgoing.multipartForm,
 		Trailer:          request.Trailer,
 		RemoteAddr:       request.RemoteAddr,
 		RequestURI:       request.RequestURI,
@@ -236,20 +376,40 @@ func (r DefaultHttpRequester) call(
 	}
 
 	r.beforeHook(ctx, HookData{
-		Error:         nil,
-		URL:           path,
-		CURL:          ret.CURL,
-		StartTime:     now,
-		Request:       requestRaw,
-		Response:      ret.Raw,
-		CorrelationID: correlationID,
+		Error:          nil,
+		URL:            path,
+		CURL:           ret.CURL,
+		StartTime:      now,
+		Request:        requestRaw,
+		Response:       ret.Raw,
+		CorrelationID:  correlationID,
+		IdempotencyKey: idempotencyKey,
 	})
 
 	span.LogFields(
 		log.String("curl", ret.CURL),
 	)
 
-	resp, errHttp := r.client.Do(request)
+	var (
+		resp    *http.Response
+		errHttp error
+	)
+
+	send := func(request *http.Request) (*http.Response, error) {
+		if r.flight == nil || method != http.MethodGet {
+			return r.client.Do(request)
+		}
+
+		resp, shared, err := r.flight.do(r.client, request)
+		collapsed = shared
+		span.LogFields(
+			log.Bool("singleflight_collapsed", collapsed),
+		)
+		return resp, err
+	}
+
+	resp, errHttp = r.authorize(ctx, request, r.sign(ctx, send))
+
 	if resp == nil {
 		if errHttp != nil {
 			// https://github.com/golang/go/blob/2d77d3330537e11a0d9a233ba5f4facf262e9d8c/src/net/http/client.go#L724
@@ -284,22 +444,47 @@ func (r DefaultHttpRequester) call(
 	ret.Raw.ContentLength = resp.ContentLength
 	ret.Raw.TransferEncoding = resp.TransferEncoding
 	ret.Raw.Uncompressed = resp.Uncompressed
+	ret.CacheStatus = parseCacheStatus(resp.Header)
+
+	if limit > 0 && resp.ContentLength > limit {
+		truncated = true
+		err = fmt.Errorf("%w: content length %d exceeds %d bytes", ErrResponseTooLarge, resp.ContentLength, limit)
+		return
+	}
+
+	wireBody, err := readLimited(resp.Body, limit)
+	timing.done()
+	if errors.Is(err, ErrResponseTooLarge) {
+		truncated = true
+		err = fmt.Errorf("%w: body exceeds %d bytes", ErrResponseTooLarge, limit)
+		return
+	}
 
-	buf := new(bytes.Buffer)
-	defer buf.Reset()
-	_, err = buf.ReadFrom(resp.Body)
 	if err != nil {
 		err = fmt.Errorf("error read body response %s", err.Error())
 		return
 	}
 
-	ret.Raw.Body = buf.String()
-	var body interface{}
-	if err := json.Unmarshal(buf.Bytes(), &body); err == nil {
-		ret.Raw.Body = body
+	respBody, err := r.compression.decodeResponse(&ret.Raw, wireBody, limit)
+	if errors.Is(err, ErrResponseTooLarge) {
+		truncated = true
+		err = fmt.Errorf("%w: decoded body exceeds %d bytes", ErrResponseTooLarge, limit)
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("error decode body response %s", err.Error())
+		return
+	}
+
+	responseSize = BodySize{
+		Compressed:   int64(len(wireBody)),
+		Uncompressed: int64(len(respBody)),
 	}
 
-	ret.RespBody = buf.Bytes()
+	ret.Raw.Body = decodeBody(r.jsonNumber, r.codecs, ret.Raw.Header.Get("Content-Type"), respBody)
+
+	ret.RespBody = respBody
 
 	// Last handle of HTTP error
 	if errHttp != nil {
@@ -308,3 +493,57 @@ func (r DefaultHttpRequester) call(
 
 	return
 }
+
+// cloneHeader returns a copy of the caller header that can be modified, or an empty header for nil.
+func cloneHeader(header http.Header) http.Header {
+	if header == nil {
+		return http.Header{}
+	}
+
+	return header.Clone()
+}
+
+// values returns url query and form values as http.Request.ParseMultipartForm does.
+// It returns nil values when body is neither url-encoded nor multipart form.
+func (b outgoingBody) values(requestURL *url.URL) (form, postForm url.Values) {
+	switch {
+	case b.form != nil:
+		postForm = b.form
+	case b.multipartForm != nil:
+		postForm = b.multipartForm.Value
+	default:
+		return nil, nil
+	}
+
+	form = requestURL.Query()
+	for key, values := range postForm {
+		form[key] = append(form[key], values...)
+	}
+
+	return form, postForm
+}
+
+// countingReader counts the bytes read, it is safe to call count while reading.
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+// Close closes the reader when it is io.Closer, so http.Client can stop the stream.
+func (c *countingReader) Close() error {
+	if closer, ok := c.reader.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+func (c *countingReader) count() int64 {
+	return atomic.LoadInt64(&c.n)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -73,6 +74,28 @@ func (m *Mock) Delete(ctx context.Context, correlationID, path string, requestHe
 	return ret, args.Error(1)
 }
 
+func (m *Mock) PostForm(ctx context.Context, correlationID, path string, requestHeader http.Header, form url.Values) (ret HttpResponse, err error) {
+	args := m.Called(ctx, correlationID, path, requestHeader, form)
+
+	ret, ok := args.Get(0).(HttpResponse)
+	if !ok {
+		return HttpResponse{}, fmt.Errorf("not HttpResponse type")
+	}
+
+	return ret, args.Error(1)
+}
+
+func (m *Mock) PostMultipart(ctx context.Context, correlationID, path string, requestHeader http.Header, body *Multipart) (ret HttpResponse, err error) {
+	args := m.Called(ctx, correlationID, path, requestHeader, body)
+
+	ret, ok := args.Get(0).(HttpResponse)
+	if !ok {
+		return HttpResponse{}, fmt.Errorf("not HttpResponse type")
+	}
+
+	return ret, args.Error(1)
+}
+
 // NewMock implements AuthVirgoHttpRequester interface
 func NewMock() *Mock {
 	return &Mock{}
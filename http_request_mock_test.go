@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
 	"testing"
 
 	"github.com/smartystreets/goconvey/convey"
@@ -217,3 +218,61 @@ func TestMockDelete(t *testing.T) {
 		})
 	})
 }
+
+func TestMockPostForm(t *testing.T) {
+	convey.Convey("New httpclient.Mock", t, func() {
+		convey.Convey("When call PostForm then return not HttpResponse object", func() {
+			client := NewMock()
+
+			ctx := context.Background()
+			client.On("PostForm", ctx, mock.Anything, "/", http.Header{}, url.Values{}).
+				Return(wantResp, nil)
+
+			res, err := client.PostForm(ctx, "", "/", http.Header{}, url.Values{})
+			convey.So(res, convey.ShouldResemble, HttpResponse{})
+			convey.So(err, convey.ShouldResemble, fmt.Errorf("not HttpResponse type"))
+		})
+
+		convey.Convey("When call PostForm then return expected", func() {
+			client := NewMock()
+			want := HttpResponse{RespBody: []byte("hello")}
+
+			ctx := context.Background()
+			client.On("PostForm", ctx, mock.Anything, "/", http.Header{}, url.Values{"a": {"1"}}).
+				Return(want, nil)
+
+			res, err := client.PostForm(ctx, "", "/", http.Header{}, url.Values{"a": {"1"}})
+			convey.So(res, convey.ShouldResemble, want)
+			convey.So(err, convey.ShouldBeNil)
+		})
+	})
+}
+
+func TestMockPostMultipart(t *testing.T) {
+	convey.Convey("New httpclient.Mock", t, func() {
+		convey.Convey("When call PostMultipart then return not HttpResponse object", func() {
+			client := NewMock()
+
+			ctx := context.Background()
+			client.On("PostMultipart", ctx, mock.Anything, "/", http.Header{}, mock.Anything).
+				Return(wantResp, nil)
+
+			res, err := client.PostMultipart(ctx, "", "/", http.Header{}, NewMultipart())
+			convey.So(res, convey.ShouldResemble, HttpResponse{})
+			convey.So(err, convey.ShouldResemble, fmt.Errorf("not HttpResponse type"))
+		})
+
+		convey.Convey("When call PostMultipart then return expected", func() {
+			client := NewMock()
+			want := HttpResponse{RespBody: []byte("hello")}
+
+			ctx := context.Background()
+			client.On("PostMultipart", ctx, mock.Anything, "/", http.Header{}, mock.Anything).
+				Return(want, nil)
+
+			res, err := client.PostMultipart(ctx, "", "/", http.Header{}, NewMultipart())
+			convey.So(res, convey.ShouldResemble, want)
+			convey.So(err, convey.ShouldBeNil)
+		})
+	})
+}
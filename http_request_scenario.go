@@ -0,0 +1,338 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// ErrUnexpectedCall returned by ScenarioMock when no expectation matches the request.
+var ErrUnexpectedCall = errors.New("unexpected call")
+
+// ScenarioMock is HttpRequester and FormRequester mock with fluent expectations, e.g.
+//
+//	m := rest.NewScenarioMock(t)
+//	m.OnGet("/users/1").WithHeader("X-Tenant", "a").ReturnJSON(200, user)
+//
+// Every method is the DefaultHttpRequester one sending to the mock instead of network,
+// so context and correlation ID are ignored and new methods are covered without changing the mock.
+// Unexpected calls and calls out of order fail the test.
+type ScenarioMock struct {
+	*DefaultHttpRequester
+
+	t mock.TestingT
+
+	mu           sync.Mutex
+	expectations []*Expectation
+	ordered      bool
+	cursor       int
+}
+
+// NewScenarioMock returns ScenarioMock reporting failures to t.
+func NewScenarioMock(t mock.TestingT) *ScenarioMock {
+	m := &ScenarioMock{t: t}
+	m.DefaultHttpRequester = &DefaultHttpRequester{
+		client: scenarioClient{mock: m},
+		hook:   make([]Hook, 0),
+	}
+
+	return m
+}
+
+// InOrder requires expectations to be called in the registered order.
+// Next expectation can be called once the previous one is called its minimum times.
+func (m *ScenarioMock) InOrder() *ScenarioMock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ordered = true
+	return m
+}
+
+// On expects request with method and path. Path with scheme is compared with the full URL,
+// otherwise with URL path, and with query too when path has "?".
+func (m *ScenarioMock) On(method, path string) *Expectation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expectation := &Expectation{
+		method: method,
+		path:   path,
+		status: http.StatusOK,
+		header: http.Header{},
+	}
+	m.expectations = append(m.expectations, expectation)
+	return expectation
+}
+
+// OnGet expects GET request to path.
+func (m *ScenarioMock) OnGet(path string) *Expectation {
+	return m.On(http.MethodGet, path)
+}
+
+// OnPost expects POST request to path, PostForm and PostMultipart included.
+func (m *ScenarioMock) OnPost(path string) *Expectation {
+	return m.On(http.MethodPost, path)
+}
+
+// OnPut expects PUT request to path.
+func (m *ScenarioMock) OnPut(path string) *Expectation {
+	return m.On(http.MethodPut, path)
+}
+
+// OnPatch expects PATCH request to path.
+func (m *ScenarioMock) OnPatch(path string) *Expectation {
+	return m.On(http.MethodPatch, path)
+}
+
+// OnDelete expects DELETE request to path.
+func (m *ScenarioMock) OnDelete(path string) *Expectation {
+	return m.On(http.MethodDelete, path)
+}
+
+// AssertExpectations fails the test when an expectation is not called its minimum times.
+func (m *ScenarioMock) AssertExpectations() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ok := true
+	for _, expectation := range m.expectations {
+		if !expectation.satisfied() {
+			m.t.Errorf("%s is called %d times, want %s", expectation, expectation.calls, expectation.want())
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+// handle returns response of the expectation matching request.
+func (m *ScenarioMock) handle(request *http.Request) (*http.Response, error) {
+	var body []byte
+	if request.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(request.Body)
+		_ = request.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("fail read request body: %s", err.Error())
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	start := 0
+	if m.ordered {
+		start = m.cursor
+	}
+
+	for i := start; i < len(m.expectations); i++ {
+		expectation := m.expectations[i]
+		if expectation.exhausted() || !expectation.matches(request, body) {
+			continue
+		}
+
+		if m.ordered {
+			for _, previous := range m.expectations[m.cursor:i] {
+				if !previous.satisfied() {
+					m.t.Errorf("%s %s is called before %s", request.Method, request.URL.String(), previous)
+					return unexpectedCall(request)
+				}
+			}
+			m.cursor = i
+		}
+
+		expectation.calls++
+		return expectation.response(request)
+	}
+
+	m.t.Errorf("%s: %s %s", ErrUnexpectedCall.Error(), request.Method, request.URL.String())
+	return unexpectedCall(request)
+}
+
+// unexpectedCall returns empty response with error, so DefaultHttpRequester returns ErrUnexpectedCall as is.
+func unexpectedCall(request *http.Request) (*http.Response, error) {
+	return &http.Response{
+		Header:  http.Header{},
+		Body:    ioutil.NopCloser(bytes.NewReader(nil)),
+		Request: request,
+	}, fmt.Errorf("%w: %s %s", ErrUnexpectedCall, request.Method, request.URL.String())
+}
+
+type scenarioClient struct {
+	mock *ScenarioMock
+}
+
+func (c scenarioClient) Do(request *http.Request) (*http.Response, error) {
+	return c.mock.handle(request)
+}
+
+// Expectation is an expected request and its response, see ScenarioMock.On.
+type Expectation struct {
+	method   string
+	path     string
+	matchers []func(request *http.Request, body []byte) bool
+	times    int
+
+	status int
+	header http.Header
+	body   []byte
+	err    error
+
+	calls int
+}
+
+// WithHeader expects request header key to have value.
+func (e *Expectation) WithHeader(key, value string) *Expectation {
+	return e.Match(func(request *http.Request, _ []byte) bool {
+		return request.Header.Get(key) == value
+	})
+}
+
+// WithBody expects request body equal to body.
+func (e *Expectation) WithBody(body string) *Expectation {
+	return e.Match(func(_ *http.Request, got []byte) bool {
+		return string(got) == body
+	})
+}
+
+// WithJSON expects request body to be JSON equal to v, regardless of key order and spacing.
+func (e *Expectation) WithJSON(v interface{}) *Expectation {
+	encoded, _ := json.Marshal(v)
+
+	var want interface{}
+	_ = json.Unmarshal(encoded, &want)
+
+	return e.Match(func(_ *http.Request, body []byte) bool {
+		var got interface{}
+		if err := json.Unmarshal(body, &got); err != nil {
+			return false
+		}
+
+		return reflect.DeepEqual(got, want)
+	})
+}
+
+// Match expects request and its body to satisfy fn.
+func (e *Expectation) Match(fn func(request *http.Request, body []byte) bool) *Expectation {
+	e.matchers = append(e.matchers, fn)
+	return e
+}
+
+// Times expects exactly n calls, default is at least once.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// Once expects exactly one call.
+func (e *Expectation) Once() *Expectation {
+	return e.Times(1)
+}
+
+// Return responds with status and body.
+func (e *Expectation) Return(status int, body string) *Expectation {
+	e.status = status
+	e.body = []byte(body)
+	return e
+}
+
+// ReturnJSON responds with status and v encoded as JSON.
+func (e *Expectation) ReturnJSON(status int, v interface{}) *Expectation {
+	body, err := json.Marshal(v)
+	if err != nil {
+		e.err = fmt.Errorf("fail encode mock response: %s", err.Error())
+	}
+
+	e.status = status
+	e.body = body
+	e.header.Set("Content-Type", MediaTypeJSON)
+	return e
+}
+
+// ReturnHeader adds response header.
+func (e *Expectation) ReturnHeader(key, value string) *Expectation {
+	e.header.Add(key, value)
+	return e
+}
+
+// ReturnError makes the call return err as is.
+func (e *Expectation) ReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// String describes the expected request.
+func (e *Expectation) String() string {
+	return e.method + " " + e.path
+}
+
+func (e *Expectation) matches(request *http.Request, body []byte) bool {
+	if request.Method != e.method {
+		return false
+	}
+
+	switch {
+	case strings.Contains(e.path, "://"):
+		if request.URL.String() != e.path {
+			return false
+		}
+	case strings.Contains(e.path, "?"):
+		if request.URL.RequestURI() != e.path {
+			return false
+		}
+	default:
+		if request.URL.Path != e.path {
+			return false
+		}
+	}
+
+	for _, match := range e.matchers {
+		if !match(request, body) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e *Expectation) exhausted() bool {
+	return e.times > 0 && e.calls >= e.times
+}
+
+func (e *Expectation) satisfied() bool {
+	if e.times > 0 {
+		return e.calls == e.times
+	}
+
+	return e.calls > 0
+}
+
+func (e *Expectation) want() string {
+	if e.times > 0 {
+		return fmt.Sprintf("exactly %d", e.times)
+	}
+
+	return "at least 1"
+}
+
+func (e *Expectation) response(request *http.Request) (*http.Response, error) {
+	if e.err != nil {
+		// DefaultHttpRequester returns error as is only when response is not nil
+		return &http.Response{
+			Header:  http.Header{},
+			Body:    ioutil.NopCloser(bytes.NewReader(nil)),
+			Request: request,
+		}, e.err
+	}
+
+	return NewResponse(request, e.status, e.header.Clone(), e.body), nil
+}
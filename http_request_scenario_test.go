@@ -0,0 +1,131 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// failures is mock.TestingT that records failures instead of failing the test.
+type failures struct {
+	messages []string
+}
+
+func (f *failures) Logf(format string, args ...interface{}) {}
+
+func (f *failures) Errorf(format string, args ...interface{}) {
+	f.messages = append(f.messages, fmt.Sprintf(format, args...))
+}
+
+func (f *failures) FailNow() {}
+
+func TestScenarioMock(t *testing.T) {
+	convey.Convey("Test ScenarioMock", t, func() {
+		ctx := context.Background()
+		failed := new(failures)
+		m := NewScenarioMock(failed)
+
+		var _ HttpRequester = m
+		var _ FormRequester = m
+
+		convey.Convey("Should match path and header, ignoring context and correlation ID", func() {
+			m.OnGet("/users/1").WithHeader("X-Tenant", "a").ReturnJSON(http.StatusOK, map[string]string{"name": "a"})
+			m.OnGet("/users/1").Return(http.StatusNotFound, "")
+
+			resp, err := m.Get(context.TODO(), "abc", "http://api.example.com/users/1", http.Header{"X-Tenant": {"a"}})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusOK)
+
+			var user struct{ Name string }
+			convey.So(resp.Decode(ctx, &user), convey.ShouldBeNil)
+			convey.So(user.Name, convey.ShouldEqual, "a")
+
+			resp, _ = m.Get(ctx, "", "http://api.example.com/users/1", http.Header{})
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusNotFound)
+
+			convey.So(m.AssertExpectations(), convey.ShouldBeTrue)
+			convey.So(failed.messages, convey.ShouldBeEmpty)
+		})
+
+		convey.Convey("Should match JSON body, query and full URL", func() {
+			m.OnPost("/orders").WithJSON(map[string]int{"amount": 10}).Return(http.StatusCreated, `{"id": 1}`)
+			m.OnDelete("/orders?force=true").Once()
+			m.OnPut("http://api.example.com/orders/1").ReturnHeader("ETag", `"v2"`)
+
+			resp, err := m.Post(ctx, "", "http://api.example.com/orders", http.Header{}, []byte(`{ "amount" : 10 }`))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusCreated)
+
+			_, err = m.Delete(ctx, "", "http://api.example.com/orders?force=true", http.Header{}, nil)
+			convey.So(err, convey.ShouldBeNil)
+
+			resp, _ = m.Put(ctx, "", "http://api.example.com/orders/1", http.Header{}, nil)
+			convey.So(resp.Raw.Header.Get("ETag"), convey.ShouldEqual, `"v2"`)
+
+			_, err = m.Post(ctx, "", "http://api.example.com/orders", http.Header{}, []byte(`{"amount": 11}`))
+			convey.So(errors.Is(err, ErrUnexpectedCall), convey.ShouldBeTrue)
+
+			_, err = m.Delete(ctx, "", "http://api.example.com/orders?force=true", http.Header{}, nil)
+			convey.So(errors.Is(err, ErrUnexpectedCall), convey.ShouldBeTrue)
+			convey.So(len(failed.messages), convey.ShouldEqual, 2)
+		})
+
+		convey.Convey("Should cover form methods", func() {
+			m.OnPost("/login").Match(func(request *http.Request, body []byte) bool {
+				return string(body) == "user=a"
+			}).Return(http.StatusNoContent, "")
+			m.OnPost("/upload")
+
+			resp, err := m.PostForm(ctx, "", "http://api.example.com/login", http.Header{}, url.Values{"user": {"a"}})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusNoContent)
+
+			resp, err = m.PostMultipart(ctx, "", "http://api.example.com/upload", http.Header{}, NewMultipart().Field("a", "1"))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusOK)
+		})
+
+		convey.Convey("Should return error as is", func() {
+			m.OnPatch("/orders/1").ReturnError(ErrHttpTimeout)
+
+			_, err := m.Patch(ctx, "", "http://api.example.com/orders/1", http.Header{}, nil)
+			convey.So(err, convey.ShouldEqual, ErrHttpTimeout)
+		})
+
+		convey.Convey("Should fail calls out of order", func() {
+			m.InOrder()
+			m.OnPost("/cart").Times(2)
+			m.OnPost("/checkout")
+
+			_, _ = m.Post(ctx, "", "http://api.example.com/cart", http.Header{}, nil)
+			_, err := m.Post(ctx, "", "http://api.example.com/checkout", http.Header{}, nil)
+			convey.So(errors.Is(err, ErrUnexpectedCall), convey.ShouldBeTrue)
+			convey.So(failed.messages[0], convey.ShouldContainSubstring, "is called before POST /cart")
+
+			_, _ = m.Post(ctx, "", "http://api.example.com/cart", http.Header{}, nil)
+			_, err = m.Post(ctx, "", "http://api.example.com/checkout", http.Header{}, nil)
+			convey.So(err, convey.ShouldBeNil)
+
+			_, err = m.Post(ctx, "", "http://api.example.com/cart", http.Header{}, nil)
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(m.AssertExpectations(), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("Should fail when expectation is not called", func() {
+			m.OnGet("/a")
+			m.OnGet("/b").Times(2)
+			_, _ = m.Get(ctx, "", "http://api.example.com/b", http.Header{})
+
+			convey.So(m.AssertExpectations(), convey.ShouldBeFalse)
+			convey.So(failed.messages, convey.ShouldResemble, []string{
+				"GET /a is called 0 times, want at least 1",
+				"GET /b is called 1 times, want exactly 2",
+			})
+		})
+	})
+}
@@ -1,18 +1,44 @@
 package rest
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 
 	"github.com/opentracing/opentracing-go"
 )
 
+// NewResponse returns HTTP/1.1 response to request with status, header and body, as sent by a server.
+// Nil header is sent as empty header. It is used by clients answering without calling upstream, e.g. in tests.
+func NewResponse(request *http.Request, status int, header http.Header, body []byte) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}
+}
+
 // HttpResponse add layer on top of http.Response
 type HttpResponse struct {
-	RespBody []byte
-	CURL     string
-	Raw      ResponseRaw
+	RespBody    []byte
+	CURL        string
+	Raw         ResponseRaw
+	CacheStatus CacheStatus // empty when WithCache is not used
+
+	codecs *CodecRegistry // used by Decode, DefaultCodecs when nil
 }
 
 type ResponseDecoder func(data []byte, v interface{}) error
@@ -46,3 +72,34 @@ func (h *HttpResponse) ToJson(ctx context.Context, out interface{}) error {
 
 	return h.To(ctx, json.Unmarshal, out)
 }
+
+// Decode unmarshal body to out using the codec registered for the response Content-Type,
+// JSON is used when Content-Type is empty. See WithCodecs to use other than DefaultCodecs.
+func (h *HttpResponse) Decode(ctx context.Context, out interface{}) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "HttpResponse.Decode")
+	defer func() {
+		ctx.Done()
+		span.Finish()
+	}()
+
+	if h == nil {
+		return fmt.Errorf("h is nil")
+	}
+
+	codecs := h.codecs
+	if codecs == nil {
+		codecs = DefaultCodecs
+	}
+
+	contentType := h.Raw.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = MediaTypeJSON
+	}
+
+	codec, err := codecs.Lookup(contentType)
+	if err != nil {
+		return err
+	}
+
+	return h.To(ctx, codec.Unmarshal, out)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"testing"
 
 	"github.com/smartystreets/goconvey/convey"
@@ -69,3 +71,20 @@ func TestHttpResponseToJson(t *testing.T) {
 
 	})
 }
+
+func TestNewResponse(t *testing.T) {
+	convey.Convey("NewResponse", t, func() {
+		request, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+
+		resp := NewResponse(request, http.StatusNotFound, nil, []byte(`{}`))
+		convey.So(resp.Status, convey.ShouldEqual, "404 Not Found")
+		convey.So(resp.StatusCode, convey.ShouldEqual, http.StatusNotFound)
+		convey.So(resp.Proto, convey.ShouldEqual, "HTTP/1.1")
+		convey.So(resp.Header, convey.ShouldNotBeNil)
+		convey.So(resp.ContentLength, convey.ShouldEqual, 2)
+		convey.So(resp.Request, convey.ShouldEqual, request)
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		convey.So(string(body), convey.ShouldEqual, `{}`)
+	})
+}
@@ -0,0 +1,142 @@
+package rest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// IdempotencyKeyFunc generates a new idempotency key.
+type IdempotencyKeyFunc func() (string, error)
+
+// IdempotencyConfig configures WithIdempotency.
+type IdempotencyConfig struct {
+	// Header default "Idempotency-Key".
+	Header string
+	// Methods default POST and PATCH.
+	Methods []string
+	// Generator default NewUUID, see NewULID for time sortable key.
+	Generator IdempotencyKeyFunc
+}
+
+// Validate returns error when config is invalid.
+func (c IdempotencyConfig) Validate() error {
+	var errs []error
+	if strings.TrimSpace(c.Header) == "" {
+		errs = append(errs, errors.New("idempotency header is empty"))
+	}
+
+	if len(c.Methods) == 0 {
+		errs = append(errs, errors.New("idempotency methods is empty"))
+	}
+
+	if c.Generator == nil {
+		errs = append(errs, errors.New("idempotency key generator is nil"))
+	}
+
+	return errors.Join(errs...)
+}
+
+type idempotencyContextKey struct{}
+
+// ContextWithIdempotencyKey returns ctx carrying key, requests sent with ctx use key instead of a generated one.
+// Use the same ctx when retrying a call, so the server sees every attempt as the same operation.
+func ContextWithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyContextKey{}, key)
+}
+
+// IdempotencyKeyFromContext returns the key set by ContextWithIdempotencyKey.
+func IdempotencyKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idempotencyContextKey{}).(string)
+	return key, ok && key != ""
+}
+
+// apply sets idempotency header of request when its method requires one and returns the key.
+// Key already in the header is kept, then key in ctx is used, otherwise a new key is generated.
+func (c *IdempotencyConfig) apply(ctx context.Context, request *http.Request) (string, error) {
+	if c == nil || !c.requires(request.Method) {
+		return "", nil
+	}
+
+	if key := request.Header.Get(c.Header); key != "" {
+		return key, nil
+	}
+
+	key, ok := IdempotencyKeyFromContext(ctx)
+	if !ok {
+		var err error
+		if key, err = c.Generator(); err != nil {
+			return "", fmt.Errorf("fail generate idempotency key: %s", err.Error())
+		}
+	}
+
+	request.Header.Set(c.Header, key)
+	return key, nil
+}
+
+func (c *IdempotencyConfig) requires(method string) bool {
+	for _, m := range c.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewUUID returns random RFC 9562 UUID version 4, e.g. "0b8a4b5e-3f4c-4e2a-9b1d-2f6c8e0a7d31".
+func NewUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // variant 10
+
+	s := hex.EncodeToString(b[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:], nil
+}
+
+// crockford is Crockford's base32 alphabet used by ULID.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns ULID, 48 bits millisecond time followed by 80 random bits in Crockford's base32,
+// so keys sort by creation time, e.g. "01ARZ3NDEKTSV4RRFFQ69G5FAV".
+func NewULID() (string, error) {
+	return newULID(time.Now())
+}
+
+func newULID(now time.Time) (string, error) {
+	var b [16]byte
+	ms := uint64(now.UnixMilli())
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+
+	// 128 bits are encoded as 26 characters of 5 bits, the first character has only 3 bits
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[b[15]&0x1f]
+		shiftRight5(&b)
+	}
+
+	return string(out), nil
+}
+
+// shiftRight5 shifts 128 bits big endian number right by 5 bits.
+func shiftRight5(b *[16]byte) {
+	for i := 15; i > 0; i-- {
+		b[i] = b[i]>>5 | b[i-1]<<3
+	}
+	b[0] >>= 5
+}
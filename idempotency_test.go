@@ -0,0 +1,144 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// expiringTokens returns token "1", then "2" after the first token is invalidated.
+type expiringTokens struct {
+	invalidated bool
+}
+
+func (e *expiringTokens) Token(_ context.Context) (Token, error) {
+	if e.invalidated {
+		return Token{AccessToken: "2", TokenType: "Bearer"}, nil
+	}
+
+	return Token{AccessToken: "1", TokenType: "Bearer"}, nil
+}
+
+func (e *expiringTokens) Invalidate(_ Token) {
+	e.invalidated = true
+}
+
+func TestIdempotencyKeyGenerator(t *testing.T) {
+	convey.Convey("Generate idempotency key", t, func() {
+		convey.Convey("Should generate UUID version 4", func() {
+			key, err := NewUUID()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(key), convey.ShouldBeTrue)
+
+			other, _ := NewUUID()
+			convey.So(other, convey.ShouldNotEqual, key)
+		})
+
+		convey.Convey("Should generate ULID sorted by time", func() {
+			key, err := newULID(time.UnixMilli(1469918176385))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(key), convey.ShouldEqual, 26)
+			convey.So(key[:10], convey.ShouldEqual, "01ARYZ6S41")
+			convey.So(regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`).MatchString(key), convey.ShouldBeTrue)
+
+			later, _ := newULID(time.UnixMilli(1469918176386))
+			convey.So(later, convey.ShouldBeGreaterThan, key)
+		})
+	})
+}
+
+func TestWithIdempotency(t *testing.T) {
+	convey.Convey("Test WithIdempotency", t, func() {
+		ctx := context.Background()
+		var keys []string
+		upstream := &mockClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+			keys = append(keys, req.Header.Get("Idempotency-Key"))
+			return doFuncMock([]byte(`{}`), nil)(req)
+		}}
+
+		hook := new(lastHook)
+		client, err := DefaultClient(upstream, WithIdempotency(IdempotencyConfig{}), AddHook(hook))
+		convey.So(err, convey.ShouldBeNil)
+
+		convey.Convey("Should send new key with POST and PATCH only", func() {
+			_, _ = client.Post(ctx, "", "http://api.example.com/payments", http.Header{}, []byte(`{}`))
+			convey.So(keys[0], convey.ShouldNotBeEmpty)
+			convey.So(hook.data.IdempotencyKey, convey.ShouldEqual, keys[0])
+			convey.So(hook.data.CURL, convey.ShouldContainSubstring, keys[0])
+
+			_, _ = client.Patch(ctx, "", "http://api.example.com/payments/1", http.Header{}, []byte(`{}`))
+			convey.So(keys[1], convey.ShouldNotBeEmpty)
+			convey.So(keys[1], convey.ShouldNotEqual, keys[0])
+
+			_, _ = client.Get(ctx, "", "http://api.example.com/payments/1", http.Header{})
+			_, _ = client.Put(ctx, "", "http://api.example.com/payments/1", http.Header{}, nil)
+			convey.So(keys[2:], convey.ShouldResemble, []string{"", ""})
+			convey.So(hook.data.IdempotencyKey, convey.ShouldBeEmpty)
+		})
+
+		convey.Convey("Should send new key with each request sharing one header", func() {
+			header := http.Header{}
+			_, _ = client.Post(ctx, "", "http://api.example.com/payments", header, []byte(`{"amount":1}`))
+			_, _ = client.Post(ctx, "", "http://api.example.com/payments", header, []byte(`{"amount":2}`))
+
+			convey.So(keys[0], convey.ShouldNotBeEmpty)
+			convey.So(keys[1], convey.ShouldNotBeEmpty)
+			convey.So(keys[1], convey.ShouldNotEqual, keys[0])
+			convey.So(header.Get("Idempotency-Key"), convey.ShouldBeEmpty)
+		})
+
+		convey.Convey("Should keep key from header or context across retries", func() {
+			_, _ = client.Post(ctx, "", "http://api.example.com/payments", http.Header{"Idempotency-Key": {"from-header"}}, nil)
+
+			retryCtx := ContextWithIdempotencyKey(ctx, "order-1")
+			for i := 0; i < 2; i++ {
+				_, _ = client.Post(retryCtx, "", "http://api.example.com/payments", http.Header{}, nil)
+			}
+
+			convey.So(keys, convey.ShouldResemble, []string{"from-header", "order-1", "order-1"})
+		})
+
+		convey.Convey("Should keep key when request is sent again after 401", func() {
+			unauthorized := true
+			upstream.DoFunc = func(req *http.Request) (*http.Response, error) {
+				keys = append(keys, req.Header.Get("X-Request-Key"))
+				if unauthorized {
+					unauthorized = false
+					return &http.Response{StatusCode: http.StatusUnauthorized, Body: noopCloser(strings.NewReader(""), nil)}, nil
+				}
+				return doFuncMock([]byte(`{}`), nil)(req)
+			}
+
+			client, err := DefaultClient(upstream,
+				WithIdempotency(IdempotencyConfig{Header: "X-Request-Key", Generator: NewULID}),
+				WithTokenSource(&expiringTokens{}),
+			)
+			convey.So(err, convey.ShouldBeNil)
+
+			resp, _ := client.Post(ctx, "", "http://api.example.com/payments", http.Header{}, nil)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusOK)
+			convey.So(len(keys), convey.ShouldEqual, 2)
+			convey.So(len(keys[0]), convey.ShouldEqual, 26)
+			convey.So(keys[1], convey.ShouldEqual, keys[0])
+		})
+
+		convey.Convey("Should return error from generator and invalid config", func() {
+			client, _ := DefaultClient(upstream, WithIdempotency(IdempotencyConfig{Generator: func() (string, error) {
+				return "", errors.New("no entropy")
+			}}))
+
+			_, err := client.Post(ctx, "", "http://api.example.com/payments", http.Header{}, nil)
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(keys, convey.ShouldBeEmpty)
+
+			_, err = DefaultClient(upstream, WithIdempotency(IdempotencyConfig{Methods: []string{}}))
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,70 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// JSONNumberMode defines how JSON numbers in HttpRequest.Body and ResponseRaw.Body are decoded.
+type JSONNumberMode int
+
+const (
+	// JSONNumberFloat64 decodes numbers into float64, large integers and long decimals may lose precision.
+	JSONNumberFloat64 JSONNumberMode = iota
+	// JSONNumberUseNumber decodes numbers into json.Number, keeping the exact digits.
+	JSONNumberUseNumber
+	// JSONNumberRaw keeps the whole body as json.RawMessage without decoding it.
+	JSONNumberRaw
+)
+
+// String returns the name of mode.
+func (m JSONNumberMode) String() string {
+	switch m {
+	case JSONNumberFloat64:
+		return "float64"
+	case JSONNumberUseNumber:
+		return "number"
+	case JSONNumberRaw:
+		return "raw"
+	default:
+		return fmt.Sprintf("unknown json number mode: %d", int(m))
+	}
+}
+
+// decodeJSONBody decodes data as one JSON value using mode.
+func decodeJSONBody(mode JSONNumberMode, data []byte) (interface{}, error) {
+	switch mode {
+	case JSONNumberRaw:
+		if !json.Valid(data) {
+			return nil, fmt.Errorf("invalid json")
+		}
+
+		raw := make(json.RawMessage, len(data))
+		copy(raw, data)
+		return raw, nil
+	case JSONNumberUseNumber:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+
+		// json.Unmarshal rejects trailing data, so does this
+		if _, err := decoder.Token(); err != io.EOF {
+			return nil, fmt.Errorf("invalid character after top-level value")
+		}
+
+		return value, nil
+	default:
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+
+		return value, nil
+	}
+}
@@ -0,0 +1,93 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestDecodeJSONBody(t *testing.T) {
+	convey.Convey("Decode JSON body", t, func() {
+		data := []byte(`{"id": 1234567890123456789, "amount": 0.1000000000000000055511}`)
+
+		convey.Convey("Float64 should lose precision of large integer", func() {
+			value, err := decodeJSONBody(JSONNumberFloat64, data)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(value.(map[string]interface{})["id"], convey.ShouldEqual, float64(1234567890123456789))
+		})
+
+		convey.Convey("UseNumber should keep exact digits", func() {
+			value, err := decodeJSONBody(JSONNumberUseNumber, data)
+			convey.So(err, convey.ShouldBeNil)
+
+			body := value.(map[string]interface{})
+			convey.So(body["id"], convey.ShouldEqual, json.Number("1234567890123456789"))
+			convey.So(body["amount"], convey.ShouldEqual, json.Number("0.1000000000000000055511"))
+
+			encoded, err := json.Marshal(value)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(string(encoded), convey.ShouldEqual, `{"amount":0.1000000000000000055511,"id":1234567890123456789}`)
+		})
+
+		convey.Convey("Raw should keep body as is", func() {
+			value, err := decodeJSONBody(JSONNumberRaw, data)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(value, convey.ShouldResemble, json.RawMessage(data))
+		})
+
+		convey.Convey("Invalid or trailing data should return error", func() {
+			for _, mode := range []JSONNumberMode{JSONNumberFloat64, JSONNumberUseNumber, JSONNumberRaw} {
+				_, err := decodeJSONBody(mode, []byte(`{"id": 1} {"id": 2}`))
+				convey.So(err, convey.ShouldNotBeNil)
+
+				_, err = decodeJSONBody(mode, []byte(`OK`))
+				convey.So(err, convey.ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestWithJSONNumber(t *testing.T) {
+	convey.Convey("Test WithJSONNumber", t, func() {
+		ctx := context.Background()
+		payload := []byte(`{"transaction_id": 9007199254740993, "rate": 1.23456789012345678901}`)
+		testClient := &mockClient{
+			DoFunc: doFuncMock(payload, nil),
+		}
+
+		convey.Convey("Should keep precision of request and response body in hook", func() {
+			hook := new(lastHook)
+			client, err := DefaultClient(testClient, WithJSONNumber(JSONNumberUseNumber), AddHook(hook))
+			convey.So(err, convey.ShouldBeNil)
+
+			_, err = client.Post(ctx, "", "http://example.com/", http.Header{}, payload)
+			convey.So(err, convey.ShouldBeNil)
+
+			requestBody := hook.data.Request.Body.(map[string]interface{})
+			convey.So(requestBody["transaction_id"], convey.ShouldEqual, json.Number("9007199254740993"))
+
+			responseBody := hook.data.Response.Body.(map[string]interface{})
+			convey.So(responseBody["transaction_id"], convey.ShouldEqual, json.Number("9007199254740993"))
+			convey.So(responseBody["rate"], convey.ShouldEqual, json.Number("1.23456789012345678901"))
+		})
+
+		convey.Convey("Should keep raw response body", func() {
+			hook := new(lastHook)
+			client, err := DefaultClient(testClient, WithJSONNumber(JSONNumberRaw), AddHook(hook))
+			convey.So(err, convey.ShouldBeNil)
+
+			_, err = client.Get(ctx, "", "http://example.com/", http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(hook.data.Response.Body, convey.ShouldResemble, json.RawMessage(payload))
+		})
+
+		convey.Convey("Should return error on unknown mode", func() {
+			client, err := DefaultClient(testClient, WithJSONNumber(JSONNumberMode(10)))
+			convey.So(client, convey.ShouldBeNil)
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
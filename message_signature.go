@@ -0,0 +1,335 @@
+package rest
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureAlgorithm is HTTP Message Signature algorithm registered in RFC 9421 section 6.2.
+type SignatureAlgorithm string
+
+const (
+	SignatureHMACSHA256      SignatureAlgorithm = "hmac-sha256"
+	SignatureEd25519         SignatureAlgorithm = "ed25519"
+	SignatureECDSAP256SHA256 SignatureAlgorithm = "ecdsa-p256-sha256"
+	SignatureRSAPSSSHA512    SignatureAlgorithm = "rsa-pss-sha512"
+	SignatureRSAV15SHA256    SignatureAlgorithm = "rsa-v1_5-sha256"
+)
+
+// rsa512PSSOptions is RSASSA-PSS using SHA-512 with 64 bytes salt, as RFC 9421 section 3.3.1 requires.
+var rsa512PSSOptions = rsa.PSSOptions{SaltLength: 64, Hash: crypto.SHA512}
+
+// DigestAlgorithm is Content-Digest algorithm registered in RFC 9530.
+type DigestAlgorithm string
+
+const (
+	DigestSHA256 DigestAlgorithm = "sha-256"
+	DigestSHA512 DigestAlgorithm = "sha-512"
+)
+
+// MessageSignatureConfig configures HTTP Message Signatures (RFC 9421).
+type MessageSignatureConfig struct {
+	Label     string // signature label, default "sig1"
+	KeyID     string
+	Algorithm SignatureAlgorithm
+	// Secret is the shared key for hmac-sha256.
+	Secret []byte
+	// PrivateKey signs for other algorithms, e.g. ed25519.PrivateKey, *ecdsa.PrivateKey or *rsa.PrivateKey.
+	PrivateKey crypto.Signer
+	// Components are covered component identifiers, e.g. "@method", "@authority", "content-type".
+	// Default "@method", "@authority", "@path", "@query", and "content-digest" when ContentDigest is set.
+	Components []string
+	// ContentDigest adds Content-Digest header (RFC 9530) of the body using this algorithm.
+	ContentDigest DigestAlgorithm
+	// Expires adds expires parameter this long after created.
+	Expires time.Duration
+	// Nonce adds nonce parameter generated for each request.
+	Nonce func() string
+	// Tag adds tag parameter, identifying the application profile of the signature.
+	Tag string
+	// OmitAlg doesn't add alg parameter, for verifier that knows the algorithm from keyid.
+	OmitAlg bool
+}
+
+// Validate returns error when key doesn't match the algorithm or component is unknown.
+func (c MessageSignatureConfig) Validate() error {
+	var errs []error
+	switch c.Algorithm {
+	case SignatureHMACSHA256:
+		if len(c.Secret) == 0 {
+			errs = append(errs, errors.New("message signature secret is empty"))
+		}
+	case SignatureEd25519, SignatureECDSAP256SHA256, SignatureRSAPSSSHA512, SignatureRSAV15SHA256:
+		if c.PrivateKey == nil {
+			errs = append(errs, errors.New("message signature private key is nil"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unsupported message signature algorithm %q", c.Algorithm))
+	}
+
+	switch c.ContentDigest {
+	case "", DigestSHA256, DigestSHA512:
+	default:
+		errs = append(errs, fmt.Errorf("unsupported content digest algorithm %q", c.ContentDigest))
+	}
+
+	for _, component := range c.Components {
+		if strings.HasPrefix(component, "@") && !derivedComponents[component] {
+			errs = append(errs, fmt.Errorf("unsupported derived component %q", component))
+		}
+
+		if component != strings.ToLower(component) {
+			errs = append(errs, fmt.Errorf("component %q must be lowercase", component))
+		}
+	}
+
+	if c.Expires < 0 {
+		errs = append(errs, errors.New("message signature expires must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// derivedComponents are supported derived components (RFC 9421 section 2.2).
+var derivedComponents = map[string]bool{
+	"@method":         true,
+	"@target-uri":     true,
+	"@authority":      true,
+	"@scheme":         true,
+	"@request-target": true,
+	"@path":           true,
+	"@query":          true,
+}
+
+// MessageSigner adds Signature-Input and Signature headers (RFC 9421), see WithMessageSignature.
+type MessageSigner struct {
+	conf MessageSignatureConfig
+	now  func() time.Time
+}
+
+var _ RequestSigner = &MessageSigner{}
+
+// NewMessageSigner returns MessageSigner for conf.
+func NewMessageSigner(conf MessageSignatureConfig) (*MessageSigner, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	if conf.Label == "" {
+		conf.Label = "sig1"
+	}
+
+	if conf.Components == nil {
+		conf.Components = []string{"@method", "@authority", "@path", "@query"}
+		if conf.ContentDigest != "" {
+			conf.Components = append(conf.Components, "content-digest")
+		}
+	}
+
+	return &MessageSigner{conf: conf, now: time.Now}, nil
+}
+
+// Sign sets Content-Digest when configured, then signs the covered components of request.
+func (s *MessageSigner) Sign(_ context.Context, request *http.Request) error {
+	if s.conf.ContentDigest != "" {
+		body, known, err := readBody(request)
+		if err != nil {
+			return fmt.Errorf("fail read body for content digest: %s", err.Error())
+		}
+
+		if !known {
+			return errors.New("content digest can't be computed for streamed body")
+		}
+
+		request.Header.Set("Content-Digest", contentDigest(s.conf.ContentDigest, body))
+	}
+
+	params := s.params(s.now())
+	base, err := signatureBase(request, s.conf.Components, params)
+	if err != nil {
+		return err
+	}
+
+	signature, err := s.sign([]byte(base))
+	if err != nil {
+		return fmt.Errorf("fail sign message: %s", err.Error())
+	}
+
+	request.Header.Set("Signature-Input", s.conf.Label+"="+params)
+	request.Header.Set("Signature", s.conf.Label+"=:"+base64.StdEncoding.EncodeToString(signature)+":")
+	return nil
+}
+
+// params returns the serialized signature parameters, the value of "@signature-params".
+func (s *MessageSigner) params(now time.Time) string {
+	var params strings.Builder
+	params.WriteString("(")
+	for i, component := range s.conf.Components {
+		if i > 0 {
+			params.WriteString(" ")
+		}
+		params.WriteString(quoteString(component))
+	}
+	params.WriteString(")")
+
+	params.WriteString(";created=" + strconv.FormatInt(now.Unix(), 10))
+	if s.conf.Expires > 0 {
+		params.WriteString(";expires=" + strconv.FormatInt(now.Add(s.conf.Expires).Unix(), 10))
+	}
+
+	if s.conf.Nonce != nil {
+		params.WriteString(";nonce=" + quoteString(s.conf.Nonce()))
+	}
+
+	if !s.conf.OmitAlg {
+		params.WriteString(";alg=" + quoteString(string(s.conf.Algorithm)))
+	}
+
+	if s.conf.KeyID != "" {
+		params.WriteString(";keyid=" + quoteString(s.conf.KeyID))
+	}
+
+	if s.conf.Tag != "" {
+		params.WriteString(";tag=" + quoteString(s.conf.Tag))
+	}
+
+	return params.String()
+}
+
+func (s *MessageSigner) sign(base []byte) ([]byte, error) {
+	switch s.conf.Algorithm {
+	case SignatureHMACSHA256:
+		mac := hmac.New(sha256.New, s.conf.Secret)
+		mac.Write(base)
+		return mac.Sum(nil), nil
+	case SignatureEd25519:
+		return s.conf.PrivateKey.Sign(rand.Reader, base, crypto.Hash(0))
+	case SignatureRSAPSSSHA512:
+		digest := sha512.Sum512(base)
+		return s.conf.PrivateKey.Sign(rand.Reader, digest[:], &rsa512PSSOptions)
+	case SignatureRSAV15SHA256:
+		digest := sha256.Sum256(base)
+		return s.conf.PrivateKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	case SignatureECDSAP256SHA256:
+		digest := sha256.Sum256(base)
+		der, err := s.conf.PrivateKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			return nil, err
+		}
+
+		// RFC 9421 uses r and s concatenated, crypto.Signer returns ASN.1 DER
+		var sig struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(der, &sig); err != nil {
+			return nil, err
+		}
+
+		signature := make([]byte, 64)
+		sig.R.FillBytes(signature[:32])
+		sig.S.FillBytes(signature[32:])
+		return signature, nil
+	default:
+		return nil, fmt.Errorf("unsupported message signature algorithm %q", s.conf.Algorithm)
+	}
+}
+
+// signatureBase creates signature base (RFC 9421 section 2.5).
+func signatureBase(request *http.Request, components []string, params string) (string, error) {
+	var base strings.Builder
+	for _, component := range components {
+		value, err := componentValue(request, component)
+		if err != nil {
+			return "", err
+		}
+
+		base.WriteString(quoteString(component))
+		base.WriteString(": ")
+		base.WriteString(value)
+		base.WriteString("\n")
+	}
+
+	base.WriteString(`"@signature-params": `)
+	base.WriteString(params)
+	return base.String(), nil
+}
+
+func componentValue(request *http.Request, component string) (string, error) {
+	switch component {
+	case "@method":
+		return request.Method, nil
+	case "@target-uri":
+		return request.URL.String(), nil
+	case "@authority":
+		return strings.ToLower(requestHost(request)), nil
+	case "@scheme":
+		return strings.ToLower(request.URL.Scheme), nil
+	case "@request-target":
+		return request.URL.RequestURI(), nil
+	case "@path":
+		if path := request.URL.EscapedPath(); path != "" {
+			return path, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + request.URL.RawQuery, nil
+	}
+
+	if component == "host" {
+		return requestHost(request), nil
+	}
+
+	values := request.Header.Values(component)
+	if len(values) == 0 {
+		return "", fmt.Errorf("covered component %q is not in request", component)
+	}
+
+	trimmed := make([]string, 0, len(values))
+	for _, v := range values {
+		trimmed = append(trimmed, strings.TrimSpace(v))
+	}
+
+	return strings.Join(trimmed, ", "), nil
+}
+
+func requestHost(request *http.Request) string {
+	if request.Host != "" {
+		return request.Host
+	}
+
+	return request.URL.Host
+}
+
+// contentDigest returns Content-Digest value of body (RFC 9530).
+func contentDigest(algorithm DigestAlgorithm, body []byte) string {
+	var sum []byte
+	switch algorithm {
+	case DigestSHA512:
+		digest := sha512.Sum512(body)
+		sum = digest[:]
+	default:
+		digest := sha256.Sum256(body)
+		sum = digest[:]
+	}
+
+	return string(algorithm) + "=:" + base64.StdEncoding.EncodeToString(sum) + ":"
+}
+
+// quoteString serializes structured field string (RFC 8941 section 3.3.3).
+func quoteString(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
@@ -0,0 +1,314 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token is OAuth2 access token.
+type Token struct {
+	AccessToken string
+	TokenType   string    // "Bearer" when token endpoint doesn't return it
+	Expiry      time.Time // zero when token endpoint doesn't return expires_in
+}
+
+// authorization returns the Authorization header value.
+func (t Token) authorization() string {
+	tokenType := t.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+
+	return tokenType + " " + t.AccessToken
+}
+
+// TokenSource returns access token used to authorize request, see WithTokenSource.
+type TokenSource interface {
+	// Token returns cached token, or fetches a new one when there is none or it is about to expire.
+	Token(ctx context.Context) (Token, error)
+	// Invalidate drops token from cache when it's rejected by server, so next Token fetches a new one.
+	Invalidate(token Token)
+}
+
+// ClientCredentialsConfig configures OAuth2 client credentials grant (RFC 6749 section 4.4).
+type ClientCredentialsConfig struct {
+	TokenURL     string   `json:"token_url" yaml:"token_url"`
+	ClientID     string   `json:"client_id" yaml:"client_id"`
+	ClientSecret string   `json:"client_secret" yaml:"client_secret"`
+	Scopes       []string `json:"scopes" yaml:"scopes"`
+	// EndpointParams are additional form values sent to token endpoint, e.g. "audience".
+	EndpointParams url.Values `json:"endpoint_params" yaml:"endpoint_params"`
+	// AuthInBody sends client id and secret in form body instead of HTTP Basic authentication.
+	AuthInBody bool `json:"auth_in_body" yaml:"auth_in_body"`
+	// ExpiryDelta refreshes token this long before it expires, default 10 seconds.
+	ExpiryDelta Duration `json:"expiry_delta" yaml:"expiry_delta"`
+	// Timeout of token request, default 30 seconds. The request doesn't use the caller context,
+	// since other callers wait for the same token, and the caller's trace and limits belong to its own request.
+	Timeout Duration `json:"timeout" yaml:"timeout"`
+	// Client calls token endpoint, WithClientCredentials uses the requester client when it's nil.
+	Client HttpClient `json:"-" yaml:"-"`
+}
+
+// Validate returns error when required field is missing.
+func (c ClientCredentialsConfig) Validate() error {
+	var errs []error
+	if _, err := url.ParseRequestURI(c.TokenURL); err != nil {
+		errs = append(errs, fmt.Errorf("oauth2 token url is invalid: %s", err.Error()))
+	}
+
+	if c.ClientID == "" {
+		errs = append(errs, errors.New("oauth2 client id is empty"))
+	}
+
+	if c.ExpiryDelta < 0 {
+		errs = append(errs, errors.New("oauth2 expiry delta must not be negative"))
+	}
+
+	return errors.Join(append(errs, validateTimeout("oauth2 timeout", c.Timeout))...)
+}
+
+// ClientCredentials is TokenSource using OAuth2 client credentials grant.
+// Token is cached until shortly before it expires, concurrent callers share one token request.
+type ClientCredentials struct {
+	conf ClientCredentialsConfig
+
+	mu      sync.Mutex
+	token   *Token
+	pending *tokenCall
+}
+
+// tokenCall is token request in flight.
+type tokenCall struct {
+	done  chan struct{}
+	token Token
+	err   error
+}
+
+var _ TokenSource = &ClientCredentials{}
+
+// NewClientCredentials returns TokenSource for conf, http.DefaultClient is used when conf.Client is nil.
+func NewClientCredentials(conf ClientCredentialsConfig) (*ClientCredentials, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	if conf.Client == nil {
+		conf.Client = http.DefaultClient
+	}
+
+	if conf.ExpiryDelta == 0 {
+		conf.ExpiryDelta = Duration(10 * time.Second)
+	}
+
+	if conf.Timeout == 0 {
+		conf.Timeout = Duration(30 * time.Second)
+	}
+
+	return &ClientCredentials{conf: conf}, nil
+}
+
+// Token returns cached token or fetches a new one.
+// Every caller, including the one starting the fetch, stops waiting when its own context is done.
+func (c *ClientCredentials) Token(ctx context.Context) (Token, error) {
+	c.mu.Lock()
+	if c.token != nil && c.valid(*c.token) {
+		token := *c.token
+		c.mu.Unlock()
+		return token, nil
+	}
+
+	call := c.pending
+	if call == nil {
+		call = &tokenCall{done: make(chan struct{})}
+		c.pending = call
+		go c.refresh(call)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.token, call.err
+	case <-ctx.Done():
+		return Token{}, ctx.Err()
+	}
+}
+
+// refresh fetches token for call on its own context.
+func (c *ClientCredentials) refresh(call *tokenCall) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.conf.Timeout.Std())
+	defer cancel()
+
+	call.token, call.err = c.fetch(ctx)
+
+	c.mu.Lock()
+	c.pending = nil
+	if call.err == nil {
+		token := call.token
+		c.token = &token
+	}
+	c.mu.Unlock()
+	close(call.done)
+}
+
+// Invalidate drops token from cache, unless it has been replaced by newer token.
+func (c *ClientCredentials) Invalidate(token Token) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != nil && c.token.AccessToken == token.AccessToken {
+		c.token = nil
+	}
+}
+
+func (c *ClientCredentials) valid(token Token) bool {
+	return token.Expiry.IsZero() || time.Now().Add(c.conf.ExpiryDelta.Std()).Before(token.Expiry)
+}
+
+// tokenResponse is successful and error response of token endpoint (RFC 6749 section 5).
+type tokenResponse struct {
+	AccessToken      string      `json:"access_token"`
+	TokenType        string      `json:"token_type"`
+	ExpiresIn        json.Number `json:"expires_in"`
+	Error            string      `json:"error"`
+	ErrorDescription string      `json:"error_description"`
+}
+
+func (c *ClientCredentials) fetch(ctx context.Context) (Token, error) {
+	form := url.Values{}
+	for key, values := range c.conf.EndpointParams {
+		form[key] = append([]string(nil), values...)
+	}
+
+	form.Set("grant_type", "client_credentials")
+	if len(c.conf.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.conf.Scopes, " "))
+	}
+
+	if c.conf.AuthInBody {
+		form.Set("client_id", c.conf.ClientID)
+		form.Set("client_secret", c.conf.ClientSecret)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.conf.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, fmt.Errorf("fail create oauth2 token request: %s", err.Error())
+	}
+
+	request.Header.Set("Content-Type", MediaTypeForm)
+	request.Header.Set("Accept", MediaTypeJSON)
+	if !c.conf.AuthInBody {
+		request.SetBasicAuth(url.QueryEscape(c.conf.ClientID), url.QueryEscape(c.conf.ClientSecret))
+	}
+
+	now := time.Now()
+	resp, err := c.conf.Client.Do(request)
+	if err != nil {
+		return Token{}, fmt.Errorf("fail request oauth2 token: %s", err.Error())
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Token{}, fmt.Errorf("fail read oauth2 token response: %s", err.Error())
+	}
+
+	var tokenResp tokenResponse
+	errJSON := json.Unmarshal(body, &tokenResp)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || tokenResp.Error != "" {
+		if tokenResp.Error != "" {
+			return Token{}, fmt.Errorf("oauth2 token endpoint returned %d: %s %s", resp.StatusCode, tokenResp.Error, tokenResp.ErrorDescription)
+		}
+
+		return Token{}, fmt.Errorf("oauth2 token endpoint returned %d", resp.StatusCode)
+	}
+
+	if errJSON != nil {
+		return Token{}, fmt.Errorf("fail parse oauth2 token response: %s", errJSON.Error())
+	}
+
+	if tokenResp.AccessToken == "" {
+		return Token{}, errors.New("oauth2 token response has no access_token")
+	}
+
+	token := Token{
+		AccessToken: tokenResp.AccessToken,
+		TokenType:   tokenResp.TokenType,
+	}
+
+	if tokenResp.ExpiresIn != "" {
+		seconds, err := strconv.ParseInt(tokenResp.ExpiresIn.String(), 10, 64)
+		if err != nil {
+			return Token{}, fmt.Errorf("fail parse oauth2 expires_in: %s", err.Error())
+		}
+
+		if seconds > 0 {
+			token.Expiry = now.Add(time.Duration(seconds) * time.Second)
+		}
+	}
+
+	return token, nil
+}
+
+// authorize sends request with token from source, and sends it once more with a new token when server returns 401.
+// Digest authentication is used instead when it's configured.
+// Authorization is set on a copy of request header, so it's not shown in curl command and hook.
+func (r DefaultHttpRequester) authorize(ctx context.Context, request *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	if r.digest != nil {
+		return r.digest.do(request, send)
+	}
+
+	if r.tokens == nil {
+		return send(request)
+	}
+
+	token, err := r.tokens.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fail get oauth2 token: %s", err.Error())
+	}
+
+	resp, err := send(withAuthorization(request, token))
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// the body can't be sent again
+	if request.GetBody == nil {
+		return resp, err
+	}
+
+	body, errBody := request.GetBody()
+	if errBody != nil {
+		return resp, err
+	}
+
+	r.tokens.Invalidate(token)
+	fresh, errToken := r.tokens.Token(ctx)
+	if errToken != nil || fresh.AccessToken == token.AccessToken {
+		_ = body.Close()
+		return resp, err
+	}
+
+	_, _ = ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	retry := withAuthorization(request, fresh)
+	retry.Body = body
+	return send(retry)
+}
+
+func withAuthorization(request *http.Request, token Token) *http.Request {
+	authorized := request.Clone(request.Context())
+	authorized.Header.Set("Authorization", token.authorization())
+	return authorized
+}
@@ -0,0 +1,294 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// newTokenServer returns token endpoint issuing "token-1", "token-2", ... that expire in expiresIn.
+func newTokenServer(expiresIn string, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(calls, 1)
+		_ = r.ParseForm()
+
+		id, secret, ok := r.BasicAuth()
+		if !ok {
+			id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		}
+
+		if id != "client" || secret != "s3cret" || r.PostForm.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error": "invalid_client", "error_description": "bad credentials"}`))
+			return
+		}
+
+		// give concurrent callers time to pile up
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "bearer", "expires_in": %s, "scope": %q}`, n, expiresIn, r.PostForm.Get("scope"))
+	}))
+}
+
+func TestClientCredentials(t *testing.T) {
+	convey.Convey("OAuth2 client credentials", t, func() {
+		ctx := context.Background()
+		var calls int32
+		server := newTokenServer("3600", &calls)
+		defer server.Close()
+
+		conf := ClientCredentialsConfig{
+			TokenURL:     server.URL,
+			ClientID:     "client",
+			ClientSecret: "s3cret",
+			Scopes:       []string{"read", "write"},
+		}
+
+		convey.Convey("Should validate config", func() {
+			_, err := NewClientCredentials(ClientCredentialsConfig{ExpiryDelta: -1, Timeout: 30})
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(err.Error(), convey.ShouldContainSubstring, "token url")
+			convey.So(err.Error(), convey.ShouldContainSubstring, "client id")
+			convey.So(err.Error(), convey.ShouldContainSubstring, "expiry delta")
+			convey.So(err.Error(), convey.ShouldContainSubstring, "oauth2 timeout")
+		})
+
+		convey.Convey("Should decode config with durations", func() {
+			var decoded ClientCredentialsConfig
+			err := json.Unmarshal([]byte(`{"token_url": "http://auth/token", "client_id": "client", "expiry_delta": "1m", "timeout": "5s"}`), &decoded)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(decoded.ClientID, convey.ShouldEqual, "client")
+			convey.So(decoded.ExpiryDelta.Std(), convey.ShouldEqual, time.Minute)
+			convey.So(decoded.Timeout.Std(), convey.ShouldEqual, 5*time.Second)
+		})
+
+		convey.Convey("Should keep fetching token for waiters when the first caller leaves", func() {
+			source, _ := NewClientCredentials(conf)
+
+			leaderCtx, cancel := context.WithCancel(ctx)
+			leaderErr := make(chan error, 1)
+			go func() {
+				_, err := source.Token(leaderCtx)
+				leaderErr <- err
+			}()
+
+			for {
+				source.mu.Lock()
+				pending := source.pending != nil
+				source.mu.Unlock()
+				if pending {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			waiter := make(chan Token, 1)
+			go func() {
+				token, _ := source.Token(ctx)
+				waiter <- token
+			}()
+
+			cancel()
+			convey.So(<-leaderErr, convey.ShouldEqual, context.Canceled)
+			convey.So((<-waiter).AccessToken, convey.ShouldEqual, "token-1")
+			convey.So(atomic.LoadInt32(&calls), convey.ShouldEqual, 1)
+		})
+
+		convey.Convey("Should stop token request after timeout", func() {
+			conf.Timeout = Duration(5 * time.Millisecond)
+			source, _ := NewClientCredentials(conf)
+
+			_, err := source.Token(ctx)
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(err.Error(), convey.ShouldContainSubstring, "deadline exceeded")
+		})
+
+		convey.Convey("Should cache token and share concurrent fetch", func() {
+			source, err := NewClientCredentials(conf)
+			convey.So(err, convey.ShouldBeNil)
+
+			var wg sync.WaitGroup
+			tokens := make([]Token, 10)
+			for i := range tokens {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					tokens[i], _ = source.Token(ctx)
+				}(i)
+			}
+			wg.Wait()
+
+			for _, token := range tokens {
+				convey.So(token.AccessToken, convey.ShouldEqual, "token-1")
+				convey.So(token.authorization(), convey.ShouldEqual, "Bearer token-1")
+				convey.So(token.Expiry, convey.ShouldHappenAfter, time.Now().Add(time.Hour-time.Minute))
+			}
+			convey.So(atomic.LoadInt32(&calls), convey.ShouldEqual, 1)
+
+			source.Invalidate(Token{AccessToken: "other"})
+			token, _ := source.Token(ctx)
+			convey.So(token.AccessToken, convey.ShouldEqual, "token-1")
+
+			source.Invalidate(token)
+			token, _ = source.Token(ctx)
+			convey.So(token.AccessToken, convey.ShouldEqual, "token-2")
+		})
+
+		convey.Convey("Should send client credentials in body", func() {
+			conf.AuthInBody = true
+			source, _ := NewClientCredentials(conf)
+
+			token, err := source.Token(ctx)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(token.AccessToken, convey.ShouldEqual, "token-1")
+		})
+
+		convey.Convey("Should return token endpoint error", func() {
+			conf.ClientSecret = "wrong"
+			source, _ := NewClientCredentials(conf)
+
+			_, err := source.Token(ctx)
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(err.Error(), convey.ShouldContainSubstring, "invalid_client")
+		})
+
+		convey.Convey("Should refresh token before it expires", func() {
+			server := newTokenServer(`"5"`, &calls)
+			defer server.Close()
+
+			conf.TokenURL = server.URL
+			source, _ := NewClientCredentials(conf)
+
+			first, _ := source.Token(ctx)
+			second, _ := source.Token(ctx)
+			convey.So(first.AccessToken, convey.ShouldNotEqual, second.AccessToken)
+		})
+	})
+}
+
+func TestWithClientCredentials(t *testing.T) {
+	convey.Convey("Test WithClientCredentials", t, func() {
+		ctx := context.Background()
+		var calls int32
+		server := newTokenServer("3600", &calls)
+		defer server.Close()
+
+		conf := ClientCredentialsConfig{
+			TokenURL:     server.URL,
+			ClientID:     "client",
+			ClientSecret: "s3cret",
+			Client:       http.DefaultClient,
+		}
+
+		var authorizations []string
+		var bodies []string
+		testClient := &mockClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				body, _ := ioutil.ReadAll(req.Body)
+				authorizations = append(authorizations, req.Header.Get("Authorization"))
+				bodies = append(bodies, string(body))
+
+				status := http.StatusOK
+				if req.Header.Get("Authorization") == "Bearer token-1" && req.URL.Path == "/revoked" {
+					status = http.StatusUnauthorized
+				}
+
+				return &http.Response{
+					StatusCode: status,
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{}`))),
+				}, nil
+			},
+		}
+
+		hook := new(lastHook)
+		client, err := DefaultClient(testClient, WithClientCredentials(conf), AddHook(hook))
+		convey.So(err, convey.ShouldBeNil)
+
+		convey.Convey("Should send bearer token and keep it out of curl and hook", func() {
+			header := http.Header{}
+			resp, err := client.Post(ctx, "", "http://example.com/orders", header, []byte(`{"id": 1}`))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(authorizations, convey.ShouldResemble, []string{"Bearer token-1"})
+
+			convey.So(resp.CURL, convey.ShouldNotContainSubstring, "token-1")
+			convey.So(hook.data.CURL, convey.ShouldNotContainSubstring, "token-1")
+			convey.So(hook.data.Request.Header.Get("Authorization"), convey.ShouldBeEmpty)
+			convey.So(header.Get("Authorization"), convey.ShouldBeEmpty)
+		})
+
+		convey.Convey("Should retry once with a new token on 401", func() {
+			resp, err := client.Post(ctx, "", "http://example.com/revoked", http.Header{}, []byte(`{"id": 1}`))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusOK)
+			convey.So(authorizations, convey.ShouldResemble, []string{"Bearer token-1", "Bearer token-2"})
+			convey.So(bodies, convey.ShouldResemble, []string{`{"id": 1}`, `{"id": 1}`})
+		})
+
+		convey.Convey("Should not retry streamed body", func() {
+			body := NewMultipart().Field("a", "1")
+			resp, err := client.PostMultipart(ctx, "", "http://example.com/revoked", http.Header{}, body)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusUnauthorized)
+			convey.So(len(authorizations), convey.ShouldEqual, 1)
+		})
+
+		convey.Convey("Should return error when token can't be fetched", func() {
+			conf.ClientSecret = "wrong"
+			client, _ := DefaultClient(testClient, WithClientCredentials(conf))
+
+			_, err := client.Get(ctx, "", "http://example.com/", http.Header{})
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(strings.Contains(err.Error(), "invalid_client"), convey.ShouldBeTrue)
+			convey.So(authorizations, convey.ShouldBeEmpty)
+		})
+
+		convey.Convey("Should fetch token with the undecorated client on a fresh context", func() {
+			var tokenCtx context.Context
+			tokenClient := &mockClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+				tokenCtx = req.Context()
+				return http.DefaultClient.Do(req)
+			}}
+
+			conf.Client = nil
+			conf.TokenURL = server.URL
+			tokenServer := &mockClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+				if req.URL.String() == server.URL {
+					return tokenClient.Do(req)
+				}
+				return testClient.Do(req)
+			}}
+
+			injector, _ := NewFaultInjector(FaultRule{Fault: FaultStatus, StatusCode: http.StatusServiceUnavailable, Probability: 1, Method: http.MethodPost})
+			client, err := DefaultClient(tokenServer, WithFaultInjection(injector), WithClientCredentials(conf))
+			convey.So(err, convey.ShouldBeNil)
+
+			_, err = client.Get(ContextWithMaxResponseBytes(ctx, 10), "", "http://example.com/orders", http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(authorizations, convey.ShouldResemble, []string{"Bearer token-1"})
+
+			_, limited := maxResponseBytesFromContext(tokenCtx)
+			convey.So(limited, convey.ShouldBeFalse)
+			convey.So(httptrace.ContextClientTrace(tokenCtx), convey.ShouldBeNil)
+		})
+
+		convey.Convey("Should reject nil token source and invalid config", func() {
+			_, err := DefaultClient(testClient, WithTokenSource(nil))
+			convey.So(err, convey.ShouldNotBeNil)
+
+			_, err = DefaultClient(testClient, WithClientCredentials(ClientCredentialsConfig{}))
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
@@ -2,15 +2,337 @@ package rest
 
 import (
 	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
 )
 
 // Option configures Client with defined option.
 type Option func(*DefaultHttpRequester) error
 
-// WithCircuitBreaker returns Option to configure Circuit Breaker
+// WithCircuitBreaker returns Option to configure Circuit Breaker,
+// timeout below 1ms is rejected since it is most likely a number of seconds, see CBConfig.
+// Named circuit breaker is managed by BreakerHandler, the latest one wins when the name is reused.
 func WithCircuitBreaker(circuitConfig CBConfig) Option {
 	return func(c *DefaultHttpRequester) error {
-		c.client = newCircuitBreaker(circuitConfig, c.client)
+		if err := errors.Join(
+			validateTimeout("circuit_breaker.timeout", circuitConfig.Timeout),
+			validateTimeout("circuit_breaker.interval_timeout", circuitConfig.IntervalTimeout),
+		); err != nil {
+			return err
+		}
+
+		cb := newCircuitBreaker(circuitConfig, c.client)
+		registerBreaker(cb)
+
+		c.client = cb
+		c.closers = append(c.closers, cb)
+		return nil
+	}
+}
+
+// WithCache returns Option to cache GET and HEAD responses in store following RFC 9111,
+// see HttpResponse.CacheStatus to know whether the response is served from cache.
+// Responses are stored per Authorization, Proxy-Authorization and Cookie, so they are never shared across credentials.
+// Add it after WithCircuitBreaker, so that cached responses don't count in circuit breaker.
+func WithCache(store CacheStore) Option {
+	return func(c *DefaultHttpRequester) error {
+		if store == nil {
+			return errors.New("cache store is nil")
+		}
+
+		c.client = newCacheClient(store, c.client)
+		return nil
+	}
+}
+
+// WithSingleflight returns Option to collapse concurrent identical GET requests into one upstream call,
+// and share the buffered response with every caller. Requests are identical when they have the same URL,
+// the same Authorization, Proxy-Authorization and Cookie, and the same value of the given headers, e.g. "Accept-Language".
+// Each caller still runs its own hooks and tracing span, and stops waiting when its own context is done.
+func WithSingleflight(headers ...string) Option {
+	return func(c *DefaultHttpRequester) error {
+		c.flight = newFlightGroup(headers)
+		return nil
+	}
+}
+
+// WithCompression returns Option to compress request body and decode compressed response body,
+// see CompressionConfig. MinSize 0 uses the default 1024 bytes.
+func WithCompression(conf CompressionConfig) Option {
+	return func(c *DefaultHttpRequester) error {
+		if err := conf.Validate(); err != nil {
+			return err
+		}
+
+		if conf.MinSize == 0 {
+			conf.MinSize = 1024
+		}
+
+		c.compression = &conf
+		return nil
+	}
+}
+
+// WithCodecs returns Option to use registry in HttpResponse.Decode and Send,
+// and to send Accept header listing the registered media types when the request has none.
+func WithCodecs(registry *CodecRegistry) Option {
+	return func(c *DefaultHttpRequester) error {
+		if registry == nil {
+			return errors.New("codec registry is nil")
+		}
+
+		c.codecs = registry
+		return nil
+	}
+}
+
+// WithJSONNumber returns Option to choose how numbers in HttpRequest.Body and ResponseRaw.Body
+// are decoded for hooks, use JSONNumberUseNumber to keep large IDs and decimals exact.
+func WithJSONNumber(mode JSONNumberMode) Option {
+	return func(c *DefaultHttpRequester) error {
+		switch mode {
+		case JSONNumberFloat64, JSONNumberUseNumber, JSONNumberRaw:
+			c.jsonNumber = mode
+			return nil
+		default:
+			return fmt.Errorf("unsupported json number mode %s", mode)
+		}
+	}
+}
+
+// WithTokenSource returns Option to send Authorization header using token from source.
+// When server returns 401, the token is invalidated and the request is sent once more with a new token.
+// The header is added right before sending, so the token is not shown in curl command and hook.
+func WithTokenSource(source TokenSource) Option {
+	return func(c *DefaultHttpRequester) error {
+		if source == nil {
+			return errors.New("token source is nil")
+		}
+
+		if c.digest != nil {
+			return errors.New("token source can't be used with digest auth")
+		}
+
+		c.tokens = source
+		return nil
+	}
+}
+
+// WithClientCredentials returns Option to authorize request using OAuth2 client credentials grant,
+// see WithTokenSource. Token endpoint is called using the client given to DefaultClient, without options,
+// when conf.Client is nil.
+func WithClientCredentials(conf ClientCredentialsConfig) Option {
+	return func(c *DefaultHttpRequester) error {
+		if conf.Client == nil {
+			// token requests must not go through circuit breaker, faults or balancers added by other options
+			conf.Client = c.base
+		}
+
+		if c.digest != nil {
+			return errors.New("client credentials can't be used with digest auth")
+		}
+
+		source, err := NewClientCredentials(conf)
+		if err != nil {
+			return err
+		}
+
+		c.tokens = source
+		return nil
+	}
+}
+
+// WithDigestAuth returns Option to authorize request using HTTP Digest authentication (RFC 7616).
+// The first request of a host is sent without Authorization, then sent once more answering the 401 challenge.
+// Streamed body such as multipart upload can't be sent again, so its 401 response is returned as is.
+func WithDigestAuth(username, password string) Option {
+	return func(c *DefaultHttpRequester) error {
+		if c.tokens != nil {
+			return errors.New("digest auth can't be used with token source")
+		}
+
+		c.digest = NewDigestAuth(username, password)
+		return nil
+	}
+}
+
+// WithSigner returns Option to sign every request right before it is sent,
+// signers are applied in the order they are added.
+func WithSigner(signer RequestSigner) Option {
+	return func(c *DefaultHttpRequester) error {
+		if signer == nil {
+			return errors.New("signer is nil")
+		}
+
+		c.signers = append(c.signers, signer)
+		return nil
+	}
+}
+
+// WithSigV4 returns Option to sign every request using AWS Signature Version 4, see SigV4Config.
+func WithSigV4(conf SigV4Config) Option {
+	return func(c *DefaultHttpRequester) error {
+		signer, err := NewSigV4Signer(conf)
+		if err != nil {
+			return err
+		}
+
+		c.signers = append(c.signers, signer)
+		return nil
+	}
+}
+
+// WithMessageSignature returns Option to sign every request using HTTP Message Signatures (RFC 9421),
+// see MessageSignatureConfig.
+func WithMessageSignature(conf MessageSignatureConfig) Option {
+	return func(c *DefaultHttpRequester) error {
+		signer, err := NewMessageSigner(conf)
+		if err != nil {
+			return err
+		}
+
+		c.signers = append(c.signers, signer)
+		return nil
+	}
+}
+
+// WithHMAC returns Option to sign every request using HMAC-SHA256, see HMACConfig.
+func WithHMAC(conf HMACConfig) Option {
+	return func(c *DefaultHttpRequester) error {
+		signer, err := NewHMACSigner(conf)
+		if err != nil {
+			return err
+		}
+
+		c.signers = append(c.signers, signer)
+		return nil
+	}
+}
+
+// WithFaultInjection returns Option to inject faults from injector into matching requests,
+// injected faults are reported in HookData.Faults. Use injector to change rules or toggle it at runtime.
+// Add it before WithCircuitBreaker, so that injected faults count as failures like real ones.
+func WithFaultInjection(injector *FaultInjector) Option {
+	return func(c *DefaultHttpRequester) error {
+		if injector == nil {
+			return errors.New("fault injector is nil")
+		}
+
+		c.client = newFaultClient(injector, c.client)
+		c.faults = injector
+		return nil
+	}
+}
+
+// WithIdempotency returns Option to send idempotency key header with POST and PATCH requests,
+// the key is reported in HookData.IdempotencyKey. Use ContextWithIdempotencyKey to keep the key
+// when retrying the same call, otherwise each call gets a new key.
+func WithIdempotency(conf IdempotencyConfig) Option {
+	return func(c *DefaultHttpRequester) error {
+		if conf.Header == "" {
+			conf.Header = "Idempotency-Key"
+		}
+
+		if conf.Methods == nil {
+			conf.Methods = []string{http.MethodPost, http.MethodPatch}
+		}
+
+		if conf.Generator == nil {
+			conf.Generator = NewUUID
+		}
+
+		if err := conf.Validate(); err != nil {
+			return err
+		}
+
+		c.idempotency = &conf
+		return nil
+	}
+}
+
+// WithEndpoints returns Option to send requests to host conf.Service to one of conf.Endpoints,
+// e.g. "http://payments/v1/charges" is sent to "http://10.0.0.1:8080/v1/charges".
+// Host header is the endpoint host, or "payments" when conf.KeepHost is set or the request is signed.
+// Add it once for each service, requests to other hosts are sent as is.
+// Call DefaultHttpRequester.Close to stop health checks when the requester is no longer used.
+func WithEndpoints(conf EndpointsConfig) Option {
+	return func(c *DefaultHttpRequester) error {
+		if err := conf.Validate(); err != nil {
+			return err
+		}
+
+		if conf.Policy == "" {
+			conf.Policy = RoundRobin
+		}
+
+		if conf.MaxFailures == 0 {
+			conf.MaxFailures = 5
+		}
+
+		if conf.EjectionTime <= 0 {
+			conf.EjectionTime = Duration(30 * time.Second)
+		}
+
+		if conf.HealthCheckInterval <= 0 {
+			conf.HealthCheckInterval = Duration(10 * time.Second)
+		}
+
+		if conf.HealthCheckTimeout <= 0 {
+			conf.HealthCheckTimeout = Duration(2 * time.Second)
+		}
+
+		if conf.HealthCheckClient == nil {
+			// probes must reach the endpoint, not the cache or circuit breaker added by other options
+			conf.HealthCheckClient = c.base
+		}
+
+		b := newBalancer(conf, c.client)
+		c.client = b
+		c.closers = append(c.closers, b)
+		return nil
+	}
+}
+
+// WithSRV returns Option to send requests to "srv://name/path" to a target of the name DNS SRV records,
+// e.g. "srv://payments.service.consul/v1/charges" is sent to "http://10.0.0.1:8080/v1/charges".
+// Targets with the lowest priority are chosen by weight, and the next priority is tried on transport error.
+// Records are cached for conf.TTL. Host header is the target host, or the SRV name when conf.KeepHost is set
+// or the request is signed, like WithEndpoints.
+func WithSRV(conf SRVConfig) Option {
+	return func(c *DefaultHttpRequester) error {
+		if conf.Resolver == nil {
+			conf.Resolver = net.DefaultResolver
+		}
+
+		if conf.TTL <= 0 {
+			conf.TTL = Duration(30 * time.Second)
+		}
+
+		switch conf.Scheme {
+		case "":
+			conf.Scheme = "http"
+		case "http", "https":
+		default:
+			return fmt.Errorf("unsupported SRV scheme %s, use http or https", conf.Scheme)
+		}
+
+		c.client = newSRVClient(conf, c.client)
+		return nil
+	}
+}
+
+// WithMaxResponseBytes returns Option to fail with ErrResponseTooLarge when response body is bigger than n bytes,
+// either sent on the wire or decoded, instead of reading it all into memory. Use ContextWithMaxResponseBytes
+// to override the limit of a request, aborted responses are reported in HookData.Truncated.
+func WithMaxResponseBytes(n int64) Option {
+	return func(c *DefaultHttpRequester) error {
+		if n <= 0 {
+			return fmt.Errorf("max response bytes must be positive, got %d", n)
+		}
+
+		c.maxResponseBytes = n
 		return nil
 	}
 }
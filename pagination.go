@@ -0,0 +1,305 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// ErrStopPaging can be returned by EachPage callback to stop without error.
+var ErrStopPaging = errors.New("stop paging")
+
+// ErrMaxPagesReached returned by EachPage when PageConfig.MaxPages pages are read and there is still a next page.
+var ErrMaxPagesReached = errors.New("max pages reached")
+
+// ErrPageLoop returned by EachPage when the next page is a page that was already read.
+var ErrPageLoop = errors.New("next page was already read")
+
+// NextPageFunc returns URL of the page after resp, or nil when resp is the last page.
+type NextPageFunc func(current *url.URL, resp HttpResponse) (*url.URL, error)
+
+// PageConfig configures how EachPage and Pages walk a paginated list endpoint.
+type PageConfig struct {
+	CorrelationID string
+	Header        http.Header
+	// Next finds the next page, e.g. NextLink, NextCursor, NextOffset or NextPageNumber.
+	Next NextPageFunc
+	// MaxPages stops with ErrMaxPagesReached after this many pages when there are more, 0 means no limit.
+	MaxPages int
+}
+
+// EachPage gets path and every following page using requester, and calls fn with each page.
+// It stops when there is no next page, ctx is done, or fn returns error.
+// A page with status other than 2xx stops with error, reaching MaxPages stops with ErrMaxPagesReached,
+// and a next page that was already read stops with ErrPageLoop.
+func EachPage(ctx context.Context, requester HttpRequester, path string, conf PageConfig, fn func(page HttpResponse) error) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "EachPage")
+	defer func() {
+		span.Finish()
+		ctx.Done()
+	}()
+
+	if conf.Next == nil {
+		return errors.New("next page func is nil")
+	}
+
+	current, err := url.Parse(path)
+	if err != nil {
+		return fmt.Errorf("fail parse url %s: %s", path, err.Error())
+	}
+
+	seen := map[string]bool{}
+	for pages := 1; ; pages++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		header := http.Header{}
+		for key, values := range conf.Header {
+			header[key] = append([]string(nil), values...)
+		}
+
+		seen[current.String()] = true
+		page, err := requester.Get(ctx, conf.CorrelationID, current.String(), header)
+		if err != nil {
+			return err
+		}
+
+		if page.Raw.StatusCode < 200 || page.Raw.StatusCode > 299 {
+			return fmt.Errorf("page %s returned status %d", current.String(), page.Raw.StatusCode)
+		}
+
+		if err := fn(page); err != nil {
+			if errors.Is(err, ErrStopPaging) {
+				return nil
+			}
+
+			return err
+		}
+
+		next, err := conf.Next(current, page)
+		if err != nil {
+			return fmt.Errorf("fail get next page: %s", err.Error())
+		}
+
+		if next == nil {
+			return nil
+		}
+
+		// a server returning the same page again would loop forever
+		if seen[next.String()] {
+			return fmt.Errorf("%w: %s", ErrPageLoop, next.String())
+		}
+
+		if conf.MaxPages > 0 && pages >= conf.MaxPages {
+			return ErrMaxPagesReached
+		}
+
+		current = next
+	}
+}
+
+// NextLink follows RFC 8288 Link header with rel="next", relative reference is resolved against current URL.
+func NextLink() NextPageFunc {
+	return func(current *url.URL, resp HttpResponse) (*url.URL, error) {
+		for _, header := range resp.Raw.Header.Values("Link") {
+			for _, link := range splitLinks(header) {
+				target, rels := parseLink(link)
+				if target == "" {
+					continue
+				}
+
+				for _, rel := range rels {
+					if strings.EqualFold(rel, "next") {
+						next, err := url.Parse(target)
+						if err != nil {
+							return nil, err
+						}
+
+						return current.ResolveReference(next), nil
+					}
+				}
+			}
+		}
+
+		return nil, nil
+	}
+}
+
+// splitLinks splits Link header value by comma outside of <> and quoted string.
+func splitLinks(header string) []string {
+	var (
+		links  []string
+		quoted bool
+		inURI  bool
+		start  int
+	)
+
+	for i := 0; i < len(header); i++ {
+		switch c := header[i]; {
+		case c == '"' && !inURI:
+			quoted = !quoted
+		case c == '\\' && quoted:
+			i++
+		case c == '<' && !quoted:
+			inURI = true
+		case c == '>' && !quoted:
+			inURI = false
+		case c == ',' && !quoted && !inURI:
+			links = append(links, header[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(links, header[start:])
+}
+
+// parseLink returns target URI and relation types of a link-value.
+func parseLink(link string) (string, []string) {
+	link = strings.TrimSpace(link)
+	if !strings.HasPrefix(link, "<") {
+		return "", nil
+	}
+
+	end := strings.Index(link, ">")
+	if end < 0 {
+		return "", nil
+	}
+
+	target := link[1:end]
+	for _, param := range strings.Split(link[end+1:], ";") {
+		name, value, found := strings.Cut(strings.TrimSpace(param), "=")
+		if !found || !strings.EqualFold(strings.TrimSpace(name), "rel") {
+			continue
+		}
+
+		return target, strings.Fields(strings.Trim(strings.TrimSpace(value), `"`))
+	}
+
+	return target, nil
+}
+
+// NextCursor reads cursor from JSON field of the body, e.g. "meta.next_cursor",
+// and sends it as query param of the next page. Missing, null or empty cursor means the last page.
+func NextCursor(field, param string) NextPageFunc {
+	return func(current *url.URL, resp HttpResponse) (*url.URL, error) {
+		value, found, err := jsonField(resp.RespBody, field)
+		if err != nil || !found || value == nil {
+			return nil, err
+		}
+
+		var cursor string
+		switch v := value.(type) {
+		case string:
+			cursor = v
+		case json.Number:
+			cursor = v.String()
+		default:
+			return nil, fmt.Errorf("cursor field %s is %T, not string or number", field, value)
+		}
+
+		if cursor == "" {
+			return nil, nil
+		}
+
+		return withQuery(current, param, cursor), nil
+	}
+}
+
+// NextOffset increases offset query param by the number of items in itemsField, "" when body is the array.
+// Page with less than limit items is the last page.
+func NextOffset(offsetParam string, limit int, itemsField string) NextPageFunc {
+	return func(current *url.URL, resp HttpResponse) (*url.URL, error) {
+		count, err := countItems(resp.RespBody, itemsField)
+		if err != nil || count == 0 || count < limit {
+			return nil, err
+		}
+
+		offset := 0
+		if value := current.Query().Get(offsetParam); value != "" {
+			if offset, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("invalid offset %s: %s", value, err.Error())
+			}
+		}
+
+		return withQuery(current, offsetParam, strconv.Itoa(offset+count)), nil
+	}
+}
+
+// NextPageNumber increases page query param, starting from 1 when it's not set.
+// Page without items in itemsField, "" when body is the array, is the last page.
+func NextPageNumber(pageParam string, itemsField string) NextPageFunc {
+	return func(current *url.URL, resp HttpResponse) (*url.URL, error) {
+		count, err := countItems(resp.RespBody, itemsField)
+		if err != nil || count == 0 {
+			return nil, err
+		}
+
+		page := 1
+		if value := current.Query().Get(pageParam); value != "" {
+			if page, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("invalid page %s: %s", value, err.Error())
+			}
+		}
+
+		return withQuery(current, pageParam, strconv.Itoa(page+1)), nil
+	}
+}
+
+func withQuery(current *url.URL, param, value string) *url.URL {
+	next := *current
+	query := next.Query()
+	query.Set(param, value)
+	next.RawQuery = query.Encode()
+	return &next
+}
+
+func countItems(body []byte, field string) (int, error) {
+	value, found, err := jsonField(body, field)
+	if err != nil || !found || value == nil {
+		return 0, err
+	}
+
+	items, ok := value.([]interface{})
+	if !ok {
+		return 0, fmt.Errorf("items field %q is %T, not array", field, value)
+	}
+
+	return len(items), nil
+}
+
+// jsonField returns value of dot separated field path in JSON body, numbers are json.Number.
+func jsonField(body []byte, field string) (interface{}, bool, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, false, fmt.Errorf("fail decode page body: %s", err.Error())
+	}
+
+	if field == "" {
+		return value, true, nil
+	}
+
+	for _, key := range strings.Split(field, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false, nil
+		}
+
+		if value, ok = object[key]; !ok {
+			return nil, false, nil
+		}
+	}
+
+	return value, true, nil
+}
@@ -0,0 +1,38 @@
+//go:build go1.23
+
+package rest
+
+import (
+	"context"
+	"errors"
+	"iter"
+)
+
+// errBreak stops EachPage when the range loop over Pages breaks.
+var errBreak = errors.New("break")
+
+// Pages returns iterator over every page of paginated list endpoint, see EachPage.
+// The iterator yields the error and stops when a page can't be fetched, ErrMaxPagesReached when MaxPages is reached,
+// or ErrPageLoop when the next page was already read.
+//
+//	for page, err := range rest.Pages(ctx, client, url, rest.PageConfig{Next: rest.NextLink()}) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func Pages(ctx context.Context, requester HttpRequester, path string, conf PageConfig) iter.Seq2[HttpResponse, error] {
+	return func(yield func(HttpResponse, error) bool) {
+		err := EachPage(ctx, requester, path, conf, func(page HttpResponse) error {
+			if !yield(page, nil) {
+				return errBreak
+			}
+
+			return nil
+		})
+
+		if err != nil && !errors.Is(err, errBreak) {
+			yield(HttpResponse{}, err)
+		}
+	}
+}
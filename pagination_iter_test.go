@@ -0,0 +1,51 @@
+//go:build go1.23
+
+package rest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestPages(t *testing.T) {
+	convey.Convey("Test Pages iterator", t, func() {
+		ctx := context.Background()
+		server := newPageServer()
+		defer server.Close()
+
+		client, _ := DefaultClient(http.DefaultClient)
+
+		convey.Convey("Should yield every page", func() {
+			var pages []string
+			for page, err := range Pages(ctx, client, server.URL+"/link", PageConfig{Next: NextLink()}) {
+				convey.So(err, convey.ShouldBeNil)
+				pages = append(pages, string(page.RespBody))
+			}
+
+			convey.So(pages, convey.ShouldResemble, []string{"[0,1,2]", "[3,4,5]", "[6]"})
+		})
+
+		convey.Convey("Should stop on break", func() {
+			count := 0
+			for range Pages(ctx, client, server.URL+"/link", PageConfig{Next: NextLink()}) {
+				count++
+				break
+			}
+
+			convey.So(count, convey.ShouldEqual, 1)
+		})
+
+		convey.Convey("Should yield error", func() {
+			var errs []error
+			for _, err := range Pages(ctx, client, server.URL+"/error", PageConfig{Next: NextLink()}) {
+				errs = append(errs, err)
+			}
+
+			convey.So(len(errs), convey.ShouldEqual, 1)
+			convey.So(errs[0], convey.ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,191 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// newPageServer serves items 0 to 6 in pages of 3 using link, cursor, offset and page pagination.
+func newPageServer() *httptest.Server {
+	items := []int{0, 1, 2, 3, 4, 5, 6}
+	page := func(start int) ([]int, int) {
+		if start >= len(items) {
+			return []int{}, -1
+		}
+
+		end := start + 3
+		if end >= len(items) {
+			return items[start:], -1
+		}
+
+		return items[start:end], end
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/link", func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		list, next := page(start)
+		w.Header().Add("Link", `<https://example.com/docs>; rel="help"`)
+		if next > 0 {
+			w.Header().Add("Link", fmt.Sprintf(`</link?start=0>; rel="first", </link?start=%d>; rel="next last"`, next))
+		}
+		_, _ = fmt.Fprintf(w, "%v", toJSONArray(list))
+	})
+	mux.HandleFunc("/cursor", func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+		list, next := page(start)
+		cursor := "null"
+		if next > 0 {
+			cursor = strconv.Itoa(next)
+		}
+		_, _ = fmt.Fprintf(w, `{"data": %s, "meta": {"next_cursor": %s}}`, toJSONArray(list), cursor)
+	})
+	mux.HandleFunc("/offset", func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		list, _ := page(start)
+		_, _ = fmt.Fprintf(w, `{"items": %s}`, toJSONArray(list))
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		number, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if number == 0 {
+			number = 1
+		}
+		list, _ := page((number - 1) * 3)
+		_, _ = fmt.Fprintf(w, "%s", toJSONArray(list))
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", `</loop>; rel=next`)
+		_, _ = w.Write([]byte(`[]`))
+	})
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func toJSONArray(list []int) string {
+	s := "["
+	for i, v := range list {
+		if i > 0 {
+			s += ","
+		}
+		s += strconv.Itoa(v)
+	}
+	return s + "]"
+}
+
+func TestEachPage(t *testing.T) {
+	convey.Convey("Test EachPage", t, func() {
+		ctx := context.Background()
+		server := newPageServer()
+		defer server.Close()
+
+		client, _ := DefaultClient(http.DefaultClient)
+		collect := func(path string, conf PageConfig) ([]string, error) {
+			var pages []string
+			err := EachPage(ctx, client, server.URL+path, conf, func(page HttpResponse) error {
+				pages = append(pages, string(page.RespBody))
+				return nil
+			})
+			return pages, err
+		}
+
+		convey.Convey("Should follow Link rel=next", func() {
+			pages, err := collect("/link", PageConfig{Next: NextLink()})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(pages, convey.ShouldResemble, []string{"[0,1,2]", "[3,4,5]", "[6]"})
+		})
+
+		convey.Convey("Should follow cursor field", func() {
+			pages, err := collect("/cursor", PageConfig{Next: NextCursor("meta.next_cursor", "cursor")})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(pages), convey.ShouldEqual, 3)
+			convey.So(pages[2], convey.ShouldEqual, `{"data": [6], "meta": {"next_cursor": null}}`)
+		})
+
+		convey.Convey("Should follow offset until page is not full", func() {
+			pages, err := collect("/offset?limit=3", PageConfig{Next: NextOffset("offset", 3, "items")})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(pages, convey.ShouldResemble, []string{`{"items": [0,1,2]}`, `{"items": [3,4,5]}`, `{"items": [6]}`})
+		})
+
+		convey.Convey("Should follow page number until page is empty", func() {
+			pages, err := collect("/page", PageConfig{Next: NextPageNumber("page", "")})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(pages, convey.ShouldResemble, []string{"[0,1,2]", "[3,4,5]", "[6]", "[]"})
+		})
+
+		convey.Convey("Should stop at MaxPages, repeated page or ErrStopPaging", func() {
+			pages, err := collect("/page", PageConfig{Next: NextPageNumber("page", ""), MaxPages: 2})
+			convey.So(err, convey.ShouldEqual, ErrMaxPagesReached)
+			convey.So(len(pages), convey.ShouldEqual, 2)
+
+			pages, err = collect("/link", PageConfig{Next: NextLink(), MaxPages: 3})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(pages), convey.ShouldEqual, 3)
+
+			pages, err = collect("/loop", PageConfig{Next: NextLink()})
+			convey.So(errors.Is(err, ErrPageLoop), convey.ShouldBeTrue)
+			convey.So(err.Error(), convey.ShouldContainSubstring, "/loop")
+			convey.So(len(pages), convey.ShouldEqual, 1)
+
+			count := 0
+			err = EachPage(ctx, client, server.URL+"/link", PageConfig{Next: NextLink()}, func(page HttpResponse) error {
+				count++
+				return ErrStopPaging
+			})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(count, convey.ShouldEqual, 1)
+		})
+
+		convey.Convey("Should return error from status, callback, context and config", func() {
+			_, err := collect("/error", PageConfig{Next: NextLink()})
+			convey.So(err, convey.ShouldNotBeNil)
+
+			wantErr := errors.New("fail")
+			err = EachPage(ctx, client, server.URL+"/link", PageConfig{Next: NextLink()}, func(page HttpResponse) error {
+				return wantErr
+			})
+			convey.So(err, convey.ShouldEqual, wantErr)
+
+			canceled, cancel := context.WithCancel(ctx)
+			cancel()
+			err = EachPage(canceled, client, server.URL+"/link", PageConfig{Next: NextLink()}, func(page HttpResponse) error {
+				return nil
+			})
+			convey.So(errors.Is(err, context.Canceled), convey.ShouldBeTrue)
+
+			_, err = collect("/link", PageConfig{})
+			convey.So(err, convey.ShouldNotBeNil)
+
+			_, err = collect("/cursor", PageConfig{Next: NextCursor("data", "cursor")})
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
+
+func TestNextLink(t *testing.T) {
+	convey.Convey("Parse RFC 8288 Link header", t, func() {
+		current, _ := url.Parse("https://api.example.com/v1/items?page=1")
+		resp := HttpResponse{Raw: ResponseRaw{Header: http.Header{
+			"Link": {`<https://api.example.com/v1/items?page=1>; rel="prev"; title="a, b; c", <?page=2>; REL=next`},
+		}}}
+
+		next, err := NextLink()(current, resp)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(next.String(), convey.ShouldEqual, "https://api.example.com/v1/items?page=2")
+
+		next, err = NextLink()(current, HttpResponse{})
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(next, convey.ShouldBeNil)
+	})
+}
@@ -0,0 +1,39 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+)
+
+type maxResponseBytesKey struct{}
+
+// ContextWithMaxResponseBytes returns ctx limiting response body of requests sent with ctx to n bytes,
+// it overrides WithMaxResponseBytes. n <= 0 reads the response body without limit.
+func ContextWithMaxResponseBytes(ctx context.Context, n int64) context.Context {
+	return context.WithValue(ctx, maxResponseBytesKey{}, n)
+}
+
+func maxResponseBytesFromContext(ctx context.Context) (int64, bool) {
+	n, ok := ctx.Value(maxResponseBytesKey{}).(int64)
+	return n, ok
+}
+
+// readLimited reads r entirely, or returns ErrResponseTooLarge with the limit+1 bytes read when r is bigger than limit.
+// limit <= 0 reads r without limit.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return ioutil.ReadAll(r)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return data, err
+	}
+
+	if int64(len(data)) > limit {
+		return data, ErrResponseTooLarge
+	}
+
+	return data, nil
+}
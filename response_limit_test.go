@@ -0,0 +1,114 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestWithMaxResponseBytes(t *testing.T) {
+	convey.Convey("Test WithMaxResponseBytes", t, func() {
+		ctx := context.Background()
+		var read *countingReader
+		var contentLength int64 = -1
+		body := []byte(strings.Repeat("a", 100))
+		upstream := &mockClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+			read = &countingReader{reader: bytes.NewReader(body)}
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				ContentLength: contentLength,
+				Body:          noopCloser(read, nil),
+			}, nil
+		}}
+
+		hook := new(lastHook)
+		client, err := DefaultClient(upstream, WithMaxResponseBytes(64), AddHook(hook))
+		convey.So(err, convey.ShouldBeNil)
+
+		convey.Convey("Should fail without reading body when Content-Length exceeds the limit", func() {
+			contentLength = 100
+			resp, err := client.Get(ctx, "", "http://api.example.com/items", http.Header{})
+			convey.So(errors.Is(err, ErrResponseTooLarge), convey.ShouldBeTrue)
+			convey.So(err.Error(), convey.ShouldContainSubstring, "content length 100 exceeds 64 bytes")
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusOK)
+			convey.So(read.count(), convey.ShouldEqual, 0)
+			convey.So(hook.data.Truncated, convey.ShouldBeTrue)
+		})
+
+		convey.Convey("Should stop reading body of unknown length at the limit", func() {
+			_, err := client.Get(ctx, "", "http://api.example.com/items", http.Header{})
+			convey.So(errors.Is(err, ErrResponseTooLarge), convey.ShouldBeTrue)
+			convey.So(read.count(), convey.ShouldEqual, 65)
+			convey.So(hook.data.Truncated, convey.ShouldBeTrue)
+
+			body = body[:64]
+			resp, err := client.Get(ctx, "", "http://api.example.com/items", http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(resp.RespBody), convey.ShouldEqual, 64)
+			convey.So(hook.data.Truncated, convey.ShouldBeFalse)
+		})
+
+		convey.Convey("Should override the limit per request", func() {
+			resp, err := client.Get(ContextWithMaxResponseBytes(ctx, 100), "", "http://api.example.com/items", http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(resp.RespBody), convey.ShouldEqual, 100)
+
+			_, err = client.Get(ContextWithMaxResponseBytes(ctx, 0), "", "http://api.example.com/items", http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+
+			unlimited, _ := DefaultClient(upstream)
+			_, err = unlimited.Get(ContextWithMaxResponseBytes(ctx, 10), "", "http://api.example.com/items", http.Header{})
+			convey.So(errors.Is(err, ErrResponseTooLarge), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("Should limit decoded body", func() {
+			compressed, _ := compressBody(EncodingGzip, []byte(strings.Repeat("a", 10000)))
+			body = compressed
+			upstream := &mockClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{"Content-Encoding": {"gzip"}},
+					Body:       noopCloser(bytes.NewReader(body), nil),
+				}, nil
+			}}
+
+			client, _ := DefaultClient(upstream, WithCompression(CompressionConfig{DecodeResponse: true}), WithMaxResponseBytes(1000), AddHook(hook))
+			_, err := client.Get(ctx, "", "http://api.example.com/items", http.Header{})
+			convey.So(errors.Is(err, ErrResponseTooLarge), convey.ShouldBeTrue)
+			convey.So(err.Error(), convey.ShouldContainSubstring, "decoded body exceeds 1000 bytes")
+			convey.So(hook.data.Truncated, convey.ShouldBeTrue)
+		})
+
+		convey.Convey("Should limit body buffered by cache and singleflight", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Cache-Control", "max-age=60")
+				w.(http.Flusher).Flush()
+				_, _ = w.Write([]byte(strings.Repeat("a", 100)))
+			}))
+			defer server.Close()
+
+			store := NewMemoryCacheStore(10)
+			for _, opt := range []Option{WithCache(store), WithSingleflight()} {
+				client, _ := DefaultClient(http.DefaultClient, opt, WithMaxResponseBytes(64))
+				_, err := client.Get(ctx, "", server.URL, http.Header{})
+				convey.So(errors.Is(err, ErrResponseTooLarge), convey.ShouldBeTrue)
+			}
+
+			client, _ := DefaultClient(http.DefaultClient, WithCache(store), WithMaxResponseBytes(64))
+			resp, err := client.Get(ContextWithMaxResponseBytes(ctx, 100), "", server.URL, http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(resp.CacheStatus, convey.ShouldEqual, CacheMiss)
+		})
+
+		convey.Convey("Should reject limit that is not positive", func() {
+			_, err := DefaultClient(upstream, WithMaxResponseBytes(0))
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
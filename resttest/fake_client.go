@@ -0,0 +1,390 @@
+// Package resttest provides FakeClient, a route matching rest.HttpClient for unit tests.
+package resttest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armiariyan/rest"
+)
+
+// ErrNoRoute returned by FakeClient when no route matches the request.
+var ErrNoRoute = errors.New("resttest: no route matches the request")
+
+// T is the subset of testing.TB used by FakeClient.
+type T interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Response is a canned response, Err is returned instead of the response when it is set.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Delay      time.Duration
+	Err        error
+}
+
+// Request is a request received by FakeClient.
+type Request struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	Body   []byte
+	// Params are values of {name} segments in the route pattern.
+	Params map[string]string
+}
+
+// DecodeJSON decodes request body into v.
+func (r Request) DecodeJSON(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// FakeClient is rest.HttpClient that answers requests from registered routes and records them.
+// Request without matching route fails the test.
+type FakeClient struct {
+	t T
+
+	mu       sync.Mutex
+	routes   []*Route
+	requests []Request
+}
+
+var _ rest.HttpClient = &FakeClient{}
+
+// NewFakeClient returns FakeClient that reports unmatched requests and failed assertions to t.
+func NewFakeClient(t T) *FakeClient {
+	return &FakeClient{t: t}
+}
+
+// On registers route for method and path pattern, routes are matched in the registered order.
+// Method "" or "*" matches any method. Pattern segment {name} matches one path segment
+// and the last segment * matches the rest of the path.
+func (c *FakeClient) On(method, pattern string) *Route {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	route := &Route{
+		t:        c.t,
+		method:   strings.ToUpper(method),
+		pattern:  pattern,
+		segments: splitPath(pattern),
+	}
+	c.routes = append(c.routes, route)
+	return route
+}
+
+// Requests returns every request received by the client.
+func (c *FakeClient) Requests() []Request {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Request(nil), c.requests...)
+}
+
+// AssertAllCalled fails the test when a route is never called.
+func (c *FakeClient) AssertAllCalled() bool {
+	c.t.Helper()
+
+	c.mu.Lock()
+	routes := append([]*Route(nil), c.routes...)
+	c.mu.Unlock()
+
+	ok := true
+	for _, route := range routes {
+		if route.Count() == 0 {
+			c.t.Errorf("resttest: route %s %s is never called", route.methodName(), route.pattern)
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+// Do answers request from the first matching route.
+func (c *FakeClient) Do(request *http.Request) (*http.Response, error) {
+	var body []byte
+	if request.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(request.Body)
+		_ = request.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("fail read request body: %s", err.Error())
+		}
+	}
+
+	received := Request{
+		Method: request.Method,
+		URL:    request.URL,
+		Header: request.Header.Clone(),
+		Body:   body,
+	}
+
+	c.mu.Lock()
+	var route *Route
+	for _, candidate := range c.routes {
+		if params, ok := candidate.match(request.Method, request.URL.Path); ok {
+			route, received.Params = candidate, params
+			break
+		}
+	}
+	c.requests = append(c.requests, received)
+	c.mu.Unlock()
+
+	if route == nil {
+		c.t.Helper()
+		c.t.Errorf("resttest: unexpected request %s %s", request.Method, request.URL.String())
+		return nil, fmt.Errorf("%w: %s %s", ErrNoRoute, request.Method, request.URL.String())
+	}
+
+	resp := route.next(received)
+	if resp.Delay > 0 {
+		timer := time.NewTimer(resp.Delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-request.Context().Done():
+			return nil, request.Context().Err()
+		}
+	}
+
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+
+	status := resp.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	return rest.NewResponse(request, status, resp.Header.Clone(), resp.Body), nil
+}
+
+// Route is a registered method and path pattern with its responses.
+type Route struct {
+	t        T
+	method   string
+	pattern  string
+	segments []string
+
+	mu        sync.Mutex
+	responses []Response
+	delay     time.Duration
+	requests  []Request
+}
+
+// Reply adds responses to the sequence, each call uses the next response and the last one is repeated.
+// Route without response returns 200 with empty body.
+func (r *Route) Reply(responses ...Response) *Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.responses = append(r.responses, responses...)
+	return r
+}
+
+// Respond adds response with status and body to the sequence.
+func (r *Route) Respond(status int, body string) *Route {
+	return r.Reply(Response{StatusCode: status, Body: []byte(body)})
+}
+
+// RespondJSON adds response with status and v encoded as JSON to the sequence.
+func (r *Route) RespondJSON(status int, v interface{}) *Route {
+	r.t.Helper()
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		r.t.Errorf("resttest: fail encode response of %s %s: %s", r.methodName(), r.pattern, err.Error())
+	}
+
+	return r.Reply(Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       body,
+	})
+}
+
+// RespondError adds err to the sequence, e.g. rest.ErrHttpTimeout.
+func (r *Route) RespondError(err error) *Route {
+	return r.Reply(Response{Err: err})
+}
+
+// Delay waits d before every response of the route, in addition to Response.Delay.
+func (r *Route) Delay(d time.Duration) *Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.delay = d
+	return r
+}
+
+// Count returns the number of requests matched by the route.
+func (r *Route) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.requests)
+}
+
+// Requests returns requests matched by the route.
+func (r *Route) Requests() []Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Request(nil), r.requests...)
+}
+
+// AssertCalled fails the test when the route is not called exactly times.
+func (r *Route) AssertCalled(times int) bool {
+	r.t.Helper()
+
+	if count := r.Count(); count != times {
+		r.t.Errorf("resttest: route %s %s is called %d times, want %d", r.methodName(), r.pattern, count, times)
+		return false
+	}
+
+	return true
+}
+
+// AssertHeader fails the test when the last request of the route doesn't have header key with value.
+func (r *Route) AssertHeader(key, value string) bool {
+	r.t.Helper()
+
+	last, ok := r.last()
+	if !ok {
+		return false
+	}
+
+	if got := last.Header.Get(key); got != value {
+		r.t.Errorf("resttest: route %s %s header %s is %q, want %q", r.methodName(), r.pattern, key, got, value)
+		return false
+	}
+
+	return true
+}
+
+// AssertJSON fails the test when the last request body of the route isn't JSON equal to want.
+func (r *Route) AssertJSON(want interface{}) bool {
+	r.t.Helper()
+
+	last, ok := r.last()
+	if !ok {
+		return false
+	}
+
+	var got interface{}
+	if err := last.DecodeJSON(&got); err != nil {
+		r.t.Errorf("resttest: route %s %s body is not JSON: %s", r.methodName(), r.pattern, err.Error())
+		return false
+	}
+
+	encoded, err := json.Marshal(want)
+	if err != nil {
+		r.t.Errorf("resttest: fail encode expected body: %s", err.Error())
+		return false
+	}
+
+	var expected interface{}
+	_ = json.Unmarshal(encoded, &expected)
+
+	if !reflect.DeepEqual(got, expected) {
+		r.t.Errorf("resttest: route %s %s body is %s, want %s", r.methodName(), r.pattern, last.Body, encoded)
+		return false
+	}
+
+	return true
+}
+
+func (r *Route) last() (Request, bool) {
+	r.t.Helper()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.requests) == 0 {
+		r.t.Errorf("resttest: route %s %s is never called", r.methodName(), r.pattern)
+		return Request{}, false
+	}
+
+	return r.requests[len(r.requests)-1], true
+}
+
+// next records request and returns its response.
+func (r *Route) next(request Request) Response {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	index := len(r.requests)
+	r.requests = append(r.requests, request)
+
+	var resp Response
+	if len(r.responses) > 0 {
+		if index >= len(r.responses) {
+			index = len(r.responses) - 1
+		}
+		resp = r.responses[index]
+	}
+
+	resp.Delay += r.delay
+	return resp
+}
+
+func (r *Route) match(method, path string) (map[string]string, bool) {
+	if r.method != "" && r.method != "*" && r.method != method {
+		return nil, false
+	}
+
+	segments := splitPath(path)
+	params := map[string]string{}
+	for i, segment := range r.segments {
+		if segment == "*" && i == len(r.segments)-1 {
+			return params, true
+		}
+
+		if i >= len(segments) {
+			return nil, false
+		}
+
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			params[segment[1:len(segment)-1]] = segments[i]
+			continue
+		}
+
+		if segment != segments[i] {
+			return nil, false
+		}
+	}
+
+	if len(segments) != len(r.segments) {
+		return nil, false
+	}
+
+	return params, true
+}
+
+func (r *Route) methodName() string {
+	if r.method == "" {
+		return "*"
+	}
+
+	return r.method
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+
+	return strings.Split(path, "/")
+}
@@ -0,0 +1,119 @@
+package resttest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/armiariyan/rest"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// recorder is T that records failures instead of failing the test.
+type recorder struct {
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestFakeClient(t *testing.T) {
+	convey.Convey("Test FakeClient", t, func() {
+		ctx := context.Background()
+		rec := new(recorder)
+		fake := NewFakeClient(rec)
+		client, _ := rest.DefaultClient(fake)
+
+		convey.Convey("Should answer from matching route with path params", func() {
+			user := fake.On(http.MethodGet, "/users/{id}").RespondJSON(http.StatusOK, map[string]int{"id": 7})
+			files := fake.On("*", "/files/*").Respond(http.StatusAccepted, "ok")
+
+			resp, err := client.Get(ctx, "", "http://api.example.com/users/7?expand=true", http.Header{"X-Tenant": {"a"}})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusOK)
+			convey.So(string(resp.RespBody), convey.ShouldEqual, `{"id":7}`)
+			convey.So(resp.Raw.Header.Get("Content-Type"), convey.ShouldEqual, "application/json")
+
+			resp, _ = client.Delete(ctx, "", "http://api.example.com/files/a/b.txt", http.Header{}, nil)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusAccepted)
+
+			convey.So(user.Requests()[0].Params, convey.ShouldResemble, map[string]string{"id": "7"})
+			convey.So(user.AssertCalled(1), convey.ShouldBeTrue)
+			convey.So(user.AssertHeader("X-Tenant", "a"), convey.ShouldBeTrue)
+			convey.So(files.AssertCalled(1), convey.ShouldBeTrue)
+			convey.So(fake.AssertAllCalled(), convey.ShouldBeTrue)
+			convey.So(len(fake.Requests()), convey.ShouldEqual, 2)
+			convey.So(rec.errors, convey.ShouldBeEmpty)
+		})
+
+		convey.Convey("Should return responses in sequence and repeat the last", func() {
+			fake.On(http.MethodPost, "/orders").
+				Respond(http.StatusServiceUnavailable, "").
+				RespondError(rest.ErrHttpTimeout).
+				Respond(http.StatusCreated, `{"id": 1}`)
+
+			resp, _ := client.Post(ctx, "", "http://api.example.com/orders", http.Header{}, nil)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusServiceUnavailable)
+
+			_, err := client.Post(ctx, "", "http://api.example.com/orders", http.Header{}, nil)
+			convey.So(errors.Is(err, rest.ErrHttpTimeout), convey.ShouldBeTrue)
+
+			for i := 0; i < 2; i++ {
+				resp, _ = client.Post(ctx, "", "http://api.example.com/orders", http.Header{}, nil)
+				convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusCreated)
+			}
+		})
+
+		convey.Convey("Should delay response and stop on context done", func() {
+			fake.On(http.MethodGet, "/slow").Delay(50 * time.Millisecond)
+
+			start := time.Now()
+			resp, err := client.Get(ctx, "", "http://api.example.com/slow", http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusOK)
+			convey.So(time.Since(start), convey.ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+
+			timeout, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+			defer cancel()
+			_, err = client.Get(timeout, "", "http://api.example.com/slow", http.Header{})
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Should assert decoded JSON body", func() {
+			route := fake.On(http.MethodPost, "/orders")
+			_, _ = client.Post(ctx, "", "http://api.example.com/orders", http.Header{}, []byte(`{"amount": 10, "items": ["a"]}`))
+
+			convey.So(route.AssertJSON(map[string]interface{}{"items": []string{"a"}, "amount": 10}), convey.ShouldBeTrue)
+
+			var body struct{ Amount int }
+			convey.So(route.Requests()[0].DecodeJSON(&body), convey.ShouldBeNil)
+			convey.So(body.Amount, convey.ShouldEqual, 10)
+
+			convey.So(route.AssertJSON(map[string]int{"amount": 11}), convey.ShouldBeFalse)
+			convey.So(route.AssertHeader("X-Tenant", "a"), convey.ShouldBeFalse)
+			convey.So(route.AssertCalled(2), convey.ShouldBeFalse)
+			convey.So(len(rec.errors), convey.ShouldEqual, 3)
+		})
+
+		convey.Convey("Should fail test for unmatched request and uncalled route", func() {
+			fake.On(http.MethodGet, "/users/{id}")
+
+			_, err := client.Post(ctx, "", "http://api.example.com/users/1", http.Header{}, nil)
+			convey.So(err.Error(), convey.ShouldContainSubstring, ErrNoRoute.Error())
+
+			request, _ := http.NewRequest(http.MethodGet, "http://api.example.com/users/1/orders", nil)
+			_, err = fake.Do(request)
+			convey.So(errors.Is(err, ErrNoRoute), convey.ShouldBeTrue)
+
+			convey.So(fake.AssertAllCalled(), convey.ShouldBeFalse)
+			convey.So(len(rec.errors), convey.ShouldEqual, 3)
+			convey.So(rec.errors[0], convey.ShouldContainSubstring, "unexpected request POST http://api.example.com/users/1")
+		})
+	})
+}
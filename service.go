@@ -3,6 +3,7 @@ package rest
 import (
 	"context"
 	"net/http"
+	"net/url"
 )
 
 // AuthVirgoHttpRequester is a service for http client request
@@ -14,6 +15,12 @@ type HttpRequester interface {
 	Delete(ctx context.Context, correlationID, path string, requestHeader http.Header, requestBody []byte) (ret HttpResponse, err error)
 }
 
+// FormRequester sends url-encoded and multipart form
+type FormRequester interface {
+	PostForm(ctx context.Context, correlationID, path string, requestHeader http.Header, form url.Values) (ret HttpResponse, err error)
+	PostMultipart(ctx context.Context, correlationID, path string, requestHeader http.Header, body *Multipart) (ret HttpResponse, err error)
+}
+
 type HttpClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
@@ -0,0 +1,68 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// RequestSigner signs request right before it is sent, after every header such as correlation ID,
+// tracing and Authorization has been set, and after the body is compressed.
+// Sign may add headers or query parameters to request, which is a copy owned by the signer.
+type RequestSigner interface {
+	Sign(ctx context.Context, request *http.Request) error
+}
+
+// sign returns send function that signs a copy of request using every signer before calling send,
+// so signature headers are not shown in curl command and hook.
+func (r DefaultHttpRequester) sign(ctx context.Context, send func(*http.Request) (*http.Response, error)) func(*http.Request) (*http.Response, error) {
+	if len(r.signers) == 0 {
+		return send
+	}
+
+	return func(request *http.Request) (*http.Response, error) {
+		signed := request.Clone(context.WithValue(request.Context(), signedKey{}, true))
+		for _, signer := range r.signers {
+			if err := signer.Sign(ctx, signed); err != nil {
+				return nil, fmt.Errorf("fail sign request: %s", err.Error())
+			}
+		}
+
+		return send(signed)
+	}
+}
+
+type signedKey struct{}
+
+// isSigned returns true when request with ctx is signed by WithSigner and the like.
+func isSigned(ctx context.Context) bool {
+	signed, _ := ctx.Value(signedKey{}).(bool)
+	return signed
+}
+
+// readBody returns the request body without consuming it, known is false when
+// the body is a stream that can't be read twice, e.g. multipart upload.
+func readBody(request *http.Request) (body []byte, known bool, err error) {
+	if request.Body == nil || request.Body == http.NoBody {
+		return nil, true, nil
+	}
+
+	if request.GetBody == nil {
+		return nil, false, nil
+	}
+
+	reader, err := request.GetBody()
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer reader.Close()
+
+	body, err = ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return body, true, nil
+}
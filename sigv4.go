@@ -0,0 +1,302 @@
+package rest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm       = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat      = "20060102T150405Z"
+	sigV4DateFormat      = "20060102"
+	sigV4UnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// sigV4IgnoredHeaders are not signed because proxies and the Go transport may change them.
+var sigV4IgnoredHeaders = map[string]bool{
+	"authorization":     true,
+	"user-agent":        true,
+	"x-amzn-trace-id":   true,
+	"expect":            true,
+	"transfer-encoding": true,
+	"content-length":    true,
+}
+
+// SigV4Config configures AWS Signature Version 4.
+type SigV4Config struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // sent as X-Amz-Security-Token when set
+	Region          string // e.g. "us-east-1"
+	Service         string // e.g. "s3", "execute-api"
+	// UnsignedPayload signs "UNSIGNED-PAYLOAD" instead of body hash, S3 only.
+	// It must be set to sign streamed body such as multipart upload.
+	UnsignedPayload bool
+	// DisableURIPathEscaping uses the escaped path of the request URL as is, S3 requires it.
+	// Otherwise the decoded path is escaped once with uriEncode, as in AWS test suite. Default true for "s3".
+	DisableURIPathEscaping *bool
+}
+
+// Validate returns error when required field is missing.
+func (c SigV4Config) Validate() error {
+	var errs []error
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		errs = append(errs, errors.New("sigv4 access key id and secret access key are required"))
+	}
+
+	if c.Region == "" {
+		errs = append(errs, errors.New("sigv4 region is empty"))
+	}
+
+	if c.Service == "" {
+		errs = append(errs, errors.New("sigv4 service is empty"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// SigV4Signer signs request using AWS Signature Version 4, see WithSigV4.
+type SigV4Signer struct {
+	conf SigV4Config
+	now  func() time.Time
+}
+
+var _ RequestSigner = &SigV4Signer{}
+
+// NewSigV4Signer returns SigV4Signer for conf.
+func NewSigV4Signer(conf SigV4Config) (*SigV4Signer, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &SigV4Signer{conf: conf, now: time.Now}, nil
+}
+
+// Sign sets X-Amz-Date, X-Amz-Security-Token and Authorization header of request.
+// X-Amz-Content-Sha256 is set for "s3" service and for unsigned payload.
+func (s *SigV4Signer) Sign(_ context.Context, request *http.Request) error {
+	payloadHash, err := s.payloadHash(request)
+	if err != nil {
+		return err
+	}
+
+	now := s.now().UTC()
+	request.Header.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	if s.conf.SessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", s.conf.SessionToken)
+	}
+
+	if s.conf.Service == "s3" || s.conf.UnsignedPayload {
+		request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	signedHeaders, canonicalHeaders := s.canonicalHeaders(request, nil)
+	signature := s.signature(now, request, request.URL.Query(), signedHeaders, canonicalHeaders, payloadHash)
+
+	request.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, s.conf.AccessKeyID, s.scope(now), signedHeaders, signature))
+	return nil
+}
+
+// Presign returns URL of request that is authorized by query parameters until expires,
+// so it can be used without credentials, e.g. to download S3 object from browser.
+// The payload is not signed, and only Host header is signed unless headers names others in request.
+func (s *SigV4Signer) Presign(request *http.Request, expires time.Duration, headers ...string) (string, error) {
+	if expires < time.Second || expires > 7*24*time.Hour {
+		return "", errors.New("sigv4 presign expires must be between 1 second and 7 days")
+	}
+
+	now := s.now().UTC()
+	signedHeaders, canonicalHeaders := s.canonicalHeaders(request, headers)
+
+	query := request.URL.Query()
+	query.Set("X-Amz-Algorithm", sigV4Algorithm)
+	query.Set("X-Amz-Credential", s.conf.AccessKeyID+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+	if s.conf.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", s.conf.SessionToken)
+	}
+
+	signature := s.signature(now, request, query, signedHeaders, canonicalHeaders, sigV4UnsignedPayload)
+
+	presigned := *request.URL
+	presigned.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" + signature
+	return presigned.String(), nil
+}
+
+func (s *SigV4Signer) payloadHash(request *http.Request) (string, error) {
+	if s.conf.UnsignedPayload {
+		return sigV4UnsignedPayload, nil
+	}
+
+	body, known, err := readBody(request)
+	if err != nil {
+		return "", fmt.Errorf("fail read body for sigv4: %s", err.Error())
+	}
+
+	if !known {
+		return "", errors.New("sigv4 can't hash streamed body, use SigV4Config.UnsignedPayload")
+	}
+
+	return hashHex(body), nil
+}
+
+func (s *SigV4Signer) scope(now time.Time) string {
+	return strings.Join([]string{now.Format(sigV4DateFormat), s.conf.Region, s.conf.Service, "aws4_request"}, "/")
+}
+
+// canonicalHeaders returns signed header names and canonical headers, only names in include
+// are signed when include is not nil. Host is always signed.
+func (s *SigV4Signer) canonicalHeaders(request *http.Request, include []string) (string, string) {
+	host := request.Host
+	if host == "" {
+		host = request.URL.Host
+	}
+
+	values := map[string][]string{"host": {host}}
+	if include != nil {
+		for _, name := range include {
+			if v := request.Header.Values(name); len(v) > 0 {
+				values[strings.ToLower(name)] = v
+			}
+		}
+	} else {
+		for name, v := range request.Header {
+			lower := strings.ToLower(name)
+			if !sigV4IgnoredHeaders[lower] {
+				values[lower] = append(values[lower], v...)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		trimmed := make([]string, 0, len(values[name]))
+		for _, v := range values[name] {
+			trimmed = append(trimmed, strings.Join(strings.Fields(v), " "))
+		}
+
+		canonical.WriteString(name)
+		canonical.WriteString(":")
+		canonical.WriteString(strings.Join(trimmed, ","))
+		canonical.WriteString("\n")
+	}
+
+	return strings.Join(names, ";"), canonical.String()
+}
+
+// canonicalURI returns the path escaped once, the escaped path of u is kept as is when escaping is disabled.
+func (s *SigV4Signer) canonicalURI(u *url.URL) string {
+	disableEscaping := s.conf.Service == "s3"
+	if s.conf.DisableURIPathEscaping != nil {
+		disableEscaping = *s.conf.DisableURIPathEscaping
+	}
+
+	path := u.EscapedPath()
+	if !disableEscaping {
+		path = uriEncode(u.Path, false)
+	}
+
+	if path == "" {
+		return "/"
+	}
+
+	return path
+}
+
+func (s *SigV4Signer) signature(now time.Time, request *http.Request, query url.Values, signedHeaders, canonicalHeaders, payloadHash string) string {
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		s.canonicalURI(request.URL),
+		canonicalQuery(query),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		now.Format(sigV4TimeFormat),
+		s.scope(now),
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.conf.SecretAccessKey), now.Format(sigV4DateFormat))
+	key = hmacSHA256(key, s.conf.Region)
+	key = hmacSHA256(key, s.conf.Service)
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// canonicalQuery encodes query sorted by key and value using uriEncode.
+func canonicalQuery(query url.Values) string {
+	type pair struct{ key, value string }
+
+	pairs := make([]pair, 0, len(query))
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, pair{key: uriEncode(key, true), value: uriEncode(value, true)})
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].key != pairs[j].key {
+			return pairs[i].key < pairs[j].key
+		}
+		return pairs[i].value < pairs[j].value
+	})
+
+	encoded := make([]string, 0, len(pairs))
+	for _, p := range pairs {
+		encoded = append(encoded, p.key+"="+p.value)
+	}
+
+	return strings.Join(encoded, "&")
+}
+
+// uriEncode percent-encodes every byte except unreserved characters (RFC 3986), and "/" when encodeSlash is false.
+func uriEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			encoded.WriteByte(c)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+
+	return encoded.String()
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,213 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// flightResult is the buffered upstream response shared by all callers of the same flight.
+type flightResult struct {
+	resp    *http.Response
+	body    []byte
+	errBody error
+	errHttp error
+}
+
+type flightCall struct {
+	done     chan struct{}
+	callers  int // guarded by flightGroup mu
+	cancel   context.CancelFunc
+	result   flightResult
+	panicked interface{}
+}
+
+// credentialHeaders are always part of the key, so callers never get the response of other credentials.
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// flightGroup collapses concurrent identical requests into one upstream call.
+type flightGroup struct {
+	headers []string
+
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+func newFlightGroup(headers []string) *flightGroup {
+	canonical := make([]string, 0, len(credentialHeaders)+len(headers))
+	seen := make(map[string]bool)
+	for _, h := range append(append([]string(nil), credentialHeaders...), headers...) {
+		h = http.CanonicalHeaderKey(h)
+		if !seen[h] {
+			seen[h] = true
+			canonical = append(canonical, h)
+		}
+	}
+
+	return &flightGroup{
+		headers: canonical,
+		calls:   make(map[string]*flightCall),
+	}
+}
+
+// key identifies identical request by method, URL, selected headers and response size limit.
+func (g *flightGroup) key(request *http.Request) string {
+	var key strings.Builder
+	key.WriteString(request.Method)
+	key.WriteString(" ")
+	key.WriteString(request.URL.String())
+	for _, name := range g.headers {
+		key.WriteString("\n")
+		key.WriteString(name)
+		key.WriteString(": ")
+		key.WriteString(strings.Join(request.Header.Values(name), ","))
+	}
+
+	if limit, ok := maxResponseBytesFromContext(request.Context()); ok {
+		key.WriteString("\nlimit: ")
+		key.WriteString(strconv.FormatInt(limit, 10))
+	}
+
+	return key.String()
+}
+
+// do sends request using client, or waits for identical request in flight.
+// It returns a new http.Response for each caller, and whether the response is shared with other caller.
+//
+// Upstream is called in background with the values of the first request context but without its deadline,
+// so the first caller leaving doesn't fail the others. Each caller stops waiting when its own context is done,
+// and the upstream call is canceled when every caller has left.
+func (g *flightGroup) do(client HttpClient, request *http.Request) (*http.Response, bool, error) {
+	key := g.key(request)
+
+	g.mu.Lock()
+	call, shared := g.calls[key]
+	if !shared {
+		ctx, cancel := context.WithCancel(detachedContext{parent: request.Context()})
+		call = &flightCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = call
+		go g.run(key, call, client, request.WithContext(ctx))
+	}
+	call.callers++
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		if call.panicked != nil {
+			panic(call.panicked)
+		}
+
+		resp, err := call.result.response()
+		return resp, shared, err
+	case <-request.Context().Done():
+		g.leave(key, call)
+		return nil, false, request.Context().Err()
+	}
+}
+
+// run calls upstream for every caller of call.
+func (g *flightGroup) run(key string, call *flightCall, client HttpClient, request *http.Request) {
+	defer func() {
+		// a panic is raised again in every caller, instead of leaving them waiting forever
+		call.panicked = recover()
+
+		g.mu.Lock()
+		if g.calls[key] == call {
+			delete(g.calls, key)
+		}
+		g.mu.Unlock()
+
+		call.cancel()
+		close(call.done)
+	}()
+
+	call.result = sendBuffered(client, request)
+}
+
+// leave removes a caller that stops waiting, and cancels the upstream call when no caller is left.
+func (g *flightGroup) leave(key string, call *flightCall) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	call.callers--
+	if call.callers > 0 {
+		return
+	}
+
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+	call.cancel()
+}
+
+// detachedContext keeps the values of parent without its deadline and cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (d detachedContext) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
+
+// sendBuffered calls upstream and buffers the body, so it can be read by every caller.
+func sendBuffered(client HttpClient, request *http.Request) flightResult {
+	resp, errHttp := client.Do(request)
+	result := flightResult{
+		resp:    resp,
+		errHttp: errHttp,
+	}
+
+	if resp == nil || resp.Body == nil {
+		return result
+	}
+
+	limit, _ := maxResponseBytesFromContext(request.Context())
+	result.body, result.errBody = readLimited(resp.Body, limit)
+	_ = resp.Body.Close()
+	return result
+}
+
+// response returns a copy of the shared response, body read error is returned when the body is read.
+func (f flightResult) response() (*http.Response, error) {
+	if f.resp == nil {
+		return nil, f.errHttp
+	}
+
+	resp := new(http.Response)
+	*resp = *f.resp
+	resp.Header = f.resp.Header.Clone()
+
+	var body io.Reader = bytes.NewReader(f.body)
+	if f.errBody != nil {
+		body = io.MultiReader(body, &errReader{err: f.errBody})
+	}
+	resp.Body = ioutil.NopCloser(body)
+
+	return resp, f.errHttp
+}
+
+type errReader struct {
+	err error
+}
+
+func (e *errReader) Read(_ []byte) (int, error) {
+	return 0, e.err
+}
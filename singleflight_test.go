@@ -0,0 +1,233 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// countHook counts hooks called and collapsed responses.
+type countHook struct {
+	before    int32
+	after     int32
+	collapsed int32
+}
+
+func (h *countHook) BeforeRequest(_ context.Context, _ HookData) {
+	atomic.AddInt32(&h.before, 1)
+}
+
+func (h *countHook) AfterRequest(_ context.Context, data HookData) {
+	atomic.AddInt32(&h.after, 1)
+	if data.Collapsed {
+		atomic.AddInt32(&h.collapsed, 1)
+	}
+}
+
+// waitCallers waits until n callers are waiting for a flight.
+func waitCallers(g *flightGroup, n int) {
+	for i := 0; i < 1000; i++ {
+		g.mu.Lock()
+		done := false
+		for _, call := range g.calls {
+			done = done || call.callers >= n
+		}
+		g.mu.Unlock()
+
+		if done {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWithSingleflight(t *testing.T) {
+	convey.Convey("Singleflight", t, func() {
+		const waiters = 10
+		var calls int32
+		release := make(chan struct{})
+
+		testClient := &mockClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{"X-Upstream": {"1"}},
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"id": 1}`))),
+				}, nil
+			},
+		}
+
+		hook := new(countHook)
+		client, err := DefaultClient(testClient, WithSingleflight("Authorization"), AddHook(hook))
+		convey.So(err, convey.ShouldBeNil)
+
+		convey.Convey("Concurrent identical GET should call upstream once", func() {
+			var wg sync.WaitGroup
+			responses := make([]HttpResponse, waiters+1)
+			for i := 0; i <= waiters; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					responses[i], _ = client.Get(context.Background(), "corr", "http://example.com/ref", http.Header{"Authorization": {"a"}})
+				}(i)
+			}
+
+			waitCallers(client.flight, waiters+1)
+			close(release)
+			wg.Wait()
+
+			convey.So(atomic.LoadInt32(&calls), convey.ShouldEqual, 1)
+			for _, resp := range responses {
+				convey.So(string(resp.RespBody), convey.ShouldEqual, `{"id": 1}`)
+				convey.So(resp.Raw.Header.Get("X-Upstream"), convey.ShouldEqual, "1")
+			}
+
+			// each caller gets its own header
+			responses[0].Raw.Header.Set("X-Upstream", "changed")
+			convey.So(responses[1].Raw.Header.Get("X-Upstream"), convey.ShouldEqual, "1")
+
+			convey.So(atomic.LoadInt32(&hook.before), convey.ShouldEqual, waiters+1)
+			convey.So(atomic.LoadInt32(&hook.after), convey.ShouldEqual, waiters+1)
+			convey.So(atomic.LoadInt32(&hook.collapsed), convey.ShouldEqual, waiters)
+		})
+
+		convey.Convey("Different selected header should not be collapsed", func() {
+			close(release)
+
+			_, _ = client.Get(context.Background(), "", "http://example.com/ref", http.Header{"Authorization": {"a"}})
+			_, _ = client.Get(context.Background(), "", "http://example.com/ref", http.Header{"Authorization": {"b"}})
+			convey.So(atomic.LoadInt32(&calls), convey.ShouldEqual, 2)
+			convey.So(atomic.LoadInt32(&hook.collapsed), convey.ShouldEqual, 0)
+		})
+
+		convey.Convey("Credentials and response limit should always be part of the key", func() {
+			g := newFlightGroup([]string{"authorization", "Accept-Language"})
+			convey.So(g.headers, convey.ShouldResemble, []string{"Authorization", "Proxy-Authorization", "Cookie", "Accept-Language"})
+
+			request := mustNewRequest(http.MethodGet, "http://example.com/ref")
+			key := g.key(request)
+
+			request.Header.Set("Cookie", "session=b")
+			convey.So(g.key(request), convey.ShouldNotEqual, key)
+			convey.So(g.key(request.WithContext(ContextWithMaxResponseBytes(context.Background(), 10))), convey.ShouldNotEqual, g.key(request))
+		})
+
+		convey.Convey("Caller should stop waiting when its context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			results := make(chan error, 2)
+			go func() {
+				_, err := client.Get(ctx, "", "http://example.com/ref", http.Header{})
+				results <- err
+			}()
+			waitCallers(client.flight, 1)
+			go func() {
+				resp, err := client.Get(context.Background(), "", "http://example.com/ref", http.Header{})
+				if err == nil && string(resp.RespBody) != `{"id": 1}` {
+					err = errors.New("unexpected body " + string(resp.RespBody))
+				}
+				results <- err
+			}()
+			waitCallers(client.flight, 2)
+
+			// the first caller leaves, the upstream call goes on for the second one
+			cancel()
+			err := <-results
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(err.Error(), convey.ShouldContainSubstring, context.Canceled.Error())
+
+			close(release)
+			convey.So(<-results, convey.ShouldBeNil)
+			convey.So(atomic.LoadInt32(&calls), convey.ShouldEqual, 1)
+		})
+	})
+
+	convey.Convey("Singleflight upstream call", t, func() {
+		convey.Convey("Should be canceled when every caller has left", func() {
+			canceled := make(chan struct{})
+			g := newFlightGroup(nil)
+			upstream := &mockClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+				<-req.Context().Done()
+				close(canceled)
+				return nil, req.Context().Err()
+			}}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			_, _, err := g.do(upstream, mustNewRequest(http.MethodGet, "http://example.com/ref").WithContext(ctx))
+			convey.So(errors.Is(err, context.DeadlineExceeded), convey.ShouldBeTrue)
+
+			select {
+			case <-canceled:
+			case <-time.After(time.Second):
+				t.Error("upstream call is not canceled")
+			}
+
+			g.mu.Lock()
+			convey.So(len(g.calls), convey.ShouldEqual, 0)
+			g.mu.Unlock()
+		})
+
+		convey.Convey("Should raise panic in every caller instead of deadlock", func() {
+			g := newFlightGroup(nil)
+			release := make(chan struct{})
+			upstream := &mockClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+				<-release
+				panic("broken client")
+			}}
+
+			panics := make(chan interface{}, 2)
+			for i := 0; i < 2; i++ {
+				go func() {
+					defer func() {
+						panics <- recover()
+					}()
+					_, _, _ = g.do(upstream, mustNewRequest(http.MethodGet, "http://example.com/ref"))
+				}()
+			}
+
+			waitCallers(g, 2)
+			close(release)
+			convey.So(<-panics, convey.ShouldEqual, "broken client")
+			convey.So(<-panics, convey.ShouldEqual, "broken client")
+
+			g.mu.Lock()
+			convey.So(len(g.calls), convey.ShouldEqual, 0)
+			g.mu.Unlock()
+		})
+	})
+}
+
+func TestFlightResultResponse(t *testing.T) {
+	convey.Convey("Flight result", t, func() {
+		convey.Convey("Nil response should return http error", func() {
+			resp, err := flightResult{errHttp: ErrHttpTimeout}.response()
+			convey.So(resp, convey.ShouldBeNil)
+			convey.So(err, convey.ShouldEqual, ErrHttpTimeout)
+		})
+
+		convey.Convey("Body read error should be returned when reading body", func() {
+			resp, err := sendBuffered(&mockClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       noopCloser(&nopReader{err: ErrHttpTimeout}, nil),
+					}, nil
+				},
+			}, &http.Request{}).response()
+			convey.So(err, convey.ShouldBeNil)
+
+			_, err = ioutil.ReadAll(resp.Body)
+			convey.So(err, convey.ShouldEqual, ErrHttpTimeout)
+		})
+	})
+}
@@ -0,0 +1,173 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SRVResolver looks up DNS SRV records, *net.Resolver implements it.
+type SRVResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// SRVConfig configures WithSRV.
+type SRVConfig struct {
+	// Resolver default net.DefaultResolver.
+	Resolver SRVResolver
+	// TTL of resolved records, default 30 seconds. Go resolver doesn't return record TTL, so it is fixed.
+	TTL Duration
+	// Scheme of the resolved target, http or https, default "http".
+	Scheme string
+	// KeepHost sends the SRV name in Host header instead of the target host, see rewriteHost.
+	KeepHost bool
+}
+
+// srvClient sends requests to srv://name/... to a target of name SRV records.
+type srvClient struct {
+	client HttpClient
+	conf   SRVConfig
+	random func(n int) int
+
+	mu    sync.Mutex
+	cache map[string]srvEntry
+	next  int
+}
+
+type srvEntry struct {
+	records []*net.SRV
+	expires time.Time
+}
+
+func newSRVClient(conf SRVConfig, client HttpClient) *srvClient {
+	return &srvClient{client: client, conf: conf, random: rand.Intn, cache: map[string]srvEntry{}}
+}
+
+func (s *srvClient) Do(request *http.Request) (*http.Response, error) {
+	if !strings.EqualFold(request.URL.Scheme, "srv") {
+		return s.client.Do(request)
+	}
+
+	records, err := s.resolve(request.Context(), request.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	// on transport error the request is sent to a target of the next priority,
+	// unless its body can't be sent again or the caller is gone.
+	groups := priorityGroups(records)
+	for i, group := range groups {
+		target := s.pick(group)
+
+		out := request.Clone(request.Context())
+		u := *request.URL
+		u.Scheme = s.conf.Scheme
+		u.Host = net.JoinHostPort(strings.TrimSuffix(target.Target, "."), strconv.Itoa(int(target.Port)))
+		out.URL = &u
+		out.Host = rewriteHost(request, s.conf.KeepHost)
+
+		if i > 0 && request.GetBody != nil {
+			if out.Body, err = request.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := s.client.Do(out)
+		last := i == len(groups)-1 || !canResend(request) || request.Context().Err() != nil
+		if err == nil || resp != nil || last {
+			return resp, err
+		}
+	}
+
+	return nil, errors.New("no SRV target")
+}
+
+// canResend reports whether request body can be sent once more.
+func canResend(request *http.Request) bool {
+	return request.Body == nil || request.Body == http.NoBody || request.GetBody != nil
+}
+
+// resolve returns cached records of name, or looks them up when they are expired.
+// Expired records are still used when lookup fails, so a DNS outage doesn't stop the traffic.
+func (s *srvClient) resolve(ctx context.Context, name string) ([]*net.SRV, error) {
+	s.mu.Lock()
+	entry, ok := s.cache[name]
+	s.mu.Unlock()
+
+	if ok && time.Now().Before(entry.expires) {
+		return entry.records, nil
+	}
+
+	_, records, err := s.conf.Resolver.LookupSRV(ctx, "", "", name)
+	if err == nil && len(records) == 0 {
+		err = errors.New("no record")
+	}
+
+	if err != nil {
+		if ok {
+			return entry.records, nil
+		}
+
+		return nil, fmt.Errorf("fail resolve SRV %s: %s", name, err.Error())
+	}
+
+	s.mu.Lock()
+	s.cache[name] = srvEntry{records: records, expires: time.Now().Add(s.conf.TTL.Std())}
+	s.mu.Unlock()
+
+	return records, nil
+}
+
+// priorityGroups groups records by priority, the lowest priority first.
+func priorityGroups(records []*net.SRV) [][]*net.SRV {
+	sorted := append([]*net.SRV(nil), records...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+
+	var groups [][]*net.SRV
+	for i, record := range sorted {
+		if i == 0 || record.Priority != sorted[i-1].Priority {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], record)
+	}
+
+	return groups
+}
+
+// pick chooses a target of the same priority group by weight as RFC 2782 describes,
+// or in turn when every target has weight 0.
+func (s *srvClient) pick(group []*net.SRV) *net.SRV {
+	total := 0
+	for _, record := range group {
+		total += int(record.Weight)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if total == 0 {
+		picked := group[s.next%len(group)]
+		s.next++
+		return picked
+	}
+
+	roll := s.random(total)
+	for _, record := range group {
+		if roll < int(record.Weight) {
+			return record
+		}
+		roll -= int(record.Weight)
+	}
+
+	return group[len(group)-1]
+}
@@ -0,0 +1,229 @@
+package rest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// fakeResolver answers SRV records of names, or err, and counts lookups.
+type fakeResolver struct {
+	mu      sync.Mutex
+	records map[string][]*net.SRV
+	err     error
+	lookups int
+}
+
+func (f *fakeResolver) LookupSRV(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.lookups++
+	if f.err != nil {
+		return "", nil, f.err
+	}
+
+	return name, f.records[name], nil
+}
+
+func (f *fakeResolver) set(name string, records []*net.SRV, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.records[name] = records
+	f.err = err
+}
+
+func srvRecord(server *httptest.Server, priority, weight uint16) *net.SRV {
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return &net.SRV{Target: host + ".", Port: uint16(p), Priority: priority, Weight: weight}
+}
+
+func TestWithSRV(t *testing.T) {
+	convey.Convey("Test WithSRV", t, func() {
+		ctx := context.Background()
+		var servers []*httptest.Server
+		var failing, down int32
+		for _, name := range []string{"a", "b", "c"} {
+			server := newEndpointServer(name, &failing, &down)
+			defer server.Close()
+			servers = append(servers, server)
+		}
+
+		resolver := &fakeResolver{records: map[string][]*net.SRV{}}
+		names := func(client *DefaultHttpRequester, n int) []string {
+			var got []string
+			for i := 0; i < n; i++ {
+				resp, err := client.Get(ctx, "", "srv://payments.service.consul/v1/charges?id=1", http.Header{})
+				convey.So(err, convey.ShouldBeNil)
+				got = append(got, string(resp.RespBody[:1]))
+			}
+			return got
+		}
+
+		convey.Convey("Should send to targets of the lowest priority in turn", func() {
+			resolver.set("payments.service.consul", []*net.SRV{
+				srvRecord(servers[2], 20, 0),
+				srvRecord(servers[0], 10, 0),
+				srvRecord(servers[1], 10, 0),
+			}, nil)
+
+			client, err := DefaultClient(http.DefaultClient, WithSRV(SRVConfig{Resolver: resolver}))
+			convey.So(err, convey.ShouldBeNil)
+
+			resp, _ := client.Get(ctx, "", "srv://payments.service.consul/v1/charges?id=1", http.Header{})
+			convey.So(string(resp.RespBody), convey.ShouldEqual, "a /v1/charges?id=1")
+			convey.So(names(client, 3), convey.ShouldResemble, []string{"b", "a", "b"})
+			convey.So(resolver.lookups, convey.ShouldEqual, 1)
+
+			resp, err = client.Get(ctx, "", servers[2].URL+"/direct", http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(string(resp.RespBody), convey.ShouldEqual, "c /direct")
+		})
+
+		convey.Convey("Should pick target by weight", func() {
+			s := newSRVClient(SRVConfig{Resolver: resolver}, http.DefaultClient)
+			records := []*net.SRV{
+				{Target: "a.", Priority: 1, Weight: 1},
+				{Target: "b.", Priority: 1, Weight: 3},
+				{Target: "c.", Priority: 2, Weight: 100},
+			}
+
+			for roll, want := range []string{"a.", "b.", "b.", "b."} {
+				roll := roll
+				s.random = func(n int) int {
+					convey.So(n, convey.ShouldEqual, 4)
+					return roll
+				}
+				convey.So(s.pick(priorityGroups(records)[0]).Target, convey.ShouldEqual, want)
+			}
+		})
+
+		convey.Convey("Should send to the next priority on transport error", func() {
+			dead := httptest.NewServer(http.NotFoundHandler())
+			dead.Close()
+
+			var body string
+			echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				body = string(b)
+			}))
+			defer echo.Close()
+
+			resolver.set("payments.service.consul", []*net.SRV{
+				srvRecord(dead, 10, 0),
+				srvRecord(echo, 20, 0),
+				srvRecord(servers[2], 30, 0),
+			}, nil)
+			client, _ := DefaultClient(http.DefaultClient, WithSRV(SRVConfig{Resolver: resolver}))
+
+			resp, err := client.Post(ctx, "", "srv://payments.service.consul/v1/charges", http.Header{}, []byte(`{"amount":1}`))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(resp.Raw.StatusCode, convey.ShouldEqual, http.StatusOK)
+			convey.So(body, convey.ShouldEqual, `{"amount":1}`)
+
+			resolver.set("payments.service.consul", []*net.SRV{srvRecord(dead, 10, 0)}, nil)
+			client, _ = DefaultClient(http.DefaultClient, WithSRV(SRVConfig{Resolver: resolver}))
+			_, err = client.Get(ctx, "", "srv://payments.service.consul/", http.Header{})
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Should send SRV name in Host header of signed request", func() {
+			var host string
+			verified := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				host = r.Host
+				mac := hmac.New(sha256.New, []byte("secret"))
+				mac.Write([]byte(r.Host + "\n" + r.URL.Path + "\n" + r.Header.Get("X-Timestamp")))
+				verified = hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(r.Header.Get("X-Signature")))
+			}))
+			defer server.Close()
+
+			resolver.set("payments.service.consul", []*net.SRV{srvRecord(server, 1, 1)}, nil)
+			client, _ := DefaultClient(http.DefaultClient, WithSRV(SRVConfig{Resolver: resolver}), WithHMAC(HMACConfig{
+				Secret:     []byte("secret"),
+				Components: []HMACComponent{HMACHost, HMACPath, HMACTimestamp},
+			}))
+
+			_, err := client.Get(ctx, "", "srv://payments.service.consul/v1/charges", http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(host, convey.ShouldEqual, "payments.service.consul")
+			convey.So(verified, convey.ShouldBeTrue)
+
+			client, _ = DefaultClient(http.DefaultClient, WithSRV(SRVConfig{Resolver: resolver}))
+			_, _ = client.Get(ctx, "", "srv://payments.service.consul/v1/charges", http.Header{})
+			convey.So(host, convey.ShouldEqual, server.Listener.Addr().String())
+
+			client, _ = DefaultClient(http.DefaultClient, WithSRV(SRVConfig{Resolver: resolver, KeepHost: true}))
+			_, _ = client.Get(ctx, "", "srv://payments.service.consul/v1/charges", http.Header{})
+			convey.So(host, convey.ShouldEqual, "payments.service.consul")
+		})
+
+		convey.Convey("Should reject scheme other than http and https", func() {
+			_, err := DefaultClient(http.DefaultClient, WithSRV(SRVConfig{Resolver: resolver, Scheme: "ftp"}))
+			convey.So(err, convey.ShouldNotBeNil)
+
+			_, err = DefaultClient(http.DefaultClient, WithSRV(SRVConfig{Resolver: resolver, Scheme: "https"}))
+			convey.So(err, convey.ShouldBeNil)
+		})
+
+		convey.Convey("Should look up again after TTL and keep stale records when lookup fails", func() {
+			resolver.set("payments.service.consul", []*net.SRV{srvRecord(servers[0], 1, 1)}, nil)
+			client, _ := DefaultClient(http.DefaultClient, WithSRV(SRVConfig{Resolver: resolver, TTL: Duration(30 * time.Millisecond)}))
+
+			convey.So(names(client, 2), convey.ShouldResemble, []string{"a", "a"})
+			convey.So(resolver.lookups, convey.ShouldEqual, 1)
+
+			resolver.set("payments.service.consul", []*net.SRV{srvRecord(servers[1], 1, 1)}, nil)
+			time.Sleep(30 * time.Millisecond)
+			convey.So(names(client, 1), convey.ShouldResemble, []string{"b"})
+			convey.So(resolver.lookups, convey.ShouldEqual, 2)
+
+			resolver.set("payments.service.consul", nil, errors.New("no such host"))
+			time.Sleep(30 * time.Millisecond)
+			convey.So(names(client, 1), convey.ShouldResemble, []string{"b"})
+			convey.So(resolver.lookups, convey.ShouldEqual, 3)
+		})
+
+		convey.Convey("Should return error when name can't be resolved", func() {
+			client, _ := DefaultClient(http.DefaultClient, WithSRV(SRVConfig{Resolver: resolver}))
+
+			_, err := client.Get(ctx, "", "srv://unknown.service.consul/", http.Header{})
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(err.Error(), convey.ShouldContainSubstring, "fail resolve SRV unknown.service.consul")
+
+			resolver.set("payments.service.consul", nil, errors.New("no such host"))
+			_, err = client.Get(ctx, "", "srv://payments.service.consul/", http.Header{})
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(err.Error(), convey.ShouldContainSubstring, "no such host")
+		})
+
+		convey.Convey("Should resolve concurrent requests without race", func() {
+			resolver.set("payments.service.consul", []*net.SRV{srvRecord(servers[0], 1, 1), srvRecord(servers[1], 1, 2)}, nil)
+			client, _ := DefaultClient(http.DefaultClient, WithSRV(SRVConfig{Resolver: resolver, TTL: Duration(time.Millisecond)}))
+
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, _ = client.Get(ctx, "", "srv://payments.service.consul/", http.Header{})
+				}()
+			}
+			wg.Wait()
+		})
+	})
+}
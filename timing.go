@@ -0,0 +1,108 @@
+package rest
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings is the duration of each phase of the request measured with net/http/httptrace.
+// Phase that doesn't happen is zero, e.g. DNS, Connect and TLS on a reused connection.
+// When the client doesn't report connection events, e.g. response from cache or mock client,
+// the whole call is counted as Wait.
+type Timings struct {
+	Blocked Duration `json:"blocked"` // waiting for a connection from the pool
+	DNS     Duration `json:"dns"`
+	Connect Duration `json:"connect"` // TCP connect, without TLS handshake
+	TLS     Duration `json:"tls"`
+	Send    Duration `json:"send"`
+	Wait    Duration `json:"wait"` // waiting for the first response byte
+	Receive Duration `json:"receive"`
+	Total   Duration `json:"total"`
+}
+
+// timingTrace records httptrace events of one call.
+type timingTrace struct {
+	mu           sync.Mutex
+	start        time.Time
+	getConn      time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConn      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	end          time.Time
+}
+
+func newTimingTrace(start time.Time) *timingTrace {
+	return &timingTrace{start: start}
+}
+
+// set stores now in field, events can be reported from transport goroutines.
+func (t *timingTrace) set(field *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	*field = time.Now()
+}
+
+func (t *timingTrace) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn:              func(string) { t.set(&t.getConn) },
+		DNSStart:             func(httptrace.DNSStartInfo) { t.set(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.set(&t.dnsDone) },
+		ConnectStart:         func(string, string) { t.set(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { t.set(&t.connectDone) },
+		TLSHandshakeStart:    func() { t.set(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.set(&t.tlsDone) },
+		GotConn:              func(httptrace.GotConnInfo) { t.set(&t.gotConn) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.set(&t.wroteRequest) },
+		GotFirstResponseByte: func() { t.set(&t.firstByte) },
+	}
+}
+
+// done marks the response body is fully read.
+func (t *timingTrace) done() {
+	t.set(&t.end)
+}
+
+func (t *timingTrace) timings() Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	end := t.end
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	between := func(from, to time.Time) Duration {
+		if from.IsZero() || to.IsZero() || to.Before(from) {
+			return 0
+		}
+
+		return Duration(to.Sub(from))
+	}
+
+	timings := Timings{Total: between(t.start, end)}
+	if t.gotConn.IsZero() || t.firstByte.IsZero() {
+		timings.Wait = timings.Total
+		return timings
+	}
+
+	timings.DNS = between(t.dnsStart, t.dnsDone)
+	timings.Connect = between(t.connectStart, t.connectDone)
+	timings.TLS = between(t.tlsStart, t.tlsDone)
+	if blocked := between(t.getConn, t.gotConn) - timings.DNS - timings.Connect - timings.TLS; blocked > 0 {
+		timings.Blocked = blocked
+	}
+
+	timings.Send = between(t.gotConn, t.wroteRequest)
+	timings.Wait = between(t.wroteRequest, t.firstByte)
+	timings.Receive = between(t.firstByte, end)
+	return timings
+}
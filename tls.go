@@ -0,0 +1,311 @@
+package rest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ConfigTLS configures TLS used by http.Transport.
+//
+// Client certificate is read either from CertFile and KeyFile, or from CertPEM and KeyPEM.
+// When read from files, the certificate is reloaded automatically when one of the files changes on disk.
+//
+// CAFile and CAPEM add private CA bundle to the system root CAs,
+// set SkipSystemRoots to trust only the given bundle.
+//
+// PinnedSPKI is a list of base64 SHA-256 hash of the server certificate public key (SPKI),
+// with or without "sha256/" prefix. When it's not empty, the connection is rejected unless
+// one of certificates in the verified chain matches one of the pins.
+type ConfigTLS struct {
+	CertFile        string   `json:"cert_file" yaml:"cert_file"`
+	KeyFile         string   `json:"key_file" yaml:"key_file"`
+	CertPEM         string   `json:"cert_pem" yaml:"cert_pem"`
+	KeyPEM          string   `json:"key_pem" yaml:"key_pem"`
+	CAFile          string   `json:"ca_file" yaml:"ca_file"`
+	CAPEM           string   `json:"ca_pem" yaml:"ca_pem"`
+	SkipSystemRoots bool     `json:"skip_system_roots" yaml:"skip_system_roots"`
+	MinVersion      string   `json:"min_version" yaml:"min_version"`     // one of "1.0", "1.1", "1.2" or "1.3", default "1.2"
+	CipherSuites    []string `json:"cipher_suites" yaml:"cipher_suites"` // e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, default is Go default
+	ServerName      string   `json:"server_name" yaml:"server_name"`     // override server name used to verify certificate and SNI
+	PinnedSPKI      []string `json:"pinned_spki" yaml:"pinned_spki"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Validate returns error for nonsensical TLS config value without reading any file.
+func (c ConfigTLS) Validate() error {
+	var errs []error
+
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		errs = append(errs, errors.New("transport.tls.cert_file and transport.tls.key_file must be set together"))
+	}
+
+	if (c.CertPEM == "") != (c.KeyPEM == "") {
+		errs = append(errs, errors.New("transport.tls.cert_pem and transport.tls.key_pem must be set together"))
+	}
+
+	if c.CertFile != "" && c.CertPEM != "" {
+		errs = append(errs, errors.New("transport.tls client certificate must be set either from file or PEM, not both"))
+	}
+
+	if c.SkipSystemRoots && c.CAFile == "" && c.CAPEM == "" {
+		errs = append(errs, errors.New("transport.tls.skip_system_roots needs ca_file or ca_pem"))
+	}
+
+	if _, ok := tlsVersions[c.MinVersion]; c.MinVersion != "" && !ok {
+		errs = append(errs, fmt.Errorf("transport.tls.min_version %q must be one of 1.0, 1.1, 1.2 or 1.3", c.MinVersion))
+	}
+
+	if _, err := cipherSuiteIDs(c.CipherSuites); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := decodePins(c.PinnedSPKI); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// isZero returns true when nothing is configured, so Go default TLS config can be used.
+func (c ConfigTLS) isZero() bool {
+	return c.CertFile == "" && c.CertPEM == "" && c.CAFile == "" && c.CAPEM == "" &&
+		c.MinVersion == "" && len(c.CipherSuites) == 0 && c.ServerName == "" && len(c.PinnedSPKI) == 0
+}
+
+// newTLSConfig returns tls.Config from ConfigTLS, it returns nil when nothing is configured.
+func newTLSConfig(c ConfigTLS) (*tls.Config, error) {
+	if c.isZero() {
+		return nil, nil
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	conf := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.ServerName,
+	}
+
+	if c.MinVersion != "" {
+		conf.MinVersion = tlsVersions[c.MinVersion]
+	}
+
+	conf.CipherSuites, _ = cipherSuiteIDs(c.CipherSuites)
+
+	if c.CAFile != "" || c.CAPEM != "" {
+		pool, err := certPool(c)
+		if err != nil {
+			return nil, err
+		}
+
+		conf.RootCAs = pool
+	}
+
+	switch {
+	case c.CertFile != "":
+		reloader, err := newCertReloader(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		conf.GetClientCertificate = reloader.GetClientCertificate
+
+	case c.CertPEM != "":
+		cert, err := tls.X509KeyPair([]byte(c.CertPEM), []byte(c.KeyPEM))
+		if err != nil {
+			return nil, fmt.Errorf("fail parse client certificate: %s", err.Error())
+		}
+
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(c.PinnedSPKI) > 0 {
+		pins, _ := decodePins(c.PinnedSPKI)
+		conf.VerifyConnection = verifyPins(pins)
+	}
+
+	return conf, nil
+}
+
+func certPool(c ConfigTLS) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !c.SkipSystemRoots {
+		if system, err := x509.SystemCertPool(); err == nil {
+			pool = system
+		}
+	}
+
+	if c.CAFile != "" {
+		ca, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("fail read ca file: %s", err.Error())
+		}
+
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in ca file %s", c.CAFile)
+		}
+	}
+
+	if c.CAPEM != "" && !pool.AppendCertsFromPEM([]byte(c.CAPEM)) {
+		return nil, errors.New("no certificate found in ca pem")
+	}
+
+	return pool, nil
+}
+
+func cipherSuiteIDs(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("transport.tls.cipher_suites %q is unknown", name)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func decodePins(pins []string) ([][]byte, error) {
+	decoded := make([][]byte, 0, len(pins))
+	for _, pin := range pins {
+		hash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, "sha256/"))
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("transport.tls.pinned_spki %q must be base64 of SHA-256 hash", pin)
+		}
+
+		decoded = append(decoded, hash)
+	}
+
+	return decoded, nil
+}
+
+// SPKIHash returns base64 SHA-256 hash of certificate public key, the value used in ConfigTLS.PinnedSPKI.
+func SPKIHash(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// verifyPins checks pins against certificates of the verified chains only, since server may send any certificate
+// in PeerCertificates, e.g. the pinned one appended to a mis-issued chain. When the chain isn't verified
+// because InsecureSkipVerify is set, only the leaf certificate is checked.
+func verifyPins(pins [][]byte) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		var certs []*x509.Certificate
+		for _, chain := range state.VerifiedChains {
+			certs = append(certs, chain...)
+		}
+
+		if len(state.VerifiedChains) == 0 && len(state.PeerCertificates) > 0 {
+			certs = state.PeerCertificates[:1]
+		}
+
+		for _, cert := range certs {
+			hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if bytes.Equal(hash[:], pin) {
+					return nil
+				}
+			}
+		}
+
+		return ErrCertificatePinMismatch
+	}
+}
+
+// certReloader reloads client certificate when the files modification time or size changes.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	version string
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// fileVersion returns string that changes when one of the files is changed.
+func (r *certReloader) fileVersion() (string, error) {
+	version := ""
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return "", err
+		}
+
+		version += fmt.Sprintf("%s:%d:%d;", name, info.ModTime().UnixNano(), info.Size())
+	}
+
+	return version, nil
+}
+
+func (r *certReloader) reload() error {
+	version, err := r.fileVersion()
+	if err != nil {
+		return fmt.Errorf("fail read client certificate: %s", err.Error())
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if version == r.version {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("fail load client certificate: %s", err.Error())
+	}
+
+	r.cert = &cert
+	r.version = version
+	return nil
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate,
+// when the files can't be reloaded (e.g. in the middle of rotation) the previous certificate is used.
+func (r *certReloader) GetClientCertificate(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	_ = r.reload()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.cert, nil
+}
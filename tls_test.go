@@ -0,0 +1,269 @@
+package rest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM string
+	keyPEM  string
+}
+
+// newTestCert creates certificate signed by parent, or self-signed CA when parent is nil.
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		keyPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+	}
+}
+
+func pinOf(cert *x509.Certificate) []byte {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hash[:]
+}
+
+func TestMutualTLS(t *testing.T) {
+	convey.Convey("Mutual TLS", t, func() {
+		ca := newTestCert(t, "test-ca", nil)
+		server := newTestCert(t, "partner.example", ca)
+		client := newTestCert(t, "client", ca)
+
+		pool := x509.NewCertPool()
+		pool.AddCert(ca.cert)
+
+		serverCert, _ := tls.X509KeyPair([]byte(server.certPEM), []byte(server.keyPEM))
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+		}))
+		srv.TLS = &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    pool,
+		}
+		srv.StartTLS()
+		defer srv.Close()
+
+		dir := t.TempDir()
+		write := func(name, content string) string {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			return path
+		}
+
+		get := func(conf ConfigTLS) (string, error) {
+			httpClient, err := BuildHttpClient(Config{Transport: ConfigTransport{TLS: conf}})
+			if err != nil {
+				return "", err
+			}
+
+			requester, _ := DefaultClient(httpClient)
+			resp, err := requester.Get(context.Background(), "", srv.URL, http.Header{})
+			return string(resp.RespBody), err
+		}
+
+		convey.Convey("Should connect using client certificate from PEM and private CA", func() {
+			body, err := get(ConfigTLS{
+				CertPEM:    client.certPEM,
+				KeyPEM:     client.keyPEM,
+				CAPEM:      ca.certPEM,
+				ServerName: "partner.example",
+				MinVersion: "1.3",
+			})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(body, convey.ShouldEqual, "client")
+		})
+
+		convey.Convey("Should fail without client certificate", func() {
+			_, err := get(ConfigTLS{
+				CAPEM:      ca.certPEM,
+				ServerName: "partner.example",
+			})
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Should fail when CA is not trusted", func() {
+			_, err := get(ConfigTLS{
+				CertPEM:    client.certPEM,
+				KeyPEM:     client.keyPEM,
+				ServerName: "partner.example",
+			})
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Should accept matching pin and reject other pin", func() {
+			conf := ConfigTLS{
+				CertPEM:    client.certPEM,
+				KeyPEM:     client.keyPEM,
+				CAPEM:      ca.certPEM,
+				ServerName: "partner.example",
+				PinnedSPKI: []string{"sha256/" + SPKIHash(server.cert)},
+			}
+
+			_, err := get(conf)
+			convey.So(err, convey.ShouldBeNil)
+
+			conf.PinnedSPKI = []string{SPKIHash(client.cert)}
+			_, err = get(conf)
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Should reject pinned certificate appended to the chain sent by server", func() {
+			unrelated := newTestCert(t, "pinned-ca", nil)
+			chain, _ := tls.X509KeyPair([]byte(server.certPEM+unrelated.certPEM), []byte(server.keyPEM))
+			appended := httptest.NewUnstartedServer(srv.Config.Handler)
+			appended.TLS = &tls.Config{Certificates: []tls.Certificate{chain}}
+			appended.StartTLS()
+			defer appended.Close()
+
+			httpClient, err := BuildHttpClient(Config{Transport: ConfigTransport{TLS: ConfigTLS{
+				CAPEM:      ca.certPEM,
+				ServerName: "partner.example",
+				PinnedSPKI: []string{SPKIHash(unrelated.cert)},
+			}}})
+			convey.So(err, convey.ShouldBeNil)
+
+			requester, _ := DefaultClient(httpClient)
+			_, err = requester.Get(context.Background(), "", appended.URL, http.Header{})
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(err.Error(), convey.ShouldContainSubstring, ErrCertificatePinMismatch.Error())
+		})
+
+		convey.Convey("Should check only leaf certificate when chain isn't verified", func() {
+			verify := verifyPins([][]byte{pinOf(ca.cert)})
+			convey.So(verify(tls.ConnectionState{PeerCertificates: []*x509.Certificate{server.cert, ca.cert}}), convey.ShouldEqual, ErrCertificatePinMismatch)
+
+			verify = verifyPins([][]byte{pinOf(server.cert)})
+			convey.So(verify(tls.ConnectionState{PeerCertificates: []*x509.Certificate{server.cert, ca.cert}}), convey.ShouldBeNil)
+
+			verify = verifyPins([][]byte{pinOf(ca.cert)})
+			convey.So(verify(tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{server.cert},
+				VerifiedChains:   [][]*x509.Certificate{{server.cert, ca.cert}},
+			}), convey.ShouldBeNil)
+		})
+
+		convey.Convey("Should reload client certificate when files change", func() {
+			certFile := write("client.crt", client.certPEM)
+			keyFile := write("client.key", client.keyPEM)
+
+			httpClient, err := BuildHttpClient(Config{Transport: ConfigTransport{TLS: ConfigTLS{
+				CertFile:   certFile,
+				KeyFile:    keyFile,
+				CAFile:     write("ca.crt", ca.certPEM),
+				ServerName: "partner.example",
+			}}})
+			convey.So(err, convey.ShouldBeNil)
+
+			requester, _ := DefaultClient(httpClient)
+			resp, err := requester.Get(context.Background(), "", srv.URL, http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(string(resp.RespBody), convey.ShouldEqual, "client")
+
+			rotated := newTestCert(t, "rotated", ca)
+			write("client.crt", rotated.certPEM)
+			write("client.key", rotated.keyPEM)
+			future := time.Now().Add(time.Minute)
+			_ = os.Chtimes(certFile, future, future)
+
+			httpClient.CloseIdleConnections()
+			resp, err = requester.Get(context.Background(), "", srv.URL, http.Header{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(string(resp.RespBody), convey.ShouldEqual, "rotated")
+		})
+
+		convey.Convey("Should return error when files are missing", func() {
+			_, err := BuildHttpClient(Config{Transport: ConfigTransport{TLS: ConfigTLS{
+				CertFile: filepath.Join(dir, "missing.crt"),
+				KeyFile:  filepath.Join(dir, "missing.key"),
+			}}})
+			convey.So(err, convey.ShouldNotBeNil)
+
+			_, err = BuildHttpClient(Config{Transport: ConfigTransport{TLS: ConfigTLS{
+				CAFile: filepath.Join(dir, "missing.crt"),
+			}}})
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
+
+func TestConfigTLSValidate(t *testing.T) {
+	convey.Convey("TLS config validation", t, func() {
+		convey.So(ConfigTLS{}.Validate(), convey.ShouldBeNil)
+		convey.So(ConfigTLS{CertFile: "a.crt"}.Validate(), convey.ShouldNotBeNil)
+		convey.So(ConfigTLS{CertPEM: "pem"}.Validate(), convey.ShouldNotBeNil)
+		convey.So(ConfigTLS{CertFile: "a", KeyFile: "b", CertPEM: "c", KeyPEM: "d"}.Validate(), convey.ShouldNotBeNil)
+		convey.So(ConfigTLS{SkipSystemRoots: true}.Validate(), convey.ShouldNotBeNil)
+		convey.So(ConfigTLS{MinVersion: "1.4"}.Validate(), convey.ShouldNotBeNil)
+		convey.So(ConfigTLS{CipherSuites: []string{"TLS_UNKNOWN"}}.Validate(), convey.ShouldNotBeNil)
+		convey.So(ConfigTLS{CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}}.Validate(), convey.ShouldBeNil)
+		convey.So(ConfigTLS{PinnedSPKI: []string{"not-a-hash"}}.Validate(), convey.ShouldNotBeNil)
+	})
+
+	convey.Convey("NewHttpClient should fail every request on invalid TLS config", t, func() {
+		var httpClient *http.Client
+		convey.So(func() {
+			httpClient = NewHttpClient(Config{Transport: ConfigTransport{TLS: ConfigTLS{CertPEM: "a", KeyPEM: "b"}}})
+		}, convey.ShouldNotPanic)
+
+		_, err := httpClient.Get("https://partner.example/")
+		convey.So(err, convey.ShouldNotBeNil)
+		convey.So(err.Error(), convey.ShouldContainSubstring, "fail parse client certificate")
+	})
+}